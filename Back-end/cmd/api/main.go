@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"expense-splitter/internal/config"
 	"expense-splitter/internal/database"
+	"expense-splitter/internal/events"
 	"expense-splitter/internal/handlers"
+	"expense-splitter/internal/mail"
 	"expense-splitter/internal/services"
+	"expense-splitter/internal/slip"
+	"expense-splitter/internal/storage"
 	"log"
 	"os"
-	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
 )
 
 func main() {
@@ -20,22 +26,9 @@ func main() {
 	log.Printf("Working directory: %s", wd)
 
 	// ลองหา .env ใน path ต่างๆ
-	envPaths := []string{
-		"configs/.env",
-		".env",
-		filepath.Join(wd, "configs", ".env"),
-	}
-
-	loaded := false
-	for _, path := range envPaths {
-		if err := godotenv.Load(path); err == nil {
-			log.Printf("✅ Loaded .env from: %s", path)
-			loaded = true
-			break
-		}
-	}
-
-	if !loaded {
+	if path := config.LoadEnv(); path != "" {
+		log.Printf("✅ Loaded .env from: %s", path)
+	} else {
 		log.Println("⚠️ No .env file found, using environment variables")
 	}
 
@@ -55,22 +48,240 @@ func main() {
 
 	// ... ส่วนที่เหลือเหมือนเดิม
 
-	// Run migrations
-	if err := database.RunMigrations(db); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	// Check migrations; schema changes are applied with `go run ./cmd/migrate up`
+	// unless MIGRATE_ON_START=true
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		count, err := migrator.Up()
+		if err != nil {
+			log.Fatal("Failed to run migrations:", err)
+		}
+		log.Printf("Applied %d migrations", count)
+	} else {
+		pending, err := migrator.Pending()
+		if err != nil {
+			log.Fatal("Failed to check migrations:", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("%d pending migrations, run `go run ./cmd/migrate up` or set MIGRATE_ON_START=true", len(pending))
+		}
+	}
+
+	// Push group changes to clients. EVENT_BROKER=postgres shares events
+	// between instances through LISTEN/NOTIFY.
+	var broker events.Broker
+	switch os.Getenv("EVENT_BROKER") {
+	case "", "memory":
+		broker = events.NewMemoryBroker()
+	case "postgres":
+		broker = events.NewPostgresBroker(db, database.ConnString(), "group_events")
+	default:
+		log.Fatalf("Invalid EVENT_BROKER %q", os.Getenv("EVENT_BROKER"))
 	}
+	hub := events.NewHub(broker)
+	go func() {
+		if err := hub.Run(context.Background()); err != nil {
+			log.Fatal("Event broker failed:", err)
+		}
+	}()
 
 	// Initialize services
 	userService := services.NewUserService(db)
-	groupService := services.NewGroupService(db)
-	expenseService := services.NewExpenseService(db)
+	groupService := services.NewGroupService(db, hub)
+	exchangeRateService := services.NewExchangeRateService(db)
+	expenseService := services.NewExpenseService(db, groupService, exchangeRateService, hub)
 	friendService := services.NewFriendService(db)
+	inviteService := services.NewInviteService(db, hub)
+	guestService := services.NewGuestService(db, hub)
+	categoryService := services.NewCategoryService(db)
+	recurringService := services.NewRecurringService(db, expenseService)
+	auditService := services.NewAuditService(db)
+	activityService := services.NewActivityService(db)
+	notificationService := services.NewNotificationService(db)
+	promptPayService := services.NewPromptPayService(db, expenseService)
+
+	// Load exchange rates from a local CSV or ECB-style XML file
+	if ratesFile := os.Getenv("EXCHANGE_RATES_FILE"); ratesFile != "" {
+		count, err := exchangeRateService.ImportFile(ratesFile)
+		if err != nil {
+			log.Fatal("Failed to load exchange rates:", err)
+		}
+		log.Printf("Loaded %d exchange rates from %s", count, ratesFile)
+	}
+
+	// Post recurring expenses as they fall due
+	recurringInterval := time.Minute
+	if value := os.Getenv("RECURRING_CHECK_INTERVAL"); value != "" {
+		recurringInterval, err = time.ParseDuration(value)
+		if err != nil || recurringInterval <= 0 {
+			log.Fatalf("Invalid RECURRING_CHECK_INTERVAL %q", value)
+		}
+	}
+	go recurringService.Run(context.Background(), recurringInterval)
+
+	// Purge expenses and groups that have been in the trash too long
+	trashRetention := services.DefaultTrashRetention
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			log.Fatalf("Invalid TRASH_RETENTION_DAYS %q", value)
+		}
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+	trashPurgeInterval := time.Hour
+	if value := os.Getenv("TRASH_PURGE_INTERVAL"); value != "" {
+		trashPurgeInterval, err = time.ParseDuration(value)
+		if err != nil || trashPurgeInterval <= 0 {
+			log.Fatalf("Invalid TRASH_PURGE_INTERVAL %q", value)
+		}
+	}
+	trashService := services.NewTrashService(db, groupService, trashRetention, hub)
+	go trashService.Run(context.Background(), trashPurgeInterval)
+
+	// Remind debtors of payment requests at PAYMENT_REMINDER_OFFSETS from the
+	// due date, such as "-72h,0h,72h,168h"
+	reminderOffsets := services.DefaultReminderOffsets
+	if value := os.Getenv("PAYMENT_REMINDER_OFFSETS"); value != "" {
+		reminderOffsets, err = services.ParseReminderOffsets(value)
+		if err != nil {
+			log.Fatalf("Invalid PAYMENT_REMINDER_OFFSETS %q", value)
+		}
+	}
+	reminderInterval := 15 * time.Minute
+	if value := os.Getenv("PAYMENT_REMINDER_INTERVAL"); value != "" {
+		reminderInterval, err = time.ParseDuration(value)
+		if err != nil || reminderInterval <= 0 {
+			log.Fatalf("Invalid PAYMENT_REMINDER_INTERVAL %q", value)
+		}
+	}
+	paymentRequestService := services.NewPaymentRequestService(db, expenseService, reminderOffsets)
+	go paymentRequestService.Run(context.Background(), reminderInterval)
+
+	// Deliver queued mail. MAILER=smtp sends through SMTP_HOST; during
+	// development MAILER=file writes .eml files to MAIL_DIR, and the default
+	// only logs messages.
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Expense Splitter <no-reply@localhost>"
+	}
+	var mailer mail.Mailer
+	switch os.Getenv("MAILER") {
+	case "", "log":
+		mailer = mail.LogMailer{}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		mailer, err = mail.NewFileMailer(dir, mailFrom)
+		if err != nil {
+			log.Fatal("Failed to set up mail:", err)
+		}
+	case "smtp":
+		smtpPort := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			smtpPort, err = strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("Invalid SMTP_PORT %q", value)
+			}
+		}
+		mailer = mail.NewSMTPMailer(os.Getenv("SMTP_HOST"), smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	default:
+		log.Fatalf("Invalid MAILER %q", os.Getenv("MAILER"))
+	}
+	mailInterval := 30 * time.Second
+	if value := os.Getenv("MAIL_INTERVAL"); value != "" {
+		mailInterval, err = time.ParseDuration(value)
+		if err != nil || mailInterval <= 0 {
+			log.Fatalf("Invalid MAIL_INTERVAL %q", value)
+		}
+	}
+	mailService := services.NewMailService(db, mailer, expenseService)
+	go mailService.Run(context.Background(), mailInterval)
+
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Keep uploaded files where STORAGE_BACKEND says: "local" keeps them in
+	// STORAGE_DIR and serves them through the API, "s3" in any S3-compatible
+	// bucket such as MinIO, and "cloudinary" on Cloudinary, which is also
+	// picked when only the Cloudinary settings are given. Download URLs
+	// expire after STORAGE_URL_TTL where the backend allows.
+	storageURLTTL := time.Hour
+	if value := os.Getenv("STORAGE_URL_TTL"); value != "" {
+		storageURLTTL, err = time.ParseDuration(value)
+		if err != nil || storageURLTTL <= 0 {
+			log.Fatalf("Invalid STORAGE_URL_TTL %q", value)
+		}
+	}
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" && os.Getenv("CLOUDINARY_CLOUD_NAME") != "" {
+		storageBackend = "cloudinary"
+	}
+	var files storage.Storage
+	var localFiles *storage.LocalStorage
+	switch storageBackend {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		baseURL := os.Getenv("STORAGE_PUBLIC_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:" + port + "/api/files"
+		}
+		// Anyone who knows the key can make download links, so it must be set
+		// and kept apart from the JWT secret
+		signingKey := os.Getenv("STORAGE_SIGNING_KEY")
+		if signingKey == "" {
+			log.Fatal("STORAGE_SIGNING_KEY must be set for local file storage")
+		}
+		localFiles, err = storage.NewLocalStorage(dir, baseURL, []byte(signingKey), storageURLTTL)
+		files = localFiles
+	case "s3":
+		useSSL := os.Getenv("S3_USE_SSL") != "false"
+		files, err = storage.NewS3Storage(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"), os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), os.Getenv("S3_BUCKET"), useSSL, storageURLTTL)
+	case "cloudinary":
+		files, err = storage.NewCloudinaryStorage(os.Getenv("CLOUDINARY_CLOUD_NAME"), os.Getenv("CLOUDINARY_API_KEY"), os.Getenv("CLOUDINARY_API_SECRET"))
+	default:
+		log.Fatalf("Invalid STORAGE_BACKEND %q", storageBackend)
+	}
+	if err != nil {
+		log.Fatal("Failed to set up file storage:", err)
+	}
+	storageCleanupInterval := time.Hour
+	if value := os.Getenv("STORAGE_CLEANUP_INTERVAL"); value != "" {
+		storageCleanupInterval, err = time.ParseDuration(value)
+		if err != nil || storageCleanupInterval <= 0 {
+			log.Fatalf("Invalid STORAGE_CLEANUP_INTERVAL %q", value)
+		}
+	}
+	slipService := services.NewSlipService(db, slip.QRVerifier{}, files)
+	go slipService.Run(context.Background(), storageCleanupInterval)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(userService)
 	groupHandler := handlers.NewGroupHandler(groupService, userService)
-	expenseHandler := handlers.NewExpenseHandler(expenseService)
+	expenseHandler := handlers.NewExpenseHandler(expenseService, groupService, slipService)
 	friendHandler := handlers.NewFriendHandler(friendService, userService)
+	inviteHandler := handlers.NewInviteHandler(inviteService)
+	guestHandler := handlers.NewGuestHandler(guestService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+	recurringHandler := handlers.NewRecurringHandler(recurringService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	trashHandler := handlers.NewTrashHandler(trashService)
+	activityHandler := handlers.NewActivityHandler(activityService)
+	eventHandler := handlers.NewEventHandler(hub)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	paymentRequestHandler := handlers.NewPaymentRequestHandler(paymentRequestService)
+	promptPayHandler := handlers.NewPromptPayHandler(promptPayService)
+	fileHandler := handlers.NewFileHandler(localFiles)
+	authz := handlers.NewAuthorizer(groupService, expenseService)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -97,55 +308,116 @@ func main() {
 	auth.Post("/register", authHandler.Register)
 	auth.Post("/login", authHandler.Login)
 
+	// Signed downloads from local file storage
+	if localFiles != nil {
+		api.Get("/files/*", fileHandler.Download)
+	}
+
 	// Protected routes
 	api.Use(handlers.AuthMiddleware)
 
 	groups := api.Group("/groups")
 	groups.Post("/", groupHandler.CreateGroup)
 	groups.Get("/", groupHandler.GetUserGroups)
-	groups.Get("/:id", groupHandler.GetGroup)
-	groups.Get("/:id/search-users", groupHandler.SearchUsers)
-	groups.Put("/:id", groupHandler.UpdateGroup)
-	groups.Delete("/:id", groupHandler.DeleteGroup)
-	groups.Post("/:id/members", groupHandler.AddMember)
-	groups.Delete("/:id/members/:userId", groupHandler.RemoveMember)
+	groups.Post("/join/:token", inviteHandler.JoinGroup)
+	groups.Post("/guests/claim/:token", guestHandler.ClaimGuest)
+	groups.Get("/trash", trashHandler.GetDeletedGroups)
+	groups.Post("/:id/restore", trashHandler.RestoreGroup)
+	groups.Get("/:id", authz.Group("id", services.PermViewGroup), groupHandler.GetGroup)
+	groups.Get("/:id/search-users", authz.Group("id", services.PermManageMembers), groupHandler.SearchUsers)
+	groups.Put("/:id", authz.Group("id", services.PermEditGroup), groupHandler.UpdateGroup)
+	groups.Delete("/:id", authz.Group("id", services.PermDeleteGroup), groupHandler.DeleteGroup)
+	groups.Post("/:id/members", authz.Group("id", services.PermManageMembers), groupHandler.AddMember)
+	groups.Delete("/:id/members/:userId", authz.Group("id", services.PermViewGroup), groupHandler.RemoveMember)
+	groups.Put("/:id/members/:userId/role", authz.Group("id", services.PermManageRoles), groupHandler.ChangeMemberRole)
+	groups.Post("/:id/guests", authz.Group("id", services.PermManageMembers), guestHandler.AddGuest)
+	groups.Post("/:id/guests/:guestId/claim-token", authz.Group("id", services.PermManageMembers), guestHandler.CreateClaimToken)
+	groups.Post("/:id/transfer-ownership", authz.Group("id", services.PermTransferOwnership), groupHandler.TransferOwnership)
+	groups.Get("/:id/categories", authz.Group("id", services.PermViewGroup), categoryHandler.GetCategories)
+	groups.Post("/:id/categories", authz.Group("id", services.PermEditExpenses), categoryHandler.CreateCategory)
+	groups.Delete("/:id/categories/:categoryId", authz.Group("id", services.PermEditGroup), categoryHandler.DeleteCategory)
+	groups.Get("/:id/recurring", authz.Group("id", services.PermViewGroup), recurringHandler.GetGroupRecurring)
+	groups.Post("/:id/recurring", authz.Group("id", services.PermEditExpenses), recurringHandler.CreateRecurring)
+	groups.Get("/:id/recurring/:recurringId", authz.Group("id", services.PermViewGroup), recurringHandler.GetRecurring)
+	groups.Put("/:id/recurring/:recurringId", authz.Group("id", services.PermEditExpenses), recurringHandler.UpdateRecurring)
+	groups.Delete("/:id/recurring/:recurringId", authz.Group("id", services.PermEditExpenses), recurringHandler.DeleteRecurring)
+	groups.Put("/:id/recurring/:recurringId/pause", authz.Group("id", services.PermEditExpenses), recurringHandler.PauseRecurring)
+	groups.Put("/:id/recurring/:recurringId/resume", authz.Group("id", services.PermEditExpenses), recurringHandler.ResumeRecurring)
+	groups.Post("/:id/recurring/:recurringId/skip", authz.Group("id", services.PermEditExpenses), recurringHandler.SkipRecurring)
+	groups.Get("/:id/trash", authz.Group("id", services.PermViewGroup), trashHandler.GetGroupTrash)
+	groups.Post("/:id/trash/:expenseId/restore", authz.Group("id", services.PermEditExpenses), trashHandler.RestoreExpense)
+	groups.Get("/:id/events", authz.Group("id", services.PermViewGroup), eventHandler.Stream)
+	groups.Get("/:id/activity", authz.Group("id", services.PermViewGroup), activityHandler.GetFeed)
+	groups.Put("/:id/activity/seen", authz.Group("id", services.PermViewGroup), activityHandler.MarkSeen)
+	groups.Get("/:id/audit", authz.Group("id", services.PermViewGroup), auditHandler.GetGroupLog)
+	groups.Get("/:id/expenses/:expenseId/history", authz.Group("id", services.PermViewGroup), auditHandler.GetExpenseHistory)
+	groups.Get("/:id/payment-requests", authz.Group("id", services.PermViewGroup), paymentRequestHandler.GetGroupRequests)
+	groups.Post("/:id/payment-requests", authz.Group("id", services.PermConfirmPayments), paymentRequestHandler.CreateRequest)
+	groups.Delete("/:id/payment-requests/:requestId", authz.Group("id", services.PermViewGroup), paymentRequestHandler.CancelRequest)
+	groups.Post("/:id/invites", authz.Group("id", services.PermManageMembers), inviteHandler.CreateInvite)
+	groups.Get("/:id/invites", authz.Group("id", services.PermManageMembers), inviteHandler.GetGroupInvites)
+	groups.Delete("/:id/invites/:inviteId", authz.Group("id", services.PermManageMembers), inviteHandler.RevokeInvite)
+	groups.Put("/:id/join-policy", authz.Group("id", services.PermManageJoinPolicy), inviteHandler.SetJoinPolicy)
+	groups.Get("/:id/join-requests", authz.Group("id", services.PermManageMembers), inviteHandler.GetJoinRequests)
+	groups.Put("/:id/join-requests/:requestId/accept", authz.Group("id", services.PermManageMembers), inviteHandler.AcceptJoinRequest)
+	groups.Put("/:id/join-requests/:requestId/reject", authz.Group("id", services.PermManageMembers), inviteHandler.RejectJoinRequest)
 
 	// Expense routes
 	expenses := api.Group("/expenses")
 	expenses.Post("/", expenseHandler.CreateExpense)
-	expenses.Get("/group/:groupId", expenseHandler.GetGroupExpenses)
-	expenses.Get("/:id", expenseHandler.GetExpense)
-	expenses.Put("/:id", expenseHandler.UpdateExpense)
-	expenses.Delete("/:id", expenseHandler.DeleteExpense)
+	expenses.Get("/group/:groupId", authz.Group("groupId", services.PermViewGroup), expenseHandler.GetGroupExpenses)
+	expenses.Get("/:id", authz.Expense("id", services.PermViewGroup), expenseHandler.GetExpense)
+	expenses.Put("/:id", authz.Expense("id", services.PermEditExpenses), expenseHandler.UpdateExpense)
+	expenses.Delete("/:id", authz.Expense("id", services.PermEditExpenses), expenseHandler.DeleteExpense)
 
 	// Settlement routes
 	settlements := api.Group("/settlements")
-	settlements.Get("/group/:groupId", expenseHandler.GetSettlements)
+	settlements.Get("/group/:groupId", authz.Group("groupId", services.PermViewGroup), expenseHandler.GetSettlements)
+	settlements.Get("/group/:groupId/outstanding", authz.Group("groupId", services.PermViewGroup), expenseHandler.GetOutstanding)
+	settlements.Get("/group/:groupId/promptpay", authz.Group("groupId", services.PermViewGroup), promptPayHandler.GetSettlementQR)
 
 	// Payment confirmation routes
 	payments := api.Group("/payments")
 	payments.Post("/upload-slip", expenseHandler.UploadSlip)
 	payments.Post("/confirmations", expenseHandler.CreatePaymentConfirmation)
-	payments.Get("/confirmations/group/:groupId", expenseHandler.GetPaymentConfirmations)
-	payments.Put("/confirmations/:id/confirm", expenseHandler.ConfirmPayment)
+	payments.Get("/confirmations/group/:groupId", authz.Group("groupId", services.PermViewGroup), expenseHandler.GetPaymentConfirmations)
+	payments.Get("/confirmations/:id/history", authz.Payment("id", services.PermViewGroup), expenseHandler.GetPaymentHistory)
+	payments.Put("/confirmations/:id/confirm", authz.Payment("id", services.PermConfirmPayments), expenseHandler.ConfirmPayment)
+	payments.Put("/confirmations/:id/reject", authz.Payment("id", services.PermConfirmPayments), expenseHandler.RejectPayment)
+	payments.Put("/confirmations/:id/dispute", authz.Payment("id", services.PermViewGroup), expenseHandler.DisputePayment)
+	payments.Put("/confirmations/:id/resolve", authz.Payment("id", services.PermConfirmPayments), expenseHandler.ResolveDispute)
 
 	// Friend routes
 	friends := api.Group("/friends")
-	friends.Post("/", friendHandler.AddFriend)
+	friends.Post("/", friendHandler.SendFriendRequest)
 	friends.Get("/", friendHandler.GetFriends)
 	friends.Get("/search", friendHandler.SearchFriends)
+	friends.Get("/requests/incoming", friendHandler.GetIncomingRequests)
+	friends.Get("/requests/outgoing", friendHandler.GetOutgoingRequests)
+	friends.Put("/requests/:id/accept", friendHandler.AcceptFriendRequest)
+	friends.Put("/requests/:id/decline", friendHandler.DeclineFriendRequest)
+	friends.Delete("/requests/:id", friendHandler.CancelFriendRequest)
+	friends.Get("/blocked", friendHandler.GetBlockedUsers)
+	friends.Post("/blocked", friendHandler.BlockUser)
+	friends.Delete("/blocked/:id", friendHandler.UnblockUser)
 	friends.Delete("/:id", friendHandler.RemoveFriend)
 
+	// Notification routes
+	notifications := api.Group("/notifications")
+	notifications.Get("/", notificationHandler.GetNotifications)
+	notifications.Put("/read-all", notificationHandler.MarkAllRead)
+	notifications.Get("/preferences", notificationHandler.GetPreferences)
+	notifications.Put("/preferences", notificationHandler.UpdatePreferences)
+	notifications.Put("/:id/read", notificationHandler.MarkRead)
+
 	// User routes
 	users := api.Group("/users")
 	users.Get("/search", authHandler.SearchUsers)
+	users.Put("/me/locale", authHandler.SetLocale)
+	users.Get("/me/promptpay", authHandler.GetPromptPayID)
+	users.Put("/me/promptpay", authHandler.SetPromptPayID)
 
 	// Start server
-	port := os.Getenv("SERVER_PORT")
-	if port == "" {
-		port = "8080"
-	}
-
 	log.Printf("Server starting on port %s", port)
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatal("Failed to start server:", err)
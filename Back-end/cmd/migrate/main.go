@@ -0,0 +1,92 @@
+package main
+
+import (
+	"expense-splitter/internal/config"
+	"expense-splitter/internal/database"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  status        list migrations and whether they are applied
+  up            apply all pending migrations
+  down [n]      roll back the last n applied migrations (default 1)
+  to <version>  migrate up or down to the given version (0 rolls back everything)`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	config.LoadEnv()
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+
+	switch os.Args[1] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, applied)
+		}
+
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Applied %d migrations\n", count)
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("invalid number of steps %q", os.Args[2])
+			}
+		}
+		count, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Rolled back %d migrations\n", count)
+
+	case "to":
+		if len(os.Args) < 3 {
+			log.Fatal("migrate to needs a version")
+		}
+		version, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil || version < 0 {
+			log.Fatalf("invalid version %q", os.Args[2])
+		}
+		count, err := migrator.To(version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Ran %d migrations\n", count)
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+)
+
+// LoadEnv loads the first .env file found in the usual places and returns its
+// path, or "" when none was found and only the real environment is used
+func LoadEnv() string {
+	wd, _ := os.Getwd()
+
+	envPaths := []string{
+		"configs/.env",
+		".env",
+		filepath.Join(wd, "configs", ".env"),
+	}
+
+	for _, path := range envPaths {
+		if err := godotenv.Load(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
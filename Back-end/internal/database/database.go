@@ -8,7 +8,8 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func Connect() (*sql.DB, error) {
+// ConnString builds the connection string from the DB_* environment variables
+func ConnString() string {
 	host := os.Getenv("DB_HOST")
 	port := os.Getenv("DB_PORT")
 	user := os.Getenv("DB_USER")
@@ -16,12 +17,14 @@ func Connect() (*sql.DB, error) {
 	dbname := os.Getenv("DB_NAME")
 	sslmode := os.Getenv("DB_SSLMODE")
 
-	connStr := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode,
 	)
+}
 
-	db, err := sql.Open("postgres", connStr)
+func Connect() (*sql.DB, error) {
+	db, err := sql.Open("postgres", ConnString())
 	if err != nil {
 		return nil, err
 	}
@@ -32,74 +35,3 @@ func Connect() (*sql.DB, error) {
 
 	return db, nil
 }
-
-func RunMigrations(db *sql.DB) error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			name VARCHAR(255) NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS groups (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			description TEXT,
-			created_by INTEGER REFERENCES users(id),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS group_members (
-			group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
-			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (group_id, user_id)
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS expenses (
-			id SERIAL PRIMARY KEY,
-			group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
-			description TEXT NOT NULL,
-			amount DECIMAL(10, 2) NOT NULL,
-			paid_by INTEGER REFERENCES users(id),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS expense_splits (
-			id SERIAL PRIMARY KEY,
-			expense_id INTEGER REFERENCES expenses(id) ON DELETE CASCADE,
-			user_id INTEGER REFERENCES users(id),
-			amount DECIMAL(10, 2) NOT NULL
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS payment_confirmations (
-			id SERIAL PRIMARY KEY,
-			group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
-			from_user_id INTEGER REFERENCES users(id),
-			to_user_id INTEGER REFERENCES users(id),
-			amount DECIMAL(10, 2) NOT NULL,
-			slip_url VARCHAR(500),
-			confirmed_by INTEGER REFERENCES users(id),
-			confirmed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS friendships (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			friend_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, friend_id),
-			CHECK(user_id != friend_id)
-		)`,
-	}
-
-	for _, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %v", err)
-		}
-	}
-
-	return nil
-}
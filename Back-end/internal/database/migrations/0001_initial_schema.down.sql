@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS friendships;
+DROP TABLE IF EXISTS payment_confirmations;
+DROP TABLE IF EXISTS expense_splits;
+DROP TABLE IF EXISTS expenses;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,60 @@
+-- IF NOT EXISTS lets deployments created by the old startup loop adopt this
+-- migration without failing on tables they already have
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	created_by INTEGER REFERENCES users(id),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+	group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS expenses (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+	description TEXT NOT NULL,
+	amount DECIMAL(10, 2) NOT NULL,
+	paid_by INTEGER REFERENCES users(id),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS expense_splits (
+	id SERIAL PRIMARY KEY,
+	expense_id INTEGER REFERENCES expenses(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id),
+	amount DECIMAL(10, 2) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS payment_confirmations (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+	from_user_id INTEGER REFERENCES users(id),
+	to_user_id INTEGER REFERENCES users(id),
+	amount DECIMAL(10, 2) NOT NULL,
+	slip_url VARCHAR(500),
+	confirmed_by INTEGER REFERENCES users(id),
+	confirmed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS friendships (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	friend_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, friend_id),
+	CHECK(user_id != friend_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE expense_splits DROP COLUMN IF EXISTS value;
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS split_type;
@@ -0,0 +1,3 @@
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS split_type VARCHAR(20) NOT NULL DEFAULT 'equal';
+
+ALTER TABLE expense_splits ADD COLUMN IF NOT EXISTS value DECIMAL(12, 4);
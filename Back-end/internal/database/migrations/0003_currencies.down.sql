@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS exchange_rate;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS exchange_rate;
+ALTER TABLE expenses DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS base_currency;
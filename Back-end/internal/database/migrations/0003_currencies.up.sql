@@ -0,0 +1,16 @@
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'THB';
+
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18, 8) NOT NULL DEFAULT 1;
+
+ALTER TABLE payment_confirmations ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+ALTER TABLE payment_confirmations ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18, 8) NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	base_currency CHAR(3) NOT NULL,
+	quote_currency CHAR(3) NOT NULL,
+	rate DECIMAL(18, 8) NOT NULL CHECK (rate > 0),
+	rate_date DATE NOT NULL,
+	source VARCHAR(255) NOT NULL DEFAULT '',
+	PRIMARY KEY (base_currency, quote_currency, rate_date)
+);
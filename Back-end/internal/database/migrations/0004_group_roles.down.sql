@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS group_members_one_owner;
+
+ALTER TABLE group_members DROP COLUMN IF EXISTS role;
@@ -0,0 +1,10 @@
+ALTER TABLE group_members ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'member'
+	CHECK (role IN ('owner', 'admin', 'member', 'viewer'));
+
+UPDATE group_members gm
+SET role = 'owner'
+FROM groups g
+WHERE g.id = gm.group_id AND g.created_by = gm.user_id;
+
+-- Exactly one owner per group
+CREATE UNIQUE INDEX group_members_one_owner ON group_members (group_id) WHERE role = 'owner';
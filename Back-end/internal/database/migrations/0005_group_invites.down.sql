@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS group_join_requests;
+DROP TABLE IF EXISTS group_invites;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS require_join_approval;
@@ -0,0 +1,30 @@
+ALTER TABLE groups ADD COLUMN require_join_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE group_invites (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	token VARCHAR(64) UNIQUE NOT NULL,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	expires_at TIMESTAMP,
+	max_uses INTEGER CHECK (max_uses > 0),
+	use_count INTEGER NOT NULL DEFAULT 0,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX group_invites_group_id ON group_invites (group_id);
+
+CREATE TABLE group_join_requests (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	invite_id INTEGER REFERENCES group_invites(id) ON DELETE SET NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending'
+		CHECK (status IN ('pending', 'accepted', 'rejected')),
+	decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	decided_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One open request per user and group
+CREATE UNIQUE INDEX group_join_requests_one_pending ON group_join_requests (group_id, user_id) WHERE status = 'pending';
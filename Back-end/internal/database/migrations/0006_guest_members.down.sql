@@ -0,0 +1,15 @@
+DELETE FROM expense_splits WHERE user_id IN (SELECT id FROM users WHERE is_guest);
+DELETE FROM expenses WHERE paid_by IN (SELECT id FROM users WHERE is_guest);
+DELETE FROM payment_confirmations
+WHERE from_user_id IN (SELECT id FROM users WHERE is_guest)
+   OR to_user_id IN (SELECT id FROM users WHERE is_guest);
+DELETE FROM users WHERE is_guest;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_guest_or_account;
+
+ALTER TABLE users DROP COLUMN IF EXISTS guest_claim_token;
+ALTER TABLE users DROP COLUMN IF EXISTS guest_group_id;
+ALTER TABLE users DROP COLUMN IF EXISTS is_guest;
+
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
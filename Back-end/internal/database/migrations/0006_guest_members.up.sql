@@ -0,0 +1,10 @@
+-- Guests are users with a name only; they belong to the group that created them
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+
+ALTER TABLE users ADD COLUMN is_guest BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN guest_group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE;
+ALTER TABLE users ADD COLUMN guest_claim_token VARCHAR(64) UNIQUE;
+
+ALTER TABLE users ADD CONSTRAINT users_guest_or_account
+	CHECK (is_guest OR (email IS NOT NULL AND password IS NOT NULL));
@@ -0,0 +1,26 @@
+CREATE TABLE friend_requests (
+	id SERIAL PRIMARY KEY,
+	from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	responded_at TIMESTAMP,
+	CHECK (from_user_id != to_user_id),
+	CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled'))
+);
+
+-- One open request per direction
+CREATE UNIQUE INDEX friend_requests_one_pending
+	ON friend_requests (from_user_id, to_user_id) WHERE status = 'pending';
+
+CREATE INDEX idx_friend_requests_to_user ON friend_requests (to_user_id, status);
+
+CREATE TABLE user_blocks (
+	blocker_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (blocker_id, blocked_id),
+	CHECK (blocker_id != blocked_id)
+);
+
+CREATE INDEX idx_user_blocks_blocked ON user_blocks (blocked_id);
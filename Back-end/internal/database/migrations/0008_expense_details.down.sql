@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS group_categories;
+
+DROP INDEX IF EXISTS idx_expenses_group_date;
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS notes;
+ALTER TABLE expenses DROP COLUMN IF EXISTS category;
+ALTER TABLE expenses DROP COLUMN IF EXISTS expense_date;
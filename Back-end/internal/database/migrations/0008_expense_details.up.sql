@@ -0,0 +1,17 @@
+ALTER TABLE expenses ADD COLUMN expense_date DATE NOT NULL DEFAULT CURRENT_DATE;
+ALTER TABLE expenses ADD COLUMN category VARCHAR(50) NOT NULL DEFAULT 'general';
+ALTER TABLE expenses ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+
+-- Existing expenses happened when they were recorded
+UPDATE expenses SET expense_date = created_at::date WHERE created_at IS NOT NULL;
+
+CREATE INDEX idx_expenses_group_date ON expenses (group_id, expense_date);
+
+CREATE TABLE group_categories (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	name VARCHAR(50) NOT NULL,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (group_id, name)
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS expense_item_consumers;
+DROP TABLE IF EXISTS expense_items;
+
+UPDATE expenses SET split_type = 'exact' WHERE split_type = 'itemized';
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS discount;
+ALTER TABLE expenses DROP COLUMN IF EXISTS tip;
+ALTER TABLE expenses DROP COLUMN IF EXISTS tax_percent;
+ALTER TABLE expenses DROP COLUMN IF EXISTS service_charge_percent;
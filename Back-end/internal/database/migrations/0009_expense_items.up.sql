@@ -0,0 +1,21 @@
+-- Charges applied on top of the items of an itemized expense
+ALTER TABLE expenses ADD COLUMN service_charge_percent DECIMAL(7, 4) NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN tax_percent DECIMAL(7, 4) NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN tip DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN discount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE expense_items (
+	id SERIAL PRIMARY KEY,
+	expense_id INTEGER NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	amount DECIMAL(10, 2) NOT NULL CHECK (amount >= 0),
+	position INTEGER NOT NULL
+);
+
+CREATE INDEX idx_expense_items_expense ON expense_items (expense_id);
+
+CREATE TABLE expense_item_consumers (
+	item_id INTEGER NOT NULL REFERENCES expense_items(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	PRIMARY KEY (item_id, user_id)
+);
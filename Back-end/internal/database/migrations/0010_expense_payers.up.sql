@@ -0,0 +1,11 @@
+-- expenses.paid_by stays as the primary payer; expense_payers holds what
+-- every payer contributed
+CREATE TABLE expense_payers (
+	expense_id INTEGER NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+	PRIMARY KEY (expense_id, user_id)
+);
+
+INSERT INTO expense_payers (expense_id, user_id, amount)
+SELECT id, paid_by, amount FROM expenses WHERE paid_by IS NOT NULL AND amount > 0;
@@ -0,0 +1,32 @@
+CREATE TABLE recurring_expenses (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	template JSONB NOT NULL,
+	frequency VARCHAR(20) NOT NULL,
+	repeat_interval INTEGER NOT NULL DEFAULT 1 CHECK (repeat_interval > 0),
+	rule VARCHAR(100) NOT NULL DEFAULT '',
+	start_date DATE NOT NULL,
+	end_date DATE,
+	max_occurrences INTEGER CHECK (max_occurrences > 0),
+	occurrences INTEGER NOT NULL DEFAULT 0,
+	-- NULL once the series has ended
+	next_date DATE,
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (frequency IN ('daily', 'weekly', 'monthly', 'yearly', 'custom'))
+);
+
+CREATE INDEX idx_recurring_expenses_due ON recurring_expenses (next_date) WHERE NOT paused;
+
+-- One row per occurrence that was posted or skipped, so a restart or a second
+-- instance can never post the same occurrence twice
+CREATE TABLE recurring_expense_runs (
+	recurring_id INTEGER NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+	occurrence_date DATE NOT NULL,
+	expense_id INTEGER REFERENCES expenses(id) ON DELETE SET NULL,
+	skipped BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (recurring_id, occurrence_date)
+);
@@ -0,0 +1,28 @@
+-- Append-only record of every change to expenses, members and payment
+-- confirmations. There are no foreign keys so entries outlive the rows they
+-- describe, and a trigger rejects any attempt to change or remove them.
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL,
+	-- NULL for changes made by the system, such as recurring expenses
+	actor_id INTEGER,
+	entity_type VARCHAR(20) NOT NULL,
+	entity_id INTEGER NOT NULL,
+	action VARCHAR(20) NOT NULL,
+	before JSONB,
+	after JSONB,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_group ON audit_log (group_id, id);
+CREATE INDEX idx_audit_log_entity ON audit_log (entity_type, entity_id, id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+	BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
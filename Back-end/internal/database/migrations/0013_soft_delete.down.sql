@@ -0,0 +1,14 @@
+-- Anything still in the trash is deleted for good rather than restored
+DELETE FROM expenses WHERE deleted_at IS NOT NULL;
+DELETE FROM groups WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_groups_deleted;
+DROP INDEX IF EXISTS idx_expenses_deleted;
+
+ALTER TABLE groups
+	DROP COLUMN IF EXISTS deleted_by,
+	DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE expenses
+	DROP COLUMN IF EXISTS deleted_by,
+	DROP COLUMN IF EXISTS deleted_at;
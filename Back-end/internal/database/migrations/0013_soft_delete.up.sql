@@ -0,0 +1,12 @@
+-- Deleted expenses and groups stay in the trash until the purge job removes
+-- them once the retention period has passed
+ALTER TABLE expenses
+	ADD COLUMN deleted_at TIMESTAMP,
+	ADD COLUMN deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE groups
+	ADD COLUMN deleted_at TIMESTAMP,
+	ADD COLUMN deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_expenses_deleted ON expenses (group_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_groups_deleted ON groups (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- How far into a group's activity feed (audit_log ids) each member has read
+CREATE TABLE group_activity_seen (
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	last_seen_id BIGINT NOT NULL DEFAULT 0,
+	seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, user_id)
+);
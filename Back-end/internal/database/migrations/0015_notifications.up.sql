@@ -0,0 +1,23 @@
+-- Each user's inbox of things other people did that involve them
+CREATE TABLE notifications (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(50) NOT NULL,
+	actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+	entity_id INTEGER NOT NULL,
+	data JSONB,
+	read_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_user ON notifications(user_id, id);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- Types a user has opted out of or back into. Types without a row are on.
+CREATE TABLE notification_preferences (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(50) NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_outbox;
+ALTER TABLE users DROP COLUMN IF EXISTS last_summary_at;
+ALTER TABLE users DROP COLUMN IF EXISTS locale;
@@ -0,0 +1,25 @@
+-- Language of the mail a user receives, and when their last weekly
+-- summary was sent
+ALTER TABLE users ADD COLUMN locale VARCHAR(10) NOT NULL DEFAULT 'en';
+ALTER TABLE users ADD COLUMN last_summary_at TIMESTAMP;
+
+-- Rendered mail waiting to be sent. Rows are written in the same
+-- transaction as the change they report and delivered by a background
+-- worker, which retries with backoff until max attempts.
+CREATE TABLE email_outbox (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	to_address VARCHAR(255) NOT NULL,
+	template VARCHAR(50) NOT NULL,
+	subject TEXT NOT NULL,
+	text_body TEXT NOT NULL,
+	html_body TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,23 @@
+-- A creditor asking a debtor to pay a suggested settlement by a due date.
+-- Reminders are sent at fixed offsets from the due date; reminders_sent is
+-- how many of those offsets have been handled.
+CREATE TABLE payment_requests (
+	id SERIAL PRIMARY KEY,
+	group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+	currency CHAR(3) NOT NULL,
+	due_date DATE NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'paid', 'cancelled')),
+	payment_confirmation_id INTEGER REFERENCES payment_confirmations(id) ON DELETE SET NULL,
+	reminders_sent INTEGER NOT NULL DEFAULT 0,
+	last_reminded_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	closed_at TIMESTAMP
+);
+
+-- One open request per debt
+CREATE UNIQUE INDEX idx_payment_requests_open
+	ON payment_requests(group_id, from_user_id, to_user_id, currency) WHERE status = 'open';
+CREATE INDEX idx_payment_requests_due ON payment_requests(due_date) WHERE status = 'open';
@@ -0,0 +1,3 @@
+-- PromptPay ID (phone, national ID or e-wallet digits) that members pay the
+-- user back to
+ALTER TABLE users ADD COLUMN promptpay_id VARCHAR(15);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payment_confirmations_slip_trans_ref;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS slip_data;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS slip_trans_ref;
+DROP TABLE IF EXISTS payment_slips;
@@ -0,0 +1,18 @@
+-- Slips users have uploaded, with the data read from their QR code. A
+-- payment confirmation made with a slip copies its data.
+CREATE TABLE payment_slips (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	slip_url VARCHAR(500) NOT NULL,
+	trans_ref VARCHAR(50) NOT NULL,
+	data JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_slips_url ON payment_slips(slip_url);
+
+ALTER TABLE payment_confirmations ADD COLUMN slip_trans_ref VARCHAR(50);
+ALTER TABLE payment_confirmations ADD COLUMN slip_data JSONB;
+
+-- A transfer can only pay for one confirmation
+CREATE UNIQUE INDEX idx_payment_confirmations_slip_trans_ref ON payment_confirmations(slip_trans_ref);
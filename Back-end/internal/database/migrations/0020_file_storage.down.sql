@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS payment_slips_queue_deletion ON payment_slips;
+DROP FUNCTION IF EXISTS payment_slips_queue_deletion();
+DROP TABLE IF EXISTS storage_deletions;
+DROP INDEX IF EXISTS idx_payment_slips_confirmation;
+ALTER TABLE payment_slips DROP COLUMN IF EXISTS payment_confirmation_id;
+ALTER TABLE payment_slips DROP COLUMN IF EXISTS storage_key;
@@ -0,0 +1,34 @@
+-- Where each slip is kept in file storage, and the payment confirmation it
+-- was used for. Slips are removed with their confirmation.
+ALTER TABLE payment_slips ADD COLUMN storage_key VARCHAR(500);
+ALTER TABLE payment_slips ADD COLUMN payment_confirmation_id INTEGER REFERENCES payment_confirmations(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_payment_slips_confirmation ON payment_slips(payment_confirmation_id);
+
+UPDATE payment_slips ps
+SET payment_confirmation_id = pc.id
+FROM payment_confirmations pc
+WHERE pc.slip_trans_ref = ps.trans_ref AND pc.slip_url = ps.slip_url;
+
+-- Files whose owning record is gone, waiting to be removed from storage.
+-- Rows are queued by triggers so cascading deletes are covered too.
+CREATE TABLE storage_deletions (
+	id BIGSERIAL PRIMARY KEY,
+	storage_key VARCHAR(500) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE FUNCTION payment_slips_queue_deletion() RETURNS trigger AS $$
+BEGIN
+	IF OLD.storage_key IS NOT NULL THEN
+		INSERT INTO storage_deletions (storage_key) VALUES (OLD.storage_key);
+	END IF;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER payment_slips_queue_deletion
+	AFTER DELETE ON payment_slips
+	FOR EACH ROW EXECUTE FUNCTION payment_slips_queue_deletion();
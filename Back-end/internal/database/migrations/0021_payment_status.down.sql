@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_payment_confirmations_slip_trans_ref;
+CREATE UNIQUE INDEX idx_payment_confirmations_slip_trans_ref ON payment_confirmations(slip_trans_ref);
+DROP TABLE IF EXISTS payment_confirmation_transitions;
+UPDATE payment_confirmations SET confirmed_at = created_at WHERE confirmed_at IS NULL;
+ALTER TABLE payment_confirmations ALTER COLUMN confirmed_at SET DEFAULT CURRENT_TIMESTAMP;
+-- Rejected and disputed payments become unconfirmed
+UPDATE payment_confirmations SET confirmed_by = NULL WHERE status <> 'confirmed';
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS created_at;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS status;
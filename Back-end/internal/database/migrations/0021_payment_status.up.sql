@@ -0,0 +1,42 @@
+-- Payment confirmations start pending and are confirmed or rejected by the
+-- recipient or a group admin. A confirmed payment can be disputed, and the
+-- dispute is resolved by confirming or rejecting it again. Only confirmed
+-- payments count towards balances.
+ALTER TABLE payment_confirmations ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending'
+	CHECK (status IN ('pending', 'confirmed', 'rejected', 'disputed'));
+-- Why the payment was last rejected, disputed or resolved
+ALTER TABLE payment_confirmations ADD COLUMN status_reason TEXT;
+ALTER TABLE payment_confirmations ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- confirmed_at used to be filled in on insert, so it is the best record of
+-- when existing payments were made
+UPDATE payment_confirmations SET created_at = COALESCE(confirmed_at, CURRENT_TIMESTAMP);
+UPDATE payment_confirmations SET status = 'confirmed' WHERE confirmed_by IS NOT NULL;
+UPDATE payment_confirmations SET confirmed_at = NULL WHERE confirmed_by IS NULL;
+ALTER TABLE payment_confirmations ALTER COLUMN confirmed_at DROP DEFAULT;
+
+-- Every status change of a payment confirmation, starting with its creation
+CREATE TABLE payment_confirmation_transitions (
+	id BIGSERIAL PRIMARY KEY,
+	payment_confirmation_id INTEGER NOT NULL REFERENCES payment_confirmations(id) ON DELETE CASCADE,
+	action VARCHAR(20) NOT NULL,
+	-- NULL for the creation of the payment
+	from_status VARCHAR(20),
+	to_status VARCHAR(20) NOT NULL,
+	actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	reason TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_confirmation_transitions ON payment_confirmation_transitions(payment_confirmation_id, id);
+
+INSERT INTO payment_confirmation_transitions (payment_confirmation_id, action, to_status, actor_id, created_at)
+SELECT id, 'create', 'pending', from_user_id, created_at FROM payment_confirmations;
+
+INSERT INTO payment_confirmation_transitions (payment_confirmation_id, action, from_status, to_status, actor_id, created_at)
+SELECT id, 'confirm', 'pending', 'confirmed', confirmed_by, confirmed_at FROM payment_confirmations WHERE status = 'confirmed';
+
+-- A rejected payment gives its slip back, so it can be submitted again
+DROP INDEX idx_payment_confirmations_slip_trans_ref;
+CREATE UNIQUE INDEX idx_payment_confirmations_slip_trans_ref
+	ON payment_confirmations(slip_trans_ref) WHERE status <> 'rejected';
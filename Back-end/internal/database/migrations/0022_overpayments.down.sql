@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_payment_confirmations_pair;
+ALTER TABLE payment_confirmations DROP COLUMN IF EXISTS overpayment;
@@ -0,0 +1,6 @@
+-- How much more than was outstanding to the recipient a payment was for.
+-- Payers have to ask for an over-payment to be recorded.
+ALTER TABLE payment_confirmations ADD COLUMN overpayment DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (overpayment >= 0);
+
+-- For adding up the payments between two people
+CREATE INDEX idx_payment_confirmations_pair ON payment_confirmations(group_id, from_user_id, to_user_id);
@@ -0,0 +1,5 @@
+-- An occurrence that fails for a reason worth retrying, such as a lost
+-- connection, puts its series off until retry_at so it does not hold up the
+-- series due after it. attempts counts the failures in a row.
+ALTER TABLE recurring_expenses ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recurring_expenses ADD COLUMN retry_at TIMESTAMP;
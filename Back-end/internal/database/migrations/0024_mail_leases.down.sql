@@ -0,0 +1,6 @@
+UPDATE email_outbox SET status = 'pending' WHERE status = 'sending';
+DROP INDEX IF EXISTS idx_email_outbox_due;
+CREATE INDEX idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status = 'pending';
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+	CHECK (status IN ('pending', 'sent', 'failed'));
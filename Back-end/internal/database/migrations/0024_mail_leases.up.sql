@@ -0,0 +1,9 @@
+-- Messages are claimed by marking them sending, with next_attempt_at as the
+-- end of the lease, and committed before they are sent. A message whose lease
+-- runs out, because the sender stopped, is claimed again.
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+	CHECK (status IN ('pending', 'sending', 'sent', 'failed'));
+
+DROP INDEX IF EXISTS idx_email_outbox_due;
+CREATE INDEX idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status IN ('pending', 'sending');
@@ -0,0 +1 @@
+-- The removed blocks are not restored
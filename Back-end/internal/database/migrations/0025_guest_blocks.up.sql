@@ -0,0 +1,2 @@
+-- Guests cannot be blocked; drop any blocks made before that was checked
+DELETE FROM user_blocks WHERE blocked_id IN (SELECT id FROM users WHERE is_guest);
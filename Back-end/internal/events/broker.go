@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MemoryBroker delivers events within a single process
+type MemoryBroker struct {
+	mu        sync.RWMutex
+	listeners map[int]func(Event)
+	nextID    int
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{listeners: make(map[int]func(Event))}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, deliver := range b.listeners {
+		deliver(e)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Listen(ctx context.Context, deliver func(Event)) error {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.listeners[id] = deliver
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.listeners, id)
+	b.mu.Unlock()
+	return nil
+}
+
+// notifyPayloadLimit is Postgres's NOTIFY payload limit, less some headroom
+const notifyPayloadLimit = 7900
+
+// PostgresBroker shares events between instances that use the same database
+// through LISTEN/NOTIFY
+type PostgresBroker struct {
+	db      *sql.DB
+	connStr string
+	channel string
+}
+
+// NewPostgresBroker publishes through db and listens on a dedicated
+// connection opened with connStr
+func NewPostgresBroker(db *sql.DB, connStr, channel string) *PostgresBroker {
+	return &PostgresBroker{db: db, connStr: connStr, channel: channel}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) > notifyPayloadLimit {
+		e.Data = nil
+		if payload, err = json.Marshal(e); err != nil {
+			return err
+		}
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *PostgresBroker) Listen(ctx context.Context, deliver func(Event)) error {
+	listener := pq.NewListener(b.connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Events: listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(b.channel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", b.channel, err)
+	}
+
+	// Pinging notices a dead connection even when no events are sent
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established;
+			// anything sent in between is lost and clients catch up on refetch
+			if n == nil {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Printf("Events: ignoring malformed event: %v", err)
+				continue
+			}
+			deliver(e)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
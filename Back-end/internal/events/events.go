@@ -0,0 +1,73 @@
+// Package events pushes group changes to connected clients. Services publish
+// an Event after committing a change; the Hub fans it out to the group's
+// subscribers. Events travel through a Broker first, so with a shared broker
+// every instance of the server sees every event.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event types
+const (
+	ExpenseCreated   = "expense.created"
+	ExpenseUpdated   = "expense.updated"
+	ExpenseDeleted   = "expense.deleted"
+	ExpenseRestored  = "expense.restored"
+	PaymentCreated   = "payment.created"
+	PaymentConfirmed = "payment.confirmed"
+	PaymentRejected  = "payment.rejected"
+	PaymentDisputed  = "payment.disputed"
+	PaymentResolved  = "payment.resolved"
+	MemberAdded      = "member.added"
+	MemberRemoved    = "member.removed"
+	MemberUpdated    = "member.updated"
+	GroupUpdated     = "group.updated"
+	GroupDeleted     = "group.deleted"
+	GroupRestored    = "group.restored"
+)
+
+// Event is a change to a group. Data carries the changed entity when it is
+// small enough to send; clients should refetch when it is missing.
+type Event struct {
+	Type     string          `json:"type"`
+	GroupID  int             `json:"group_id"`
+	EntityID int             `json:"entity_id"`          // Expense, payment confirmation or user ID
+	ActorID  int             `json:"actor_id,omitempty"` // Unset for changes made by the system
+	Data     json.RawMessage `json:"data,omitempty"`
+	Time     time.Time       `json:"time"`
+}
+
+// New builds an event, encoding data if it is not nil
+func New(eventType string, groupID, entityID, actorID int, data any) Event {
+	e := Event{
+		Type:     eventType,
+		GroupID:  groupID,
+		EntityID: entityID,
+		ActorID:  actorID,
+		Time:     time.Now().UTC(),
+	}
+	if data != nil {
+		// Data is a convenience, so an entity that cannot be encoded is
+		// left for the client to fetch
+		if encoded, err := json.Marshal(data); err == nil {
+			e.Data = encoded
+		}
+	}
+	return e
+}
+
+// Publisher is what services use to announce changes
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Broker carries events between server instances. Publish sends an event to
+// every instance's Listen, including the publisher's own.
+type Broker interface {
+	Publish(ctx context.Context, e Event) error
+	// Listen calls deliver for each event until ctx is cancelled
+	Listen(ctx context.Context, deliver func(Event)) error
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped. A dropped client reconnects and refetches.
+const subscriberBuffer = 32
+
+const publishTimeout = 5 * time.Second
+
+// Hub fans events out to the subscribers of each group in this process
+type Hub struct {
+	broker Broker
+
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{}
+}
+
+func NewHub(broker Broker) *Hub {
+	return &Hub{
+		broker:      broker,
+		subscribers: make(map[int]map[chan Event]struct{}),
+	}
+}
+
+// Publish hands e to the broker. Failures are logged rather than returned:
+// the change is already committed, and clients catch up when they refetch.
+func (h *Hub) Publish(e Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := h.broker.Publish(ctx, e); err != nil {
+		log.Printf("Events: failed to publish %s for group %d: %v", e.Type, e.GroupID, err)
+	}
+}
+
+// Run delivers events from the broker to subscribers until ctx is cancelled
+func (h *Hub) Run(ctx context.Context) error {
+	return h.broker.Listen(ctx, h.dispatch)
+}
+
+// Subscribe returns a channel of the group's events and a function that
+// stops the subscription. The channel is closed when the subscription stops,
+// including when the subscriber falls too far behind.
+func (h *Hub) Subscribe(groupID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[groupID] == nil {
+		h.subscribers[groupID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[groupID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(groupID, ch)
+	}
+}
+
+func (h *Hub) dispatch(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[e.GroupID] {
+		select {
+		case ch <- e:
+		default:
+			h.remove(e.GroupID, ch)
+		}
+	}
+}
+
+// remove closes ch if it is still subscribed. h.mu must be held.
+func (h *Hub) remove(groupID int, ch chan Event) {
+	subs := h.subscribers[groupID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, groupID)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ActivityHandler struct {
+	activityService *services.ActivityService
+}
+
+func NewActivityHandler(activityService *services.ActivityService) *ActivityHandler {
+	return &ActivityHandler{activityService: activityService}
+}
+
+// GetFeed lists the group's activity, newest first. Pass the response's
+// next_cursor as ?cursor= to get older items.
+func (h *ActivityHandler) GetFeed(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	limit, err := parseIntQuery(c, "limit")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	feed, err := h.activityService.GetFeed(groupID, userID, c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		return accessError(c, err)
+	}
+
+	return c.JSON(feed)
+}
+
+func (h *ActivityHandler) MarkSeen(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	// The body is optional; without one everything so far is marked seen
+	var req models.MarkActivitySeenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	lastSeen, err := h.activityService.MarkSeen(groupID, userID, req.ActivityID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"last_seen_id": lastSeen,
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// GetGroupLog lists the group's audit entries. ?before=<id> returns the
+// page after the entry with that ID.
+func (h *AuditHandler) GetGroupLog(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	filter.EntityType = c.Query("entity_type")
+	if filter.EntityID, err = parseIntQuery(c, "entity_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	entries, err := h.auditService.GetGroupLog(groupID, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(entries)
+}
+
+// GetExpenseHistory lists every change to one expense, including after it
+// has been deleted
+func (h *AuditHandler) GetExpenseHistory(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	expenseID, err := strconv.Atoi(c.Params("expenseId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid expense ID",
+		})
+	}
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	entries, err := h.auditService.GetExpenseHistory(groupID, expenseID, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(entries)
+}
+
+func parseAuditFilter(c *fiber.Ctx) (models.AuditFilter, error) {
+	var filter models.AuditFilter
+	var err error
+
+	if filter.ActorID, err = parseIntQuery(c, "actor_id"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntQuery(c, "limit"); err != nil {
+		return filter, err
+	}
+	if before := c.Query("before"); before != "" {
+		if filter.Before, err = strconv.ParseInt(before, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid before")
+		}
+	}
+
+	return filter, nil
+}
+
+func parseIntQuery(c *fiber.Ctx, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
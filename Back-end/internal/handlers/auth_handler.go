@@ -4,6 +4,7 @@ import (
 	"errors"
 	"expense-splitter/internal/models"
 	"expense-splitter/internal/services"
+	"expense-splitter/pkg/promptpay"
 	"expense-splitter/pkg/utils"
 	"os"
 	"strconv"
@@ -132,6 +133,13 @@ func generateToken(userID int) (string, error) {
 
 func AuthMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
+
+	// Browsers cannot set headers on an EventSource, so event streams may
+	// pass the token in the query string instead
+	if authHeader == "" && c.Get("Accept") == "text/event-stream" && c.Query("access_token") != "" {
+		authHeader = "Bearer " + c.Query("access_token")
+	}
+
 	if authHeader == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Missing authorization header",
@@ -168,6 +176,74 @@ func AuthMiddleware(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// SetLocale sets the language of the caller's mail
+func (h *AuthHandler) SetLocale(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var req models.SetLocaleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.userService.SetLocale(userID, req.Locale); err != nil {
+		if errors.Is(err, services.ErrUnsupportedLocale) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"locale": req.Locale,
+	})
+}
+
+// GetPromptPayID returns the PromptPay ID the caller is paid back to
+func (h *AuthHandler) GetPromptPayID(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	profile, err := h.userService.GetPromptPayID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(profile)
+}
+
+// SetPromptPayID sets the PromptPay ID settlement QR codes pay the caller
+// to. An empty ID removes it.
+func (h *AuthHandler) SetPromptPayID(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var req models.SetPromptPayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	profile, err := h.userService.SetPromptPayID(userID, req.PromptPayID)
+	if err != nil {
+		if errors.Is(err, promptpay.ErrInvalidID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(profile)
+}
+
 func (h *AuthHandler) SearchUsers(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(int)
 	query := c.Query("q")
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authorizer provides route middleware that only lets group members whose
+// role grants a permission through. Each middleware resolves the group from
+// the route, checks it with GroupService.RequirePermission and stores the
+// group ID in c.Locals("groupID").
+type Authorizer struct {
+	groupService   *services.GroupService
+	expenseService *services.ExpenseService
+}
+
+func NewAuthorizer(groupService *services.GroupService, expenseService *services.ExpenseService) *Authorizer {
+	return &Authorizer{
+		groupService:   groupService,
+		expenseService: expenseService,
+	}
+}
+
+// Group authorizes routes that carry the group ID in param
+func (a *Authorizer) Group(param string, perm services.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		groupID, err := strconv.Atoi(c.Params(param))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid group ID",
+			})
+		}
+
+		return a.require(c, groupID, perm)
+	}
+}
+
+// Expense authorizes routes that carry an expense ID in param
+func (a *Authorizer) Expense(param string, perm services.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		expenseID, err := strconv.Atoi(c.Params(param))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid expense ID",
+			})
+		}
+
+		groupID, err := a.expenseService.GetExpenseGroupID(expenseID)
+		if err != nil {
+			return accessError(c, err)
+		}
+
+		return a.require(c, groupID, perm)
+	}
+}
+
+// Payment authorizes routes that carry a payment confirmation ID in param
+func (a *Authorizer) Payment(param string, perm services.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		confirmationID, err := strconv.Atoi(c.Params(param))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid confirmation ID",
+			})
+		}
+
+		groupID, err := a.expenseService.GetPaymentConfirmationGroupID(confirmationID)
+		if err != nil {
+			return accessError(c, err)
+		}
+
+		return a.require(c, groupID, perm)
+	}
+}
+
+func (a *Authorizer) require(c *fiber.Ctx, groupID int, perm services.Permission) error {
+	userID := c.Locals("userID").(int)
+
+	if err := a.groupService.RequirePermission(groupID, userID, perm); err != nil {
+		return accessError(c, err)
+	}
+
+	c.Locals("groupID", groupID)
+	return c.Next()
+}
+
+// accessError turns the authorization errors from the services into 404 for
+// things that do not exist and 403 for things the caller may not touch
+func accessError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	case errors.Is(err, services.ErrExpenseNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Expense not found",
+		})
+	case errors.Is(err, services.ErrPaymentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Payment confirmation not found",
+		})
+	case errors.Is(err, services.ErrNotGroupMember):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not a member of this group",
+		})
+	case errors.Is(err, services.ErrPermissionDenied):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrNotParticipant), errors.Is(err, services.ErrInvalidRole):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrOwnerRoleChange):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
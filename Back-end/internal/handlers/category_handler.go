@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CategoryHandler struct {
+	categoryService *services.CategoryService
+}
+
+func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{categoryService: categoryService}
+}
+
+func (h *CategoryHandler) GetCategories(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	categories, err := h.categoryService.GetCategories(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(categories)
+}
+
+func (h *CategoryHandler) CreateCategory(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	var req models.CreateCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	category, err := h.categoryService.CreateCategory(groupID, userID, req.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCategory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrCategoryExists) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+func (h *CategoryHandler) DeleteCategory(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	userID := c.Locals("userID").(int)
+	categoryID, err := strconv.Atoi(c.Params("categoryId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category ID",
+		})
+	}
+
+	if err := h.categoryService.DeleteCategory(groupID, categoryID, userID); err != nil {
+		if errors.Is(err, services.ErrCategoryNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Category deleted successfully",
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"expense-splitter/internal/events"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keepAliveInterval keeps idle streams open through proxies that drop quiet
+// connections
+const keepAliveInterval = 25 * time.Second
+
+type EventHandler struct {
+	hub *events.Hub
+}
+
+func NewEventHandler(hub *events.Hub) *EventHandler {
+	return &EventHandler{hub: hub}
+}
+
+// Stream sends the group's events as Server-Sent Events until the client
+// disconnects. Each message's event name is the event type and its data the
+// JSON-encoded events.Event.
+func (h *EventHandler) Stream(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	stream, unsubscribe := h.hub.Subscribe(groupID)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case e, ok := <-stream:
+				// Closed when the client fell behind; it reconnects and refetches
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+
+				// Stop streaming to someone who is no longer in the group
+				if (e.Type == events.MemberRemoved && e.EntityID == userID) || e.Type == events.GroupDeleted {
+					w.Flush()
+					return
+				}
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+
+			// A failed flush means the client has gone
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
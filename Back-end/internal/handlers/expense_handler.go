@@ -1,27 +1,36 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"expense-splitter/internal/models"
 	"expense-splitter/internal/services"
+	"expense-splitter/internal/slip"
+	"expense-splitter/pkg/money"
 	"fmt"
-	"os"
+	"slices"
 	"strconv"
+	"time"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/gofiber/fiber/v2"
 )
 
 type ExpenseHandler struct {
 	expenseService *services.ExpenseService
+	groupService   *services.GroupService
+	slipService    *services.SlipService
 }
 
-func NewExpenseHandler(expenseService *services.ExpenseService) *ExpenseHandler {
-	return &ExpenseHandler{expenseService: expenseService}
+func NewExpenseHandler(expenseService *services.ExpenseService, groupService *services.GroupService, slipService *services.SlipService) *ExpenseHandler {
+	return &ExpenseHandler{
+		expenseService: expenseService,
+		groupService:   groupService,
+		slipService:    slipService,
+	}
 }
 
 func (h *ExpenseHandler) CreateExpense(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
 	var req models.CreateExpenseRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -29,42 +38,93 @@ func (h *ExpenseHandler) CreateExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Description == "" || req.Amount <= 0 || len(req.SplitWith) == 0 {
+	if msg := validateExpenseRequest(req); msg != "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Description, amount, and split_with are required",
+			"error": msg,
 		})
 	}
 
-	// Check if user is member of the group
-	isMember := false
-	for _, id := range req.SplitWith {
-		if id == req.PaidBy {
-			isMember = true
-			break
-		}
+	// Check if user may add expenses to the group
+	if err := h.groupService.RequirePermission(req.GroupID, userID, services.PermEditExpenses); err != nil {
+		return accessError(c, err)
 	}
-	if !isMember {
+
+	// Check if the payer is in the split list. When several people paid,
+	// some of them may have paid for others without sharing the expense.
+	if len(req.Payers) == 0 && !slices.Contains(splitParticipants(req), req.PaidBy) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "You must be in the split list",
 		})
 	}
 
-	expense, err := h.expenseService.CreateExpense(
-		req.GroupID,
-		req.Description,
-		req.Amount,
-		req.PaidBy,
-		req.SplitWith,
-	)
+	if req.Currency != "" {
+		currency, err := money.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		req.Currency = currency
+	}
+
+	expense, err := h.expenseService.CreateExpense(req, userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if isExpenseInputError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return accessError(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(expense)
 }
 
+// isExpenseInputError reports whether err was caused by invalid expense input
+func isExpenseInputError(err error) bool {
+	return errors.Is(err, services.ErrInvalidSplit) ||
+		errors.Is(err, services.ErrExchangeRateNotFound) ||
+		errors.Is(err, money.ErrInvalidRate) ||
+		errors.Is(err, services.ErrInvalidExpenseDate) ||
+		errors.Is(err, services.ErrInvalidCategory)
+}
+
+// validateExpenseRequest returns a message describing what is missing from
+// req, or "" if it is complete
+func validateExpenseRequest(req models.CreateExpenseRequest) string {
+	if req.SplitType == models.SplitItemized {
+		if req.Description == "" || req.Amount < 0 || len(req.Items) == 0 {
+			return "Description and items are required"
+		}
+		return ""
+	}
+	if req.Description == "" || req.Amount <= 0 || (len(req.SplitWith) == 0 && len(req.SplitValues) == 0) {
+		return "Description, amount, and split_with or split_values are required"
+	}
+	return ""
+}
+
+// splitParticipants returns the user IDs an expense is split between
+func splitParticipants(req models.CreateExpenseRequest) []int {
+	if req.SplitType == "" || req.SplitType == models.SplitEqual {
+		return req.SplitWith
+	}
+
+	if req.SplitType == models.SplitItemized {
+		ids := []int{}
+		for _, item := range req.Items {
+			ids = append(ids, item.Consumers...)
+		}
+		return ids
+	}
+
+	ids := make([]int, 0, len(req.SplitValues))
+	for _, v := range req.SplitValues {
+		ids = append(ids, v.UserID)
+	}
+	return ids
+}
+
 func (h *ExpenseHandler) GetGroupExpenses(c *fiber.Ctx) error {
 	groupID, err := strconv.Atoi(c.Params("groupId"))
 	if err != nil {
@@ -73,7 +133,14 @@ func (h *ExpenseHandler) GetGroupExpenses(c *fiber.Ctx) error {
 		})
 	}
 
-	expenses, err := h.expenseService.GetGroupExpenses(groupID)
+	filter, err := parseExpenseFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	expenses, err := h.expenseService.GetGroupExpenses(groupID, filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -83,6 +150,45 @@ func (h *ExpenseHandler) GetGroupExpenses(c *fiber.Ctx) error {
 	return c.JSON(expenses)
 }
 
+// parseExpenseFilter reads the category, paid_by, from, to and q query
+// parameters. Dates are YYYY-MM-DD and inclusive.
+func parseExpenseFilter(c *fiber.Ctx) (models.ExpenseFilter, error) {
+	filter := models.ExpenseFilter{
+		Category: c.Query("category"),
+		Search:   c.Query("q"),
+	}
+
+	if paidBy := c.Query("paid_by"); paidBy != "" {
+		id, err := strconv.Atoi(paidBy)
+		if err != nil {
+			return filter, fmt.Errorf("invalid paid_by")
+		}
+		filter.PaidBy = id
+	}
+
+	var err error
+	if filter.From, err = parseDateQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDateQuery(c, "to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func parseDateQuery(c *fiber.Ctx, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a YYYY-MM-DD date", name)
+	}
+	return &date, nil
+}
+
 func (h *ExpenseHandler) GetExpense(c *fiber.Ctx) error {
 	expenseID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -93,15 +199,14 @@ func (h *ExpenseHandler) GetExpense(c *fiber.Ctx) error {
 
 	expense, err := h.expenseService.GetExpense(expenseID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Expense not found",
-		})
+		return accessError(c, err)
 	}
 
 	return c.JSON(expense)
 }
 
 func (h *ExpenseHandler) UpdateExpense(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
 	expenseID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -116,23 +221,37 @@ func (h *ExpenseHandler) UpdateExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	expense, err := h.expenseService.UpdateExpense(
-		expenseID,
-		req.Description,
-		req.Amount,
-		req.PaidBy,
-		req.SplitWith,
-	)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
+	if msg := validateExpenseRequest(req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
 		})
 	}
 
+	if req.Currency != "" {
+		currency, err := money.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		req.Currency = currency
+	}
+
+	expense, err := h.expenseService.UpdateExpense(expenseID, req, userID)
+	if err != nil {
+		if isExpenseInputError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return accessError(c, err)
+	}
+
 	return c.JSON(expense)
 }
 
 func (h *ExpenseHandler) DeleteExpense(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
 	expenseID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -140,10 +259,8 @@ func (h *ExpenseHandler) DeleteExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.expenseService.DeleteExpense(expenseID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := h.expenseService.DeleteExpense(expenseID, userID); err != nil {
+		return accessError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -159,6 +276,27 @@ func (h *ExpenseHandler) GetSettlements(c *fiber.Ctx) error {
 		})
 	}
 
+	// ?mode=per_currency settles each currency separately instead of
+	// converting everything to the group's base currency
+	if c.Query("mode") == "per_currency" {
+		currencies, err := h.expenseService.CalculateSettlementsPerCurrency(groupID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		if err := h.expenseService.PairBalancesPerCurrency(groupID, currencies); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"currencies": currencies,
+		})
+	}
+
 	settlements, balances, err := h.expenseService.CalculateSettlements(groupID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -166,12 +304,65 @@ func (h *ExpenseHandler) GetSettlements(c *fiber.Ctx) error {
 		})
 	}
 
+	pairs, err := h.expenseService.PairBalances(groupID, settlements)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"settlements": settlements,
 		"balances":    balances,
+		"pairs":       pairs,
 	})
 }
 
+// GetOutstanding tells a payer how much is left to pay ?to once their
+// pending payments are confirmed. ?from defaults to the caller and
+// ?currency to the group's base currency.
+func (h *ExpenseHandler) GetOutstanding(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	fromUserID, err := parseIntQuery(c, "from")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if fromUserID == 0 {
+		fromUserID = userID
+	}
+	toUserID, err := parseIntQuery(c, "to")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if toUserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "To user ID is required",
+		})
+	}
+
+	currency := c.Query("currency")
+	if currency != "" {
+		if currency, err = money.NormalizeCurrency(currency); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	balance, err := h.expenseService.GetOutstanding(groupID, fromUserID, toUserID, currency)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	return c.JSON(balance)
+}
+
 func (h *ExpenseHandler) UploadSlip(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(int)
 
@@ -199,34 +390,14 @@ func (h *ExpenseHandler) UploadSlip(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
-	// Upload to Cloudinary
-	cld, err := cloudinary.NewFromParams(
-		os.Getenv("CLOUDINARY_CLOUD_NAME"),
-		os.Getenv("CLOUDINARY_API_KEY"),
-		os.Getenv("CLOUDINARY_API_SECRET"),
-	)
+	slipURL, sl, err := h.slipService.UploadSlip(c.Context(), userID, src, file.Size)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to initialize Cloudinary",
-		})
-	}
-
-	// Generate unique public ID
-	publicID := fmt.Sprintf("expense_slips/%d_%s", userID, file.Filename)
-
-	uploadResult, err := cld.Upload.Upload(context.Background(), src, uploader.UploadParams{
-		PublicID: publicID,
-		Folder:   "expense_slips",
-	})
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to upload to Cloudinary",
-		})
+		return slipError(c, err)
 	}
 
-	// Return Cloudinary URL
 	return c.JSON(fiber.Map{
-		"slip_url": uploadResult.SecureURL,
+		"slip_url": slipURL,
+		"slip":     sl,
 	})
 }
 
@@ -246,11 +417,28 @@ func (h *ExpenseHandler) CreatePaymentConfirmation(c *fiber.Ctx) error {
 		})
 	}
 
-	pc, err := h.expenseService.CreatePaymentConfirmation(req.GroupID, userID, req.ToUserID, req.Amount, req.SlipURL)
+	if err := h.groupService.RequirePermission(req.GroupID, userID, services.PermRecordPayments); err != nil {
+		return accessError(c, err)
+	}
+
+	if req.Currency != "" {
+		currency, err := money.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		req.Currency = currency
+	}
+
+	pc, err := h.expenseService.CreatePaymentConfirmation(req.GroupID, userID, req.ToUserID, req.Amount, req.Currency, req.SlipURL, req.AllowOverpayment)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if errors.Is(err, services.ErrExchangeRateNotFound) || errors.Is(err, money.ErrInvalidRate) || errors.Is(err, services.ErrOverpayment) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return slipError(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(pc)
@@ -271,26 +459,27 @@ func (h *ExpenseHandler) GetPaymentConfirmations(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(confirmations)
-}
-
-func (h *ExpenseHandler) ConfirmPayment(c *fiber.Ctx) error {
-	confirmationID, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid confirmation ID",
+	if err := h.slipService.SignURLs(c.Context(), confirmations); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
-	userID := c.Locals("userID").(int)
+	return c.JSON(confirmations)
+}
 
-	if err := h.expenseService.ConfirmPayment(confirmationID, userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+func slipError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSlipAlreadyUsed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrSlipNotFound), errors.Is(err, slip.ErrInvalidImage),
+		errors.Is(err, slip.ErrNoQRCode), errors.Is(err, slip.ErrInvalidSlip), errors.Is(err, slip.ErrRejected):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Payment confirmed successfully",
-	})
+	return accessError(c, err)
 }
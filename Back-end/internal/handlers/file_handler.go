@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/storage"
+	"mime"
+	"path"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FileHandler serves files kept in local storage. Requests carry no token;
+// the signature on the URL is what allows the download.
+type FileHandler struct {
+	files *storage.LocalStorage
+}
+
+func NewFileHandler(files *storage.LocalStorage) *FileHandler {
+	return &FileHandler{files: files}
+}
+
+func (h *FileHandler) Download(c *fiber.Ctx) error {
+	f, err := h.files.Open(c.Params("*"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidSignature), errors.Is(err, storage.ErrLinkExpired):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "File not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(f.Name())); contentType != "" {
+		c.Set("Content-Type", contentType)
+	}
+	// Files are served from the API's origin, so browsers must neither guess
+	// at their type nor render them in place
+	c.Set("X-Content-Type-Options", "nosniff")
+	c.Set("Content-Disposition", "attachment")
+	// The stream is closed once it has been sent
+	return c.SendStream(f)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"expense-splitter/internal/models"
 	"expense-splitter/internal/services"
 	"strconv"
@@ -20,7 +21,7 @@ func NewFriendHandler(friendService *services.FriendService, userService *servic
 	}
 }
 
-func (h *FriendHandler) AddFriend(c *fiber.Ctx) error {
+func (h *FriendHandler) SendFriendRequest(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(int)
 
 	var req models.AddFriendRequest
@@ -31,21 +32,162 @@ func (h *FriendHandler) AddFriend(c *fiber.Ctx) error {
 	}
 
 	// Check if friend exists
-	_, err := h.userService.GetUserByID(req.FriendID)
+	friend, err := h.userService.GetUserByID(req.FriendID)
+	if err != nil || friend.IsGuest {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	request, err := h.friendService.SendFriendRequest(userID, req.FriendID)
+	if err != nil {
+		return friendError(c, err)
+	}
+
+	if request.Status == models.FriendRequestAccepted {
+		return c.JSON(request)
+	}
+	return c.Status(fiber.StatusCreated).JSON(request)
+}
+
+func (h *FriendHandler) GetIncomingRequests(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	requests, err := h.friendService.GetIncomingRequests(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(requests)
+}
+
+func (h *FriendHandler) GetOutgoingRequests(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	requests, err := h.friendService.GetOutgoingRequests(userID)
 	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(requests)
+}
+
+func (h *FriendHandler) AcceptFriendRequest(c *fiber.Ctx) error {
+	return h.answerRequest(c, h.friendService.AcceptFriendRequest, "Friend request accepted")
+}
+
+func (h *FriendHandler) DeclineFriendRequest(c *fiber.Ctx) error {
+	return h.answerRequest(c, h.friendService.DeclineFriendRequest, "Friend request declined")
+}
+
+func (h *FriendHandler) CancelFriendRequest(c *fiber.Ctx) error {
+	return h.answerRequest(c, h.friendService.CancelFriendRequest, "Friend request cancelled")
+}
+
+func (h *FriendHandler) answerRequest(c *fiber.Ctx, answer func(userID, requestID int) error, message string) error {
+	userID := c.Locals("userID").(int)
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	if err := answer(userID, requestID); err != nil {
+		return friendError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": message,
+	})
+}
+
+func (h *FriendHandler) BlockUser(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var req models.BlockUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Guests have no account to block
+	blocked, err := h.userService.GetUserByID(req.UserID)
+	if err != nil || blocked.IsGuest {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
-	if err := h.friendService.AddFriend(userID, req.FriendID); err != nil {
+	if err := h.friendService.BlockUser(userID, req.UserID); err != nil {
+		return friendError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User blocked successfully",
+	})
+}
+
+func (h *FriendHandler) UnblockUser(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	blockedID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.friendService.UnblockUser(userID, blockedID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"message": "Friend added successfully",
+		"message": "User unblocked successfully",
+	})
+}
+
+func (h *FriendHandler) GetBlockedUsers(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	users, err := h.friendService.GetBlockedUsers(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(users)
+}
+
+func friendError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrFriendRequestNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Friend request not found",
+		})
+	case errors.Is(err, services.ErrFriendRequestExists), errors.Is(err, services.ErrAlreadyFriends):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrUserBlocked):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrCannotFriendSelf), errors.Is(err, services.ErrCannotBlockSelf):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
 	})
 }
 
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"expense-splitter/internal/models"
 	"expense-splitter/internal/services"
+	"expense-splitter/pkg/money"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -36,7 +38,18 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	group, err := h.groupService.CreateGroup(req.Name, req.Description, userID)
+	baseCurrency := services.DefaultBaseCurrency
+	if req.BaseCurrency != "" {
+		currency, err := money.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		baseCurrency = currency
+	}
+
+	group, err := h.groupService.CreateGroup(req.Name, req.Description, baseCurrency, userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -60,7 +73,6 @@ func (h *GroupHandler) GetUserGroups(c *fiber.Ctx) error {
 }
 
 func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(int)
 	groupID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -68,19 +80,6 @@ func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is member
-	isMember, err := h.groupService.IsUserMember(groupID, userID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-	if !isMember {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You are not a member of this group",
-		})
-	}
-
 	group, err := h.groupService.GetGroup(groupID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -100,19 +99,6 @@ func (h *GroupHandler) AddMember(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is member
-	isMember, err := h.groupService.IsUserMember(groupID, userID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-	if !isMember {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You are not a member of this group",
-		})
-	}
-
 	var req models.AddMemberRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -120,10 +106,12 @@ func (h *GroupHandler) AddMember(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.groupService.AddMember(groupID, req.UserID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+
+	if err := h.groupService.AddMember(groupID, userID, req.UserID, req.Role); err != nil {
+		return accessError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -147,27 +135,69 @@ func (h *GroupHandler) RemoveMember(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if requester is member
-	isMember, err := h.groupService.IsUserMember(groupID, userID)
+	if err := h.groupService.RemoveMember(groupID, userID, memberID); err != nil {
+		return accessError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed successfully",
+	})
+}
+
+func (h *GroupHandler) ChangeMemberRole(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
 		})
 	}
-	if !isMember {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You are not a member of this group",
+
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
 		})
 	}
 
-	if err := h.groupService.RemoveMember(groupID, memberID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
+	var req models.ChangeRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
 		})
 	}
 
+	if err := h.groupService.ChangeMemberRole(groupID, userID, memberID, req.Role); err != nil {
+		return accessError(c, err)
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "Member removed successfully",
+		"message": "Member role updated successfully",
+	})
+}
+
+func (h *GroupHandler) TransferOwnership(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	var req models.TransferOwnershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.groupService.TransferOwnership(groupID, userID, req.UserID); err != nil {
+		return accessError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Ownership transferred successfully",
 	})
 }
 
@@ -193,11 +223,25 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	group, err := h.groupService.UpdateGroup(groupID, req.Name, req.Description, userID)
+	baseCurrency := ""
+	if req.BaseCurrency != "" {
+		currency, err := money.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		baseCurrency = currency
+	}
+
+	group, err := h.groupService.UpdateGroup(groupID, req.Name, req.Description, baseCurrency, userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if errors.Is(err, services.ErrBaseCurrencyLocked) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return accessError(c, err)
 	}
 
 	return c.JSON(group)
@@ -213,9 +257,7 @@ func (h *GroupHandler) DeleteGroup(c *fiber.Ctx) error {
 	}
 
 	if err := h.groupService.DeleteGroup(groupID, userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return accessError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -237,19 +279,6 @@ func (h *GroupHandler) SearchUsers(c *fiber.Ctx) error {
 		return c.JSON([]models.User{})
 	}
 
-	// Check if user is member of the group
-	isMember, err := h.groupService.IsUserMember(groupID, userID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-	if !isMember {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You are not a member of this group",
-		})
-	}
-
 	users, err := h.userService.SearchUsers(query, userID, groupID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type GuestHandler struct {
+	guestService *services.GuestService
+}
+
+func NewGuestHandler(guestService *services.GuestService) *GuestHandler {
+	return &GuestHandler{guestService: guestService}
+}
+
+func (h *GuestHandler) AddGuest(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	var req models.AddGuestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Guest name is required",
+		})
+	}
+
+	guest, err := h.guestService.AddGuest(groupID, userID, req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(guest)
+}
+
+func (h *GuestHandler) CreateClaimToken(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	guestID, err := strconv.Atoi(c.Params("guestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid guest ID",
+		})
+	}
+
+	token, err := h.guestService.CreateClaimToken(groupID, guestID)
+	if err != nil {
+		if errors.Is(err, services.ErrGuestNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Guest not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.GuestClaimResponse{Token: token})
+}
+
+func (h *GuestHandler) ClaimGuest(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	groupID, err := h.guestService.ClaimGuest(c.Params("token"), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrGuestNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Guest not found or already claimed",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Guest claimed successfully",
+		"group_id": groupID,
+	})
+}
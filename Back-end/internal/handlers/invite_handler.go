@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type InviteHandler struct {
+	inviteService *services.InviteService
+}
+
+func NewInviteHandler(inviteService *services.InviteService) *InviteHandler {
+	return &InviteHandler{inviteService: inviteService}
+}
+
+func (h *InviteHandler) CreateInvite(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	var req models.CreateInviteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.ExpiresInHours < 0 || req.MaxUses < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_in_hours and max_uses must not be negative",
+		})
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	var maxUses *int
+	if req.MaxUses > 0 {
+		maxUses = &req.MaxUses
+	}
+
+	invite, err := h.inviteService.CreateInvite(groupID, userID, expiresAt, maxUses)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invite)
+}
+
+func (h *InviteHandler) GetGroupInvites(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	invites, err := h.inviteService.GetGroupInvites(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(invites)
+}
+
+func (h *InviteHandler) RevokeInvite(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	inviteID, err := strconv.Atoi(c.Params("inviteId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invite ID",
+		})
+	}
+
+	if err := h.inviteService.RevokeInvite(groupID, inviteID); err != nil {
+		if errors.Is(err, services.ErrInviteNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Invite not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invite revoked successfully",
+	})
+}
+
+func (h *InviteHandler) JoinGroup(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	resp, err := h.inviteService.JoinGroup(c.Params("token"), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrInviteNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Invite not found",
+			})
+		}
+		if errors.Is(err, services.ErrInviteUnusable) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if resp.Status == services.JoinStatusPending {
+		return c.Status(fiber.StatusAccepted).JSON(resp)
+	}
+	return c.JSON(resp)
+}
+
+func (h *InviteHandler) SetJoinPolicy(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	var req models.JoinPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.inviteService.SetRequireApproval(groupID, req.RequireApproval); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Join policy updated successfully",
+	})
+}
+
+func (h *InviteHandler) GetJoinRequests(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	status := c.Query("status", models.JoinRequestPending)
+	requests, err := h.inviteService.GetJoinRequests(groupID, status)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(requests)
+}
+
+func (h *InviteHandler) AcceptJoinRequest(c *fiber.Ctx) error {
+	return h.decideJoinRequest(c, true)
+}
+
+func (h *InviteHandler) RejectJoinRequest(c *fiber.Ctx) error {
+	return h.decideJoinRequest(c, false)
+}
+
+func (h *InviteHandler) decideJoinRequest(c *fiber.Ctx, accept bool) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+	requestID, err := strconv.Atoi(c.Params("requestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	if err := h.inviteService.DecideJoinRequest(groupID, requestID, userID, accept); err != nil {
+		if errors.Is(err, services.ErrJoinRequestNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Join request not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	message := "Join request rejected"
+	if accept {
+		message = "Join request accepted"
+	}
+	return c.JSON(fiber.Map{
+		"message": message,
+	})
+}
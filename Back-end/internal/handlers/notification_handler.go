@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService: notificationService}
+}
+
+// GetNotifications lists the caller's notifications, newest first. Pass the
+// response's next_cursor as ?cursor= to get older ones, and ?unread=true for
+// only unread ones.
+func (h *NotificationHandler) GetNotifications(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	limit, err := parseIntQuery(c, "limit")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	list, err := h.notificationService.GetNotifications(userID, c.Query("cursor"), limit, c.QueryBool("unread"))
+	if err != nil {
+		return notificationError(c, err)
+	}
+
+	return c.JSON(list)
+}
+
+func (h *NotificationHandler) MarkRead(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	notificationID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid notification ID",
+		})
+	}
+
+	if err := h.notificationService.MarkRead(userID, notificationID); err != nil {
+		return notificationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notification marked as read",
+	})
+}
+
+func (h *NotificationHandler) MarkAllRead(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	marked, err := h.notificationService.MarkAllRead(userID)
+	if err != nil {
+		return notificationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"marked": marked,
+	})
+}
+
+func (h *NotificationHandler) GetPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	preferences, err := h.notificationService.GetPreferences(userID)
+	if err != nil {
+		return notificationError(c, err)
+	}
+
+	return c.JSON(preferences)
+}
+
+func (h *NotificationHandler) UpdatePreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var req models.UpdateNotificationPreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	preferences, err := h.notificationService.UpdatePreferences(userID, req.Preferences)
+	if err != nil {
+		return notificationError(c, err)
+	}
+
+	return c.JSON(preferences)
+}
+
+func notificationError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotificationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
+	case errors.Is(err, services.ErrInvalidCursor):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	case errors.Is(err, services.ErrInvalidNotificationType):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"expense-splitter/pkg/money"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PaymentRequestHandler struct {
+	paymentRequestService *services.PaymentRequestService
+}
+
+func NewPaymentRequestHandler(paymentRequestService *services.PaymentRequestService) *PaymentRequestHandler {
+	return &PaymentRequestHandler{paymentRequestService: paymentRequestService}
+}
+
+// CreateRequest asks a member who owes the caller to pay by a due date
+func (h *PaymentRequestHandler) CreateRequest(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	var req models.CreatePaymentRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.FromUserID == 0 || req.DueDate == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "From user ID and due date are required",
+		})
+	}
+
+	if req.Currency != "" {
+		currency, err := money.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		req.Currency = currency
+	}
+
+	pr, err := h.paymentRequestService.CreateRequest(groupID, userID, req)
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(pr)
+}
+
+// GetGroupRequests lists the group's payment requests, optionally only those
+// with ?status=open, paid or cancelled
+func (h *PaymentRequestHandler) GetGroupRequests(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	status := c.Query("status")
+	switch status {
+	case "", models.PaymentRequestOpen, models.PaymentRequestPaid, models.PaymentRequestCancelled:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid status",
+		})
+	}
+
+	requests, err := h.paymentRequestService.GetGroupRequests(groupID, status)
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.JSON(requests)
+}
+
+func (h *PaymentRequestHandler) CancelRequest(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+	requestID, err := strconv.Atoi(c.Params("requestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid payment request ID",
+		})
+	}
+
+	if err := h.paymentRequestService.CancelRequest(groupID, requestID, userID); err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Payment request cancelled",
+	})
+}
+
+func paymentRequestError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrPaymentRequestNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Payment request not found",
+		})
+	case errors.Is(err, services.ErrPaymentRequestExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrNoSettlement), errors.Is(err, services.ErrInvalidRequestAmount),
+		errors.Is(err, services.ErrInvalidDueDate):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return accessError(c, err)
+}
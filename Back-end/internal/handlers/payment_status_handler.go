@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *ExpenseHandler) ConfirmPayment(c *fiber.Ctx) error {
+	confirmationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid confirmation ID",
+		})
+	}
+
+	userID := c.Locals("userID").(int)
+
+	if err := h.expenseService.ConfirmPayment(confirmationID, userID); err != nil {
+		return paymentStatusError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Payment confirmed successfully",
+	})
+}
+
+func (h *ExpenseHandler) RejectPayment(c *fiber.Ctx) error {
+	confirmationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid confirmation ID",
+		})
+	}
+
+	var req models.PaymentStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID := c.Locals("userID").(int)
+
+	if err := h.expenseService.RejectPayment(confirmationID, userID, req.Reason); err != nil {
+		return paymentStatusError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Payment rejected",
+	})
+}
+
+func (h *ExpenseHandler) DisputePayment(c *fiber.Ctx) error {
+	confirmationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid confirmation ID",
+		})
+	}
+
+	var req models.PaymentStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID := c.Locals("userID").(int)
+
+	if err := h.expenseService.DisputePayment(confirmationID, userID, req.Reason); err != nil {
+		return paymentStatusError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Payment disputed",
+	})
+}
+
+// ResolveDispute confirms a disputed payment again, or rejects it when it is
+// not upheld
+func (h *ExpenseHandler) ResolveDispute(c *fiber.Ctx) error {
+	confirmationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid confirmation ID",
+		})
+	}
+
+	var req models.ResolveDisputeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID := c.Locals("userID").(int)
+
+	if err := h.expenseService.ResolveDispute(confirmationID, userID, req.Upheld, req.Reason); err != nil {
+		return paymentStatusError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Dispute resolved",
+	})
+}
+
+// GetPaymentHistory lists the status changes of a payment confirmation
+func (h *ExpenseHandler) GetPaymentHistory(c *fiber.Ctx) error {
+	confirmationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid confirmation ID",
+		})
+	}
+
+	history, err := h.expenseService.GetPaymentHistory(confirmationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(history)
+}
+
+func paymentStatusError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTransition):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrReasonRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return accessError(c, err)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/services"
+	"expense-splitter/pkg/money"
+	"expense-splitter/pkg/promptpay"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 128
+	maxQRSize     = 1024
+)
+
+type PromptPayHandler struct {
+	promptPayService *services.PromptPayService
+}
+
+func NewPromptPayHandler(promptPayService *services.PromptPayService) *PromptPayHandler {
+	return &PromptPayHandler{promptPayService: promptPayService}
+}
+
+// GetSettlementQR returns a PromptPay QR code for the settlement from ?from
+// to ?to. ?currency picks a per-currency settlement, ?size the width of the
+// image in pixels, and ?format=png returns the image alone instead of JSON.
+func (h *PromptPayHandler) GetSettlementQR(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	fromUserID, err := parseIntQuery(c, "from")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	toUserID, err := parseIntQuery(c, "to")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if fromUserID == 0 || toUserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "From and to user IDs are required",
+		})
+	}
+
+	currency := c.Query("currency")
+	if currency != "" {
+		if currency, err = money.NormalizeCurrency(currency); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	size, err := parseIntQuery(c, "size")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if size == 0 {
+		size = defaultQRSize
+	}
+	size = max(minQRSize, min(size, maxQRSize))
+
+	qr, err := h.promptPayService.SettlementQR(groupID, fromUserID, toUserID, currency, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoSettlement):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrNoPromptPayID), errors.Is(err, services.ErrPromptPayCurrency),
+			errors.Is(err, promptpay.ErrInvalidID), errors.Is(err, promptpay.ErrInvalidAmount):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return accessError(c, err)
+	}
+
+	if c.Query("format") == "png" {
+		c.Set("Content-Type", "image/png")
+		return c.Send(qr.QRCode)
+	}
+
+	return c.JSON(qr)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/services"
+	"expense-splitter/pkg/money"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RecurringHandler struct {
+	recurringService *services.RecurringService
+}
+
+func NewRecurringHandler(recurringService *services.RecurringService) *RecurringHandler {
+	return &RecurringHandler{recurringService: recurringService}
+}
+
+// parseRecurringRequest reads and checks the body shared by create and update
+func parseRecurringRequest(c *fiber.Ctx) (models.RecurringExpenseRequest, string) {
+	var req models.RecurringExpenseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return req, "Invalid request body"
+	}
+
+	if msg := validateExpenseRequest(req.Template); msg != "" {
+		return req, msg
+	}
+
+	if req.Template.Currency != "" {
+		currency, err := money.NormalizeCurrency(req.Template.Currency)
+		if err != nil {
+			return req, err.Error()
+		}
+		req.Template.Currency = currency
+	}
+
+	return req, ""
+}
+
+func (h *RecurringHandler) CreateRecurring(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+
+	req, msg := parseRecurringRequest(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	rec, err := h.recurringService.CreateRecurring(groupID, userID, req)
+	if err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rec)
+}
+
+func (h *RecurringHandler) GetGroupRecurring(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	recurring, err := h.recurringService.GetGroupRecurring(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(recurring)
+}
+
+func (h *RecurringHandler) GetRecurring(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	recurringID, err := strconv.Atoi(c.Params("recurringId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recurring expense ID",
+		})
+	}
+
+	rec, err := h.recurringService.GetRecurring(groupID, recurringID)
+	if err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.JSON(rec)
+}
+
+func (h *RecurringHandler) UpdateRecurring(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	recurringID, err := strconv.Atoi(c.Params("recurringId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recurring expense ID",
+		})
+	}
+
+	req, msg := parseRecurringRequest(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	rec, err := h.recurringService.UpdateRecurring(groupID, recurringID, req)
+	if err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.JSON(rec)
+}
+
+func (h *RecurringHandler) PauseRecurring(c *fiber.Ctx) error {
+	return h.setPaused(c, true)
+}
+
+func (h *RecurringHandler) ResumeRecurring(c *fiber.Ctx) error {
+	return h.setPaused(c, false)
+}
+
+func (h *RecurringHandler) setPaused(c *fiber.Ctx, paused bool) error {
+	groupID := c.Locals("groupID").(int)
+	recurringID, err := strconv.Atoi(c.Params("recurringId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recurring expense ID",
+		})
+	}
+
+	rec, err := h.recurringService.SetPaused(groupID, recurringID, paused)
+	if err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.JSON(rec)
+}
+
+func (h *RecurringHandler) SkipRecurring(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	recurringID, err := strconv.Atoi(c.Params("recurringId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recurring expense ID",
+		})
+	}
+
+	rec, err := h.recurringService.SkipNext(groupID, recurringID)
+	if err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.JSON(rec)
+}
+
+func (h *RecurringHandler) DeleteRecurring(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+	recurringID, err := strconv.Atoi(c.Params("recurringId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recurring expense ID",
+		})
+	}
+
+	if err := h.recurringService.DeleteRecurring(groupID, recurringID); err != nil {
+		return recurringError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Recurring expense deleted successfully",
+	})
+}
+
+func recurringError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrRecurringNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Recurring expense not found",
+		})
+	case errors.Is(err, services.ErrRecurringEnded):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidRecurrence), isExpenseInputError(err):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return accessError(c, err)
+}
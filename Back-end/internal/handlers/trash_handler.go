@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"expense-splitter/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TrashHandler struct {
+	trashService *services.TrashService
+}
+
+func NewTrashHandler(trashService *services.TrashService) *TrashHandler {
+	return &TrashHandler{trashService: trashService}
+}
+
+func (h *TrashHandler) GetGroupTrash(c *fiber.Ctx) error {
+	groupID := c.Locals("groupID").(int)
+
+	expenses, err := h.trashService.GetGroupTrash(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(expenses)
+}
+
+func (h *TrashHandler) RestoreExpense(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID := c.Locals("groupID").(int)
+	expenseID, err := strconv.Atoi(c.Params("expenseId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid expense ID",
+		})
+	}
+
+	expense, err := h.trashService.RestoreExpense(groupID, expenseID, userID)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	return c.JSON(expense)
+}
+
+func (h *TrashHandler) GetDeletedGroups(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	groups, err := h.trashService.GetDeletedGroups(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(groups)
+}
+
+// RestoreGroup is not behind the authorizer, which treats deleted groups as
+// missing; TrashService.RestoreGroup checks the caller's role itself
+func (h *TrashHandler) RestoreGroup(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	groupID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	if err := h.trashService.RestoreGroup(groupID, userID); err != nil {
+		return accessError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Group restored successfully",
+	})
+}
@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each message to an .eml file in a directory instead of
+// sending it, so mail can be checked by opening the files during development
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := encode(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode mail: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// LogMailer logs messages instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
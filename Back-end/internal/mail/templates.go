@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"expense-splitter/pkg/money"
+)
+
+// Templates. Each has a <name>.txt defining "subject" and "text", and a
+// <name>.html, in every locale's directory.
+const (
+	TemplatePaymentReceived  = "payment_received"
+	TemplatePaymentConfirmed = "payment_confirmed"
+	TemplatePaymentRejected  = "payment_rejected"
+	TemplatePaymentRequested = "payment_requested"
+	TemplatePaymentReminder  = "payment_reminder"
+	TemplatePaymentOverdue   = "payment_overdue"
+	TemplateWeeklySummary    = "weekly_summary"
+)
+
+var templateNames = []string{
+	TemplatePaymentReceived,
+	TemplatePaymentConfirmed,
+	TemplatePaymentRejected,
+	TemplatePaymentRequested,
+	TemplatePaymentReminder,
+	TemplatePaymentOverdue,
+	TemplateWeeklySummary,
+}
+
+// DefaultLocale is used for users whose locale has no templates
+const DefaultLocale = "en"
+
+// Locales lists the languages mail can be written in
+var Locales = []string{"en", "th"}
+
+// PaymentData fills the payment and payment request templates
+type PaymentData struct {
+	Recipient string
+	Actor     string // Who made, confirmed, rejected or requested the payment
+	Group     string
+	Amount    money.Money
+	Currency  string
+	DueDate   time.Time // Payment requests only
+	Reason    string    // Rejections only
+}
+
+// SummaryData fills the weekly summary
+type SummaryData struct {
+	Recipient string
+	Owes      []SummaryLine // What the recipient should pay
+	Owed      []SummaryLine // What the recipient should be paid
+}
+
+type SummaryLine struct {
+	Group    string
+	Person   string // Who to pay, or who should pay
+	Amount   money.Money
+	Currency string
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+// mailTemplate is one template in one locale
+type mailTemplate struct {
+	text *texttemplate.Template // Defines "subject" and "text"
+	html *htmltemplate.Template
+}
+
+// templates holds each locale's templates by name
+var templates = mustParseTemplates()
+
+func mustParseTemplates() map[string]map[string]mailTemplate {
+	parsed := make(map[string]map[string]mailTemplate)
+	for _, locale := range Locales {
+		parsed[locale] = make(map[string]mailTemplate)
+		for _, name := range templateNames {
+			path := "templates/" + locale + "/" + name
+			parsed[locale][name] = mailTemplate{
+				text: texttemplate.Must(texttemplate.ParseFS(templateFS, path+".txt")),
+				html: htmltemplate.Must(htmltemplate.ParseFS(templateFS, path+".html")),
+			}
+		}
+	}
+	return parsed
+}
+
+// SupportedLocale reports whether mail can be written in locale
+func SupportedLocale(locale string) bool {
+	return slices.Contains(Locales, locale)
+}
+
+// Render fills the named template in locale, falling back to English, and
+// returns the message without a recipient
+func Render(name, locale string, data any) (Message, error) {
+	localized, ok := templates[locale]
+	if !ok {
+		localized = templates[DefaultLocale]
+	}
+	t, ok := localized[name]
+	if !ok {
+		return Message{}, fmt.Errorf("mail template %q not found", name)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %v", name, err)
+	}
+	if err := t.text.ExecuteTemplate(&textBody, "text", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %v", name, err)
+	}
+	if err := t.html.Execute(&htmlBody, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s html: %v", name, err)
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -1,77 +1,433 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"expense-splitter/pkg/money"
+	"time"
+)
 
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-type Group struct {
 	ID          int       `json:"id"`
+	Email       string    `json:"email"`
 	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedBy   int       `json:"created_by"`
+	Password    string    `json:"-"`
+	IsGuest     bool      `json:"is_guest,omitempty"`     // Placeholder member with no account yet
+	Role        string    `json:"role,omitempty"`         // Group role, only set in group member lists
+	PromptPayID string    `json:"promptpay_id,omitempty"` // Where members pay the user back
 	CreatedAt   time.Time `json:"created_at"`
-	Members     []User    `json:"members,omitempty"`
+}
+
+type Group struct {
+	ID                  int       `json:"id"`
+	Name                string    `json:"name"`
+	Description         string    `json:"description"`
+	CreatedBy           int       `json:"created_by"`
+	BaseCurrency        string    `json:"base_currency"`
+	RequireJoinApproval bool      `json:"require_join_approval"`
+	Role                string    `json:"role,omitempty"`         // The caller's role, only set in GetUserGroups
+	UnreadCount         int       `json:"unread_count,omitempty"` // Activity the caller has not seen, only set in GetUserGroups
+	CreatedAt           time.Time `json:"created_at"`
+	Members             []User    `json:"members,omitempty"`
+}
+
+// Group member roles
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+type GroupInvite struct {
+	ID        int        `json:"id"`
+	GroupID   int        `json:"group_id"`
+	Token     string     `json:"token"`
+	CreatedBy int        `json:"created_by"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxUses   *int       `json:"max_uses,omitempty"`
+	UseCount  int        `json:"use_count"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestAccepted = "accepted"
+	JoinRequestRejected = "rejected"
+)
+
+type JoinRequest struct {
+	ID        int        `json:"id"`
+	GroupID   int        `json:"group_id"`
+	UserID    int        `json:"user_id"`
+	UserName  string     `json:"user_name,omitempty"`
+	UserEmail string     `json:"user_email,omitempty"`
+	Status    string     `json:"status"`
+	DecidedBy *int64     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 type GroupMember struct {
 	GroupID  int       `json:"group_id"`
 	UserID   int       `json:"user_id"`
+	Role     string    `json:"role"`
 	JoinedAt time.Time `json:"joined_at"`
 }
 
 type Expense struct {
-	ID          int       `json:"id"`
-	GroupID     int       `json:"group_id"`
-	Description string    `json:"description"`
-	Amount      float64   `json:"amount"`
-	PaidBy      int       `json:"paid_by"`
-	PaidByName  string    `json:"paid_by_name,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	Splits      []Split   `json:"splits,omitempty"`
+	ID           int                 `json:"id"`
+	GroupID      int                 `json:"group_id"`
+	Description  string              `json:"description"`
+	Amount       money.Money         `json:"amount"`
+	Currency     string              `json:"currency"`
+	ExchangeRate money.Rate          `json:"exchange_rate"` // Rate to the group's base currency when the expense was recorded
+	BaseAmount   money.Money         `json:"base_amount"`   // Amount in the group's base currency
+	PaidBy       int                 `json:"paid_by"`       // Primary payer, see Payers for every contribution
+	PaidByName   string              `json:"paid_by_name,omitempty"`
+	SplitType    string              `json:"split_type"`
+	ExpenseDate  time.Time           `json:"expense_date"` // Day the expense happened, may be before CreatedAt
+	Category     string              `json:"category"`
+	Notes        string              `json:"notes"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Payers       []ExpensePayer      `json:"payers,omitempty"`
+	Splits       []Split             `json:"splits,omitempty"`
+	Items        []ExpenseItem       `json:"items,omitempty"`       // Only for itemized expenses
+	Adjustments  *ExpenseAdjustments `json:"adjustments,omitempty"` // Only for itemized expenses
+}
+
+// DeletedExpense is an expense in a group's trash
+type DeletedExpense struct {
+	Expense
+	DeletedAt     time.Time `json:"deleted_at"`
+	DeletedBy     *int64    `json:"deleted_by,omitempty"`
+	DeletedByName string    `json:"deleted_by_name,omitempty"`
+	PurgeAt       time.Time `json:"purge_at"` // When it is deleted for good
+}
+
+// DeletedGroup is a group in the trash
+type DeletedGroup struct {
+	Group
+	DeletedAt     time.Time `json:"deleted_at"`
+	DeletedBy     *int64    `json:"deleted_by,omitempty"`
+	DeletedByName string    `json:"deleted_by_name,omitempty"`
+	PurgeAt       time.Time `json:"purge_at"` // When it is deleted for good
+}
+
+// ExpensePayer is how much one person paid towards an expense
+type ExpensePayer struct {
+	UserID   int         `json:"user_id"`
+	UserName string      `json:"user_name,omitempty"`
+	Amount   money.Money `json:"amount"`
 }
 
+// ExpenseItem is one line of an itemized receipt, shared equally by its
+// consumers
+type ExpenseItem struct {
+	ID        int         `json:"id,omitempty"`
+	Name      string      `json:"name"`
+	Amount    money.Money `json:"amount"`
+	Consumers []int       `json:"consumers"` // User IDs
+}
+
+// ExpenseAdjustments are applied to the item subtotal in this order: the
+// discount is taken off, the service charge is added on what remains, tax is
+// added on the discounted subtotal plus service charge, and the tip is added
+// last. Everyone pays them in proportion to their share of the items.
+type ExpenseAdjustments struct {
+	Discount             money.Money `json:"discount"`
+	ServiceChargePercent float64     `json:"service_charge_percent"`
+	TaxPercent           float64     `json:"tax_percent"`
+	Tip                  money.Money `json:"tip"`
+}
+
+// Split types supported by CreateExpenseRequest.SplitType
+const (
+	SplitEqual      = "equal"
+	SplitExact      = "exact"
+	SplitPercentage = "percentage"
+	SplitShares     = "shares"
+	SplitItemized   = "itemized"
+)
+
 type Split struct {
-	ID        int     `json:"id"`
-	ExpenseID int     `json:"expense_id"`
-	UserID    int     `json:"user_id"`
-	UserName  string  `json:"user_name,omitempty"`
-	Amount    float64 `json:"amount"`
+	ID        int         `json:"id"`
+	ExpenseID int         `json:"expense_id"`
+	UserID    int         `json:"user_id"`
+	UserName  string      `json:"user_name,omitempty"`
+	Amount    money.Money `json:"amount"`
+	Value     *float64    `json:"value,omitempty"` // Exact amount, percentage or shares as entered
 }
 
 type Settlement struct {
-	From        int        `json:"from_user_id"`
-	FromName    string     `json:"from_user_name"`
-	To          int        `json:"to_user_id"`
-	ToName      string     `json:"to_user_name"`
-	Amount      float64    `json:"amount"`
-	Confirmed   bool       `json:"confirmed"`
-	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	From        int         `json:"from_user_id"`
+	FromName    string      `json:"from_user_name"`
+	To          int         `json:"to_user_id"`
+	ToName      string      `json:"to_user_name"`
+	Amount      money.Money `json:"amount"`
+	Currency    string      `json:"currency"`
+	Confirmed   bool        `json:"confirmed"`
+	ConfirmedAt *time.Time  `json:"confirmed_at,omitempty"`
 }
 
 type Balance struct {
-	UserID   int     `json:"user_id"`
-	UserName string  `json:"user_name"`
-	Balance  float64 `json:"balance"`
+	UserID   int         `json:"user_id"`
+	UserName string      `json:"user_name"`
+	Balance  money.Money `json:"balance"`
+	Currency string      `json:"currency"`
+}
+
+// CurrencySettlements holds the settlements for a single currency when a
+// group is settled per currency instead of in its base currency
+type CurrencySettlements struct {
+	Currency    string        `json:"currency"`
+	Settlements []Settlement  `json:"settlements"`
+	Balances    []Balance     `json:"balances"`
+	Pairs       []PairBalance `json:"pairs"`
+}
+
+// PairBalance is where paying one person back stands. Paid and Pending are
+// the confirmed and pending payments between them; Outstanding is what the
+// settlements say is still owed once the pending payments are confirmed.
+type PairBalance struct {
+	FromUserID   int         `json:"from_user_id"`
+	FromUserName string      `json:"from_user_name"`
+	ToUserID     int         `json:"to_user_id"`
+	ToUserName   string      `json:"to_user_name"`
+	Currency     string      `json:"currency"`
+	Paid         money.Money `json:"paid"`
+	Pending      money.Money `json:"pending"`
+	Outstanding  money.Money `json:"outstanding"`
+}
+
+// SettlementQR is a PromptPay QR code for paying one settlement to its
+// recipient
+type SettlementQR struct {
+	Settlement  Settlement `json:"settlement"`
+	PromptPayID string     `json:"promptpay_id"`
+	Payload     string     `json:"payload"`
+	QRCode      []byte     `json:"qr_code"` // PNG, base64 encoded in JSON
+}
+
+type ExchangeRate struct {
+	BaseCurrency  string     `json:"base_currency"`
+	QuoteCurrency string     `json:"quote_currency"`
+	Rate          money.Rate `json:"rate"` // One unit of BaseCurrency in QuoteCurrency
+	RateDate      time.Time  `json:"rate_date"`
+	Source        string     `json:"source,omitempty"`
 }
 
 type PaymentConfirmation struct {
-	ID              int        `json:"id"`
-	GroupID         int        `json:"group_id"`
-	FromUserID      int        `json:"from_user_id"`
-	FromUserName    string     `json:"from_user_name,omitempty"`
-	ToUserID        int        `json:"to_user_id"`
-	ToUserName      string     `json:"to_user_name,omitempty"`
-	Amount          float64    `json:"amount"`
-	SlipURL         string     `json:"slip_url,omitempty"`
-	ConfirmedBy     *int64     `json:"confirmed_by,omitempty"`
-	ConfirmedByName string     `json:"confirmed_by_name,omitempty"`
-	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	ID              int             `json:"id"`
+	GroupID         int             `json:"group_id"`
+	FromUserID      int             `json:"from_user_id"`
+	FromUserName    string          `json:"from_user_name,omitempty"`
+	ToUserID        int             `json:"to_user_id"`
+	ToUserName      string          `json:"to_user_name,omitempty"`
+	Amount          money.Money     `json:"amount"`
+	Currency        string          `json:"currency"`
+	ExchangeRate    money.Rate      `json:"exchange_rate"`
+	SlipURL         string          `json:"slip_url,omitempty"`
+	SlipKey         string          `json:"-"`                        // Where the slip is in file storage, if it is
+	SlipTransRef    string          `json:"slip_trans_ref,omitempty"` // Bank reference read from the slip's QR code
+	SlipData        json.RawMessage `json:"slip_data,omitempty"`      // Everything read from the slip, kept for disputes
+	Overpayment     money.Money     `json:"overpayment,omitempty"`    // How much more than was outstanding was paid, in Currency
+	Status          string          `json:"status"`
+	StatusReason    string          `json:"status_reason,omitempty"` // Why it was last rejected, disputed or resolved
+	ConfirmedBy     *int64          `json:"confirmed_by,omitempty"`
+	ConfirmedByName string          `json:"confirmed_by_name,omitempty"`
+	ConfirmedAt     *time.Time      `json:"confirmed_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// Payment confirmation statuses
+const (
+	PaymentPending   = "pending"
+	PaymentConfirmed = "confirmed"
+	PaymentRejected  = "rejected"
+	PaymentDisputed  = "disputed"
+)
+
+// PaymentTransition is one status change in a payment confirmation's
+// history. FromStatus is unset for its creation.
+type PaymentTransition struct {
+	ID         int64     `json:"id"`
+	Action     string    `json:"action"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    *int64    `json:"actor_id,omitempty"`
+	ActorName  string    `json:"actor_name,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Entity types and actions recorded in the audit log
+const (
+	AuditEntityExpense = "expense"
+	AuditEntityMember  = "member"
+	AuditEntityPayment = "payment"
+	AuditEntityGroup   = "group"
+
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionConfirm = "confirm"
+	AuditActionReject  = "reject"
+	AuditActionDispute = "dispute"
+	AuditActionResolve = "resolve"
+	AuditActionClaim   = "claim"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// AuditEntry is one change in a group's audit log. Before and After are
+// snapshots of the entity; Before is unset for creations and After for
+// deletions.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	GroupID    int             `json:"group_id"`
+	ActorID    *int64          `json:"actor_id,omitempty"` // Unset for changes made by the system
+	ActorName  string          `json:"actor_name,omitempty"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Action     string          `json:"action"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditMember is the snapshot recorded for member changes
+type AuditMember struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// AuditFilter narrows an audit log query. Zero values do not filter.
+type AuditFilter struct {
+	EntityType string
+	EntityID   int
+	ActorID    int
+	Before     int64 // Only entries with a smaller ID, for paging
+	Limit      int
+}
+
+// Activity feed item types
+const (
+	ActivityExpenseAdded     = "expense_added"
+	ActivityExpenseEdited    = "expense_edited"
+	ActivityExpenseDeleted   = "expense_deleted"
+	ActivityExpenseRestored  = "expense_restored"
+	ActivityMemberJoined     = "member_joined"
+	ActivityMemberLeft       = "member_left"
+	ActivityMemberRemoved    = "member_removed"
+	ActivityRoleChanged      = "member_role_changed"
+	ActivityGuestClaimed     = "guest_claimed"
+	ActivityPaymentSubmitted = "payment_submitted"
+	ActivityPaymentConfirmed = "payment_confirmed"
+	ActivityPaymentRejected  = "payment_rejected"
+	ActivityPaymentDisputed  = "payment_disputed"
+	ActivityDisputeResolved  = "payment_dispute_resolved"
+	ActivityGroupDeleted     = "group_deleted"
+	ActivityGroupRestored    = "group_restored"
+)
+
+// ActivityItem is one entry in a group's activity feed. Which of the detail
+// fields are set depends on Type.
+type ActivityItem struct {
+	ID          int64        `json:"id"`
+	Type        string       `json:"type"`
+	ActorID     *int64       `json:"actor_id,omitempty"` // Unset for changes made by the system
+	ActorName   string       `json:"actor_name,omitempty"`
+	EntityID    int          `json:"entity_id"`             // Expense, payment confirmation or user ID
+	Description string       `json:"description,omitempty"` // Expenses
+	Amount      *money.Money `json:"amount,omitempty"`      // Expenses and payments
+	Currency    string       `json:"currency,omitempty"`    // Expenses and payments
+	UserID      int          `json:"user_id,omitempty"`     // Member affected, or who a payment was made to
+	UserName    string       `json:"user_name,omitempty"`
+	Role        string       `json:"role,omitempty"` // Members: the role after the change
+	Unread      bool         `json:"unread"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type ActivityFeed struct {
+	Items       []ActivityItem `json:"items"`
+	NextCursor  string         `json:"next_cursor,omitempty"` // Pass as ?cursor= for older items
+	LastSeenID  int64          `json:"last_seen_id"`
+	UnreadCount int            `json:"unread_count"`
+}
+
+type MarkActivitySeenRequest struct {
+	ActivityID int64 `json:"activity_id"` // Defaults to the newest item
+}
+
+// Notification types
+const (
+	NotificationExpenseAdded     = "expense_added"
+	NotificationExpenseUpdated   = "expense_updated"
+	NotificationPaymentReceived  = "payment_received"
+	NotificationPaymentConfirmed = "payment_confirmed"
+	NotificationPaymentRejected  = "payment_rejected"
+	NotificationPaymentDisputed  = "payment_disputed"
+	NotificationDisputeResolved  = "payment_dispute_resolved"
+	NotificationPaymentRequested = "payment_requested"
+	NotificationPaymentReminder  = "payment_reminder"
+	NotificationPaymentOverdue   = "payment_overdue"
+	NotificationAddedToGroup     = "added_to_group"
+	NotificationRoleChanged      = "role_changed"
+	NotificationFriendRequest    = "friend_request"
+	NotificationFriendAccepted   = "friend_accepted"
+	NotificationWeeklySummary    = "weekly_summary" // Email only
+)
+
+// NotificationTypes lists every notification type, in the order preferences
+// are shown
+var NotificationTypes = []string{
+	NotificationExpenseAdded,
+	NotificationExpenseUpdated,
+	NotificationPaymentReceived,
+	NotificationPaymentConfirmed,
+	NotificationPaymentRejected,
+	NotificationPaymentDisputed,
+	NotificationDisputeResolved,
+	NotificationPaymentRequested,
+	NotificationPaymentReminder,
+	NotificationPaymentOverdue,
+	NotificationAddedToGroup,
+	NotificationRoleChanged,
+	NotificationFriendRequest,
+	NotificationFriendAccepted,
+	NotificationWeeklySummary,
+}
+
+// Notification tells a user about something another user did that involves
+// them. Data holds the details needed to show it, which depend on Type.
+type Notification struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	ActorID   *int64          `json:"actor_id,omitempty"` // Unset for changes made by the system
+	ActorName string          `json:"actor_name,omitempty"`
+	GroupID   *int64          `json:"group_id,omitempty"`
+	GroupName string          `json:"group_name,omitempty"`
+	EntityID  int             `json:"entity_id"` // Expense, payment confirmation, friend request or user ID
+	Data      json.RawMessage `json:"data,omitempty"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NotificationList struct {
+	Items       []Notification `json:"items"`
+	NextCursor  string         `json:"next_cursor,omitempty"` // Pass as ?cursor= for older items
+	UnreadCount int            `json:"unread_count"`
+}
+
+type NotificationPreference struct {
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreference `json:"preferences"`
 }
 
 // Request/Response DTOs
@@ -81,6 +437,19 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+type SetLocaleRequest struct {
+	Locale string `json:"locale"` // "en" or "th"
+}
+
+type SetPromptPayRequest struct {
+	PromptPayID string `json:"promptpay_id"` // Phone, national ID or e-wallet ID; empty to remove
+}
+
+type PromptPayProfile struct {
+	PromptPayID string `json:"promptpay_id"`
+	Kind        string `json:"kind,omitempty"` // "phone", "national_id" or "e_wallet"
+}
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -92,27 +461,181 @@ type AuthResponse struct {
 }
 
 type CreateGroupRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	BaseCurrency string `json:"base_currency"` // Defaults to THB
 }
 
 type AddMemberRequest struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"` // Defaults to member
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type TransferOwnershipRequest struct {
 	UserID int `json:"user_id"`
 }
 
+type AddGuestRequest struct {
+	Name string `json:"name"`
+}
+
+type GuestClaimResponse struct {
+	Token string `json:"token"`
+}
+
+type CreateInviteRequest struct {
+	ExpiresInHours int `json:"expires_in_hours"` // 0 means the invite never expires
+	MaxUses        int `json:"max_uses"`         // 0 means unlimited
+}
+
+type JoinPolicyRequest struct {
+	RequireApproval bool `json:"require_approval"`
+}
+
+type JoinGroupResponse struct {
+	GroupID int    `json:"group_id"`
+	Status  string `json:"status"` // joined, already_member or pending
+}
+
 type CreateExpenseRequest struct {
-	GroupID     int     `json:"group_id"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
-	PaidBy      int     `json:"paid_by"`
-	SplitWith   []int   `json:"split_with"` // User IDs to split with
+	GroupID     int                 `json:"group_id"`
+	Description string              `json:"description"`
+	Amount      money.Money         `json:"amount"`
+	Currency    string              `json:"currency"` // Defaults to the group's base currency
+	PaidBy      int                 `json:"paid_by"`
+	Payers      []ExpensePayer      `json:"payers"`       // Optional; without it paid_by pays the whole amount
+	SplitType   string              `json:"split_type"`   // equal (default), exact, percentage, shares or itemized
+	SplitWith   []int               `json:"split_with"`   // User IDs to split with
+	SplitValues []SplitValue        `json:"split_values"` // Per-user values for non-equal splits
+	ExpenseDate string              `json:"expense_date"` // YYYY-MM-DD, defaults to today (or unchanged on update)
+	Category    string              `json:"category"`     // Built-in or group category, defaults to general (or unchanged on update)
+	Notes       *string             `json:"notes"`        // Left unchanged on update when omitted
+	Items       []ExpenseItem       `json:"items"`        // Line items for itemized splits; amount may then be omitted
+	Adjustments *ExpenseAdjustments `json:"adjustments"`  // Optional charges for itemized splits
+}
+
+// Recurring expense frequencies
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+	FrequencyCustom  = "custom"
+)
+
+// RecurringExpense is a template the scheduler turns into a real expense on
+// every occurrence
+type RecurringExpense struct {
+	ID             int                  `json:"id"`
+	GroupID        int                  `json:"group_id"`
+	CreatedBy      int                  `json:"created_by"`
+	Template       CreateExpenseRequest `json:"template"`
+	Frequency      string               `json:"frequency"`
+	Interval       int                  `json:"interval"`
+	Rule           string               `json:"rule,omitempty"`
+	StartDate      time.Time            `json:"start_date"`
+	EndDate        *time.Time           `json:"end_date,omitempty"`
+	MaxOccurrences *int                 `json:"max_occurrences,omitempty"`
+	Occurrences    int                  `json:"occurrences"`         // Posted and skipped so far
+	NextDate       *time.Time           `json:"next_date,omitempty"` // Unset once the series has ended
+	Paused         bool                 `json:"paused"`
+	LastError      string               `json:"last_error,omitempty"` // Why the scheduler paused the series, or is retrying it
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+type RecurringExpenseRequest struct {
+	Template       CreateExpenseRequest `json:"template"`        // group_id and expense_date are ignored
+	Frequency      string               `json:"frequency"`       // daily, weekly, monthly, yearly or custom
+	Interval       int                  `json:"interval"`        // Every N days, weeks, months or years; defaults to 1
+	Rule           string               `json:"rule"`            // Custom only: "<day of month> <month> <day of week>", e.g. "1,15 * *"
+	StartDate      string               `json:"start_date"`      // YYYY-MM-DD, defaults to today
+	EndDate        string               `json:"end_date"`        // YYYY-MM-DD, optional and inclusive
+	MaxOccurrences int                  `json:"max_occurrences"` // 0 means no limit
+}
+
+// ExpenseFilter narrows GetGroupExpenses. Zero values do not filter.
+type ExpenseFilter struct {
+	Category string
+	PaidBy   int
+	From     *time.Time // Inclusive
+	To       *time.Time // Inclusive
+	Search   string     // Matches description or notes
+}
+
+type Category struct {
+	ID      int    `json:"id,omitempty"`
+	GroupID int    `json:"group_id,omitempty"`
+	Name    string `json:"name"`
+	BuiltIn bool   `json:"built_in"`
+}
+
+type CreateCategoryRequest struct {
+	Name string `json:"name"`
+}
+
+type SplitValue struct {
+	UserID int     `json:"user_id"`
+	Value  float64 `json:"value"`
+}
+
+// PaymentStatusRequest carries the reason for rejecting or disputing a
+// payment, or for how a dispute was resolved
+type PaymentStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ResolveDisputeRequest struct {
+	Upheld bool   `json:"upheld"` // True confirms the payment again, false rejects it
+	Reason string `json:"reason"`
 }
 
 type CreatePaymentConfirmationRequest struct {
-	GroupID  int     `json:"group_id"`
-	ToUserID int     `json:"to_user_id"`
-	Amount   float64 `json:"amount"`
-	SlipURL  string  `json:"slip_url"`
+	GroupID  int         `json:"group_id"`
+	ToUserID int         `json:"to_user_id"`
+	Amount   money.Money `json:"amount"`
+	Currency string      `json:"currency"` // Defaults to the group's base currency
+	SlipURL  string      `json:"slip_url"`
+	// AllowOverpayment records a payment of more than is outstanding, flagging
+	// the difference, instead of refusing it
+	AllowOverpayment bool `json:"allow_overpayment"`
+}
+
+// Payment request statuses
+const (
+	PaymentRequestOpen      = "open"
+	PaymentRequestPaid      = "paid"
+	PaymentRequestCancelled = "cancelled"
+)
+
+// PaymentRequest is a creditor asking for a suggested settlement to be paid
+// by a due date. It is closed when a matching payment is confirmed.
+type PaymentRequest struct {
+	ID                    int         `json:"id"`
+	GroupID               int         `json:"group_id"`
+	FromUserID            int         `json:"from_user_id"` // Who should pay
+	FromUserName          string      `json:"from_user_name,omitempty"`
+	ToUserID              int         `json:"to_user_id"` // Who asked to be paid
+	ToUserName            string      `json:"to_user_name,omitempty"`
+	Amount                money.Money `json:"amount"`
+	Currency              string      `json:"currency"`
+	DueDate               time.Time   `json:"due_date"`
+	Status                string      `json:"status"`
+	PaymentConfirmationID *int64      `json:"payment_confirmation_id,omitempty"` // The confirmed payment that closed it
+	RemindersSent         int         `json:"reminders_sent"`
+	LastRemindedAt        *time.Time  `json:"last_reminded_at,omitempty"`
+	CreatedAt             time.Time   `json:"created_at"`
+	ClosedAt              *time.Time  `json:"closed_at,omitempty"`
+}
+
+type CreatePaymentRequestRequest struct {
+	FromUserID int         `json:"from_user_id"`
+	Amount     money.Money `json:"amount"`   // Optional; defaults to the suggested settlement, and cannot exceed it
+	Currency   string      `json:"currency"` // Defaults to the group's base currency
+	DueDate    string      `json:"due_date"` // YYYY-MM-DD
 }
 
 type Friendship struct {
@@ -125,4 +648,26 @@ type Friendship struct {
 
 type AddFriendRequest struct {
 	FriendID int `json:"friend_id"`
-}
\ No newline at end of file
+}
+
+// Friend request statuses
+const (
+	FriendRequestPending   = "pending"
+	FriendRequestAccepted  = "accepted"
+	FriendRequestDeclined  = "declined"
+	FriendRequestCancelled = "cancelled"
+)
+
+type FriendRequest struct {
+	ID          int        `json:"id"`
+	FromUserID  int        `json:"from_user_id"`
+	ToUserID    int        `json:"to_user_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	User        *User      `json:"user,omitempty"` // The other party, set in request lists
+}
+
+type BlockUserRequest struct {
+	UserID int `json:"user_id"`
+}
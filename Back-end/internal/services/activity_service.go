@@ -0,0 +1,281 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultActivityLimit = 30
+	maxActivityLimit     = 100
+)
+
+// activityCondition picks the audit entries shown in the activity feed from
+// audit_log a. Purges are housekeeping, not something a member did.
+const activityCondition = `a.action != '` + models.AuditActionPurge + `'`
+
+// unreadActivity counts the feed entries in group g that member gm has not
+// seen. Queries using it join groups g, group_members gm and, with a LEFT
+// JOIN, the member's group_activity_seen s. A member's own changes are never
+// unread, and before they first open the feed only what happened since they
+// joined counts.
+const unreadActivity = `(
+	SELECT COUNT(*)
+	FROM audit_log a
+	WHERE a.group_id = g.id AND ` + activityCondition + `
+	AND a.actor_id IS DISTINCT FROM gm.user_id
+	AND a.id > COALESCE(s.last_seen_id, 0)
+	AND (s.last_seen_id IS NOT NULL OR a.created_at >= COALESCE(gm.joined_at, g.created_at))
+)`
+
+// ActivityService presents a group's audit log as a feed of what happened,
+// and tracks how far each member has read it
+type ActivityService struct {
+	db *sql.DB
+}
+
+func NewActivityService(db *sql.DB) *ActivityService {
+	return &ActivityService{db: db}
+}
+
+// GetFeed returns a page of the group's activity, newest first. cursor is the
+// NextCursor of the previous page, or empty for the newest items.
+func (s *ActivityService) GetFeed(groupID, userID int, cursor string, limit int) (*models.ActivityFeed, error) {
+	var before int64
+	if cursor != "" {
+		var err error
+		if before, err = strconv.ParseInt(cursor, 10, 64); err != nil || before <= 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+	if limit <= 0 || limit > maxActivityLimit {
+		limit = defaultActivityLimit
+	}
+
+	feed := &models.ActivityFeed{Items: []models.ActivityItem{}}
+	var lastSeen sql.NullInt64
+	var joinedAt time.Time
+	markerQuery := `
+		SELECT s.last_seen_id, COALESCE(gm.joined_at, g.created_at), ` + unreadActivity + `
+		FROM groups g
+		JOIN group_members gm ON gm.group_id = g.id
+		LEFT JOIN group_activity_seen s ON s.group_id = g.id AND s.user_id = gm.user_id
+		WHERE g.id = $1 AND gm.user_id = $2
+	`
+	err := s.db.QueryRow(markerQuery, groupID, userID).Scan(&lastSeen, &joinedAt, &feed.UnreadCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotGroupMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed.LastSeenID = lastSeen.Int64
+
+	query := `
+		SELECT a.id, a.actor_id, u.name, a.entity_type, a.entity_id, a.action,
+		       COALESCE(a.after, a.before), m.id, m.name, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_id = u.id
+		LEFT JOIN users m ON m.id = CASE a.entity_type
+			WHEN '` + models.AuditEntityMember + `' THEN a.entity_id
+			WHEN '` + models.AuditEntityPayment + `' THEN (COALESCE(a.after, a.before)->>'to_user_id')::int
+		END
+		WHERE a.group_id = $1 AND ` + activityCondition + `
+	`
+	args := []any{groupID}
+
+	if before != 0 {
+		args = append(args, before)
+		query += fmt.Sprintf(" AND a.id < $%d", len(args))
+	}
+
+	// Fetch one extra row to learn whether there is another page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY a.id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var actorID, userIDCol sql.NullInt64
+		var actorName, userName sql.NullString
+		var snapshot []byte
+		if err := rows.Scan(
+			&entry.ID, &actorID, &actorName, &entry.EntityType, &entry.EntityID, &entry.Action,
+			&snapshot, &userIDCol, &userName, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		item, err := activityItem(entry, snapshot)
+		if err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if actorID.Valid {
+			item.ActorID = &actorID.Int64
+			item.ActorName = actorName.String
+		}
+		if userIDCol.Valid {
+			item.UserID = int(userIDCol.Int64)
+			item.UserName = userName.String
+		}
+		if item.Type == models.ActivityMemberRemoved && item.ActorID != nil && int(*item.ActorID) == entry.EntityID {
+			item.Type = models.ActivityMemberLeft
+		}
+
+		item.Unread = entry.ID > feed.LastSeenID &&
+			(item.ActorID == nil || int(*item.ActorID) != userID) &&
+			(lastSeen.Valid || !entry.CreatedAt.Before(joinedAt))
+
+		feed.Items = append(feed.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(feed.Items) > limit {
+		feed.Items = feed.Items[:limit]
+		feed.NextCursor = strconv.FormatInt(feed.Items[limit-1].ID, 10)
+	}
+
+	return feed, nil
+}
+
+// activityItem describes an audit entry from its snapshot: the state after
+// the change, or before it for deletions
+func activityItem(entry models.AuditEntry, snapshot []byte) (models.ActivityItem, error) {
+	item := models.ActivityItem{
+		ID:        entry.ID,
+		EntityID:  entry.EntityID,
+		CreatedAt: entry.CreatedAt,
+	}
+
+	switch entry.EntityType {
+	case models.AuditEntityExpense:
+		item.Type = map[string]string{
+			models.AuditActionCreate:  models.ActivityExpenseAdded,
+			models.AuditActionUpdate:  models.ActivityExpenseEdited,
+			models.AuditActionDelete:  models.ActivityExpenseDeleted,
+			models.AuditActionRestore: models.ActivityExpenseRestored,
+		}[entry.Action]
+
+		var expense struct {
+			Description string      `json:"description"`
+			Amount      money.Money `json:"amount"`
+			Currency    string      `json:"currency"`
+		}
+		if err := decodeSnapshot(snapshot, &expense); err != nil {
+			return item, err
+		}
+		item.Description = expense.Description
+		item.Amount = &expense.Amount
+		item.Currency = expense.Currency
+
+	case models.AuditEntityMember:
+		item.Type = map[string]string{
+			models.AuditActionCreate: models.ActivityMemberJoined,
+			models.AuditActionUpdate: models.ActivityRoleChanged,
+			models.AuditActionDelete: models.ActivityMemberRemoved,
+			models.AuditActionClaim:  models.ActivityGuestClaimed,
+		}[entry.Action]
+
+		var member models.AuditMember
+		if err := decodeSnapshot(snapshot, &member); err != nil {
+			return item, err
+		}
+		item.UserID = member.UserID
+		if entry.Action != models.AuditActionDelete {
+			item.Role = member.Role
+		}
+
+	case models.AuditEntityPayment:
+		item.Type = map[string]string{
+			models.AuditActionCreate:  models.ActivityPaymentSubmitted,
+			models.AuditActionConfirm: models.ActivityPaymentConfirmed,
+			models.AuditActionReject:  models.ActivityPaymentRejected,
+			models.AuditActionDispute: models.ActivityPaymentDisputed,
+			models.AuditActionResolve: models.ActivityDisputeResolved,
+		}[entry.Action]
+
+		var payment struct {
+			Amount   money.Money `json:"amount"`
+			Currency string      `json:"currency"`
+		}
+		if err := decodeSnapshot(snapshot, &payment); err != nil {
+			return item, err
+		}
+		item.Amount = &payment.Amount
+		item.Currency = payment.Currency
+
+	case models.AuditEntityGroup:
+		item.Type = map[string]string{
+			models.AuditActionDelete:  models.ActivityGroupDeleted,
+			models.AuditActionRestore: models.ActivityGroupRestored,
+		}[entry.Action]
+
+		var group struct {
+			Name string `json:"name"`
+		}
+		if err := decodeSnapshot(snapshot, &group); err != nil {
+			return item, err
+		}
+		item.Description = group.Name
+	}
+
+	// Fall back to the raw entry for anything added to the audit log later
+	if item.Type == "" {
+		item.Type = entry.EntityType + "_" + entry.Action
+	}
+	return item, nil
+}
+
+func decodeSnapshot(snapshot []byte, v any) error {
+	if snapshot == nil {
+		return nil
+	}
+	if err := json.Unmarshal(snapshot, v); err != nil {
+		return fmt.Errorf("failed to decode audit snapshot: %v", err)
+	}
+	return nil
+}
+
+// MarkSeen records that userID has read the group's feed up to activityID,
+// or up to the newest item when activityID is 0. The marker never moves
+// backwards.
+func (s *ActivityService) MarkSeen(groupID, userID int, activityID int64) (int64, error) {
+	if activityID <= 0 {
+		query := `SELECT COALESCE(MAX(a.id), 0) FROM audit_log a WHERE a.group_id = $1 AND ` + activityCondition
+		if err := s.db.QueryRow(query, groupID).Scan(&activityID); err != nil {
+			return 0, err
+		}
+	}
+
+	query := `
+		INSERT INTO group_activity_seen (group_id, user_id, last_seen_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO UPDATE
+		SET last_seen_id = GREATEST(group_activity_seen.last_seen_id, EXCLUDED.last_seen_id),
+		    seen_at = CURRENT_TIMESTAMP
+		RETURNING last_seen_id
+	`
+
+	var lastSeen int64
+	if err := s.db.QueryRow(query, groupID, userID, activityID).Scan(&lastSeen); err != nil {
+		return 0, fmt.Errorf("failed to mark activity seen: %v", err)
+	}
+	return lastSeen, nil
+}
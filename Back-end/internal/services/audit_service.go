@@ -0,0 +1,177 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expense-splitter/internal/models"
+	"fmt"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so snapshots can be read
+// inside the transaction that changes them
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// auditRecord is one change to write to the audit log. An actorID of 0 means
+// the change was made by the system.
+type auditRecord struct {
+	groupID    int
+	actorID    int
+	entityType string
+	entityID   int
+	action     string
+	before     any
+	after      any
+}
+
+// writeAudit appends r to the audit log. It must run in the same transaction
+// as the change it records so the log never disagrees with the data.
+func writeAudit(tx *sql.Tx, r auditRecord) error {
+	before, err := auditSnapshot(r.before)
+	if err != nil {
+		return err
+	}
+	after, err := auditSnapshot(r.after)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (group_id, actor_id, entity_type, entity_id, action, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	actor := sql.NullInt64{Int64: int64(r.actorID), Valid: r.actorID != 0}
+	if _, err := tx.Exec(query, r.groupID, actor, r.entityType, r.entityID, r.action, before, after); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+// writeMemberAudit records a change to userID's membership. An empty role
+// means the user was not a member before, or is not one after.
+func writeMemberAudit(tx *sql.Tx, groupID, actorID, userID int, action, beforeRole, afterRole string) error {
+	r := auditRecord{
+		groupID:    groupID,
+		actorID:    actorID,
+		entityType: models.AuditEntityMember,
+		entityID:   userID,
+		action:     action,
+	}
+	if beforeRole != "" {
+		r.before = models.AuditMember{UserID: userID, Role: beforeRole}
+	}
+	if afterRole != "" {
+		r.after = models.AuditMember{UserID: userID, Role: afterRole}
+	}
+	return writeAudit(tx, r)
+}
+
+func auditSnapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %v", err)
+	}
+	return data, nil
+}
+
+// AuditService reads the audit log. Entries are written by the services that
+// make the changes.
+type AuditService struct {
+	db *sql.DB
+}
+
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// GetGroupLog lists a group's audit entries, newest first
+func (s *AuditService) GetGroupLog(groupID int, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	query := `
+		SELECT a.id, a.group_id, a.actor_id, u.name, a.entity_type, a.entity_id, a.action, a.before, a.after, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_id = u.id
+		WHERE a.group_id = $1
+	`
+	args := []any{groupID}
+
+	if filter.EntityType != "" {
+		args = append(args, filter.EntityType)
+		query += fmt.Sprintf(" AND a.entity_type = $%d", len(args))
+	}
+	if filter.EntityID != 0 {
+		args = append(args, filter.EntityID)
+		query += fmt.Sprintf(" AND a.entity_id = $%d", len(args))
+	}
+	if filter.ActorID != 0 {
+		args = append(args, filter.ActorID)
+		query += fmt.Sprintf(" AND a.actor_id = $%d", len(args))
+	}
+	if filter.Before != 0 {
+		args = append(args, filter.Before)
+		query += fmt.Sprintf(" AND a.id < $%d", len(args))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditLimit {
+		limit = defaultAuditLimit
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY a.id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var actorID sql.NullInt64
+		var actorName sql.NullString
+		var before, after []byte
+
+		if err := rows.Scan(
+			&entry.ID, &entry.GroupID, &actorID, &actorName, &entry.EntityType, &entry.EntityID,
+			&entry.Action, &before, &after, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if actorID.Valid {
+			entry.ActorID = &actorID.Int64
+		}
+		if actorName.Valid {
+			entry.ActorName = actorName.String
+		}
+		if before != nil {
+			entry.Before = before
+		}
+		if after != nil {
+			entry.After = after
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetExpenseHistory lists every recorded version of an expense, newest first
+func (s *AuditService) GetExpenseHistory(groupID, expenseID int, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	filter.EntityType = models.AuditEntityExpense
+	filter.EntityID = expenseID
+	return s.GetGroupLog(groupID, filter)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"expense-splitter/internal/models"
+	"fmt"
+	"strings"
+)
+
+// DefaultCategory is used for expenses recorded without a category, and for
+// expenses whose custom category is deleted
+const DefaultCategory = "general"
+
+// BuiltInCategories are available in every group
+var BuiltInCategories = []string{
+	DefaultCategory,
+	"food",
+	"groceries",
+	"transport",
+	"accommodation",
+	"entertainment",
+	"shopping",
+	"utilities",
+	"rent",
+	"health",
+	"travel",
+	"other",
+}
+
+var (
+	ErrInvalidCategory  = errors.New("invalid category")
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("category already exists")
+)
+
+const maxCategoryLength = 50
+
+type CategoryService struct {
+	db *sql.DB
+}
+
+func NewCategoryService(db *sql.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+// NormalizeCategory trims and lower-cases a category name
+func NormalizeCategory(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func isBuiltInCategory(name string) bool {
+	for _, c := range BuiltInCategories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requireCategory checks that name is a built-in category or one of the
+// group's custom categories
+func requireCategory(db *sql.DB, groupID int, name string) error {
+	if isBuiltInCategory(name) {
+		return nil
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM group_categories WHERE group_id = $1 AND name = $2)`
+	if err := db.QueryRow(query, groupID, name).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %q", ErrInvalidCategory, name)
+	}
+	return nil
+}
+
+// GetCategories lists the built-in categories followed by the group's own
+func (s *CategoryService) GetCategories(groupID int) ([]models.Category, error) {
+	categories := make([]models.Category, 0, len(BuiltInCategories))
+	for _, name := range BuiltInCategories {
+		categories = append(categories, models.Category{Name: name, BuiltIn: true})
+	}
+
+	query := `
+		SELECT id, group_id, name
+		FROM group_categories
+		WHERE group_id = $1
+		ORDER BY name
+	`
+
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(&category.ID, &category.GroupID, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+func (s *CategoryService) CreateCategory(groupID, createdBy int, name string) (*models.Category, error) {
+	name = NormalizeCategory(name)
+	if name == "" || len(name) > maxCategoryLength {
+		return nil, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidCategory, maxCategoryLength)
+	}
+	if isBuiltInCategory(name) {
+		return nil, ErrCategoryExists
+	}
+
+	query := `
+		INSERT INTO group_categories (group_id, name, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, name) DO NOTHING
+		RETURNING id
+	`
+
+	category := &models.Category{GroupID: groupID, Name: name}
+	err := s.db.QueryRow(query, groupID, name, createdBy).Scan(&category.ID)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %v", err)
+	}
+
+	return category, nil
+}
+
+// DeleteCategory removes a custom category and moves its expenses to
+// DefaultCategory, recording the move of each expense in the audit log
+func (s *CategoryService) DeleteCategory(groupID, categoryID, actorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow("DELETE FROM group_categories WHERE id = $1 AND group_id = $2 RETURNING name", categoryID, groupID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("UPDATE expenses SET category = $1 WHERE group_id = $2 AND category = $3 RETURNING id", DefaultCategory, groupID, name)
+	if err != nil {
+		return err
+	}
+	var moved []int
+	for rows.Next() {
+		var expenseID int
+		if err := rows.Scan(&expenseID); err != nil {
+			rows.Close()
+			return err
+		}
+		moved = append(moved, expenseID)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	for _, expenseID := range moved {
+		after, err := loadExpense(tx, expenseID)
+		if err != nil {
+			return err
+		}
+		before := *after
+		before.Category = name
+
+		if err := writeAudit(tx, auditRecord{
+			groupID:    groupID,
+			actorID:    actorID,
+			entityType: models.AuditEntityExpense,
+			entityID:   expenseID,
+			action:     models.AuditActionUpdate,
+			before:     &before,
+			after:      after,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrExchangeRateNotFound = errors.New("exchange rate not found")
+
+// ecbBaseCurrency is the currency every rate in an ECB reference file is quoted against
+const ecbBaseCurrency = "EUR"
+
+type ExchangeRateService struct {
+	db *sql.DB
+}
+
+func NewExchangeRateService(db *sql.DB) *ExchangeRateService {
+	return &ExchangeRateService{db: db}
+}
+
+// GetRate returns how many units of `to` one unit of `from` was worth on the
+// given day, using the most recent stored rate on or before it. Besides a
+// direct pair it will use the inverse pair or cross through a common base
+// currency, which is how ECB files (everything quoted against EUR) are used.
+func (s *ExchangeRateService) GetRate(from, to string, on time.Time) (money.Rate, error) {
+	if from == to {
+		return money.OneRate(), nil
+	}
+
+	directQuery := `
+		SELECT rate FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND rate_date <= $3
+		ORDER BY rate_date DESC
+		LIMIT 1
+	`
+
+	var rate money.Rate
+	err := s.db.QueryRow(directQuery, from, to, on).Scan(&rate)
+	if err == nil {
+		return rate, nil
+	}
+	if err != sql.ErrNoRows {
+		return money.Rate{}, err
+	}
+
+	err = s.db.QueryRow(directQuery, to, from, on).Scan(&rate)
+	if err == nil {
+		return rate.Inverse(), nil
+	}
+	if err != sql.ErrNoRows {
+		return money.Rate{}, err
+	}
+
+	crossQuery := `
+		SELECT a.rate, b.rate
+		FROM exchange_rates a
+		JOIN exchange_rates b ON a.base_currency = b.base_currency AND a.rate_date = b.rate_date
+		WHERE a.quote_currency = $1 AND b.quote_currency = $2 AND a.rate_date <= $3
+		ORDER BY a.rate_date DESC
+		LIMIT 1
+	`
+
+	var fromRate, toRate money.Rate
+	err = s.db.QueryRow(crossQuery, from, to, on).Scan(&fromRate, &toRate)
+	if err == sql.ErrNoRows {
+		return money.Rate{}, fmt.Errorf("%w: %s to %s on %s", ErrExchangeRateNotFound, from, to, on.Format("2006-01-02"))
+	}
+	if err != nil {
+		return money.Rate{}, err
+	}
+
+	return fromRate.Inverse().Mul(toRate), nil
+}
+
+// SaveRates inserts the rates, replacing any already stored for the same pair and day
+func (s *ExchangeRateService) SaveRates(rates []models.ExchangeRate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO exchange_rates (base_currency, quote_currency, rate, rate_date, source)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (base_currency, quote_currency, rate_date)
+		DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source
+	`
+	for _, rate := range rates {
+		if _, err := tx.Exec(query, rate.BaseCurrency, rate.QuoteCurrency, rate.Rate, rate.RateDate, rate.Source); err != nil {
+			return fmt.Errorf("failed to save exchange rate: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportFile loads a .csv or ECB-style .xml file into exchange_rates and
+// returns the number of rates stored
+func (s *ExchangeRateService) ImportFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	source := filepath.Base(path)
+
+	var rates []models.ExchangeRate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rates, err = ParseRatesCSV(f, source)
+	case ".xml":
+		rates, err = ParseRatesECBXML(f, source)
+	default:
+		return 0, fmt.Errorf("unsupported exchange rate file %q, expected .csv or .xml", path)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.SaveRates(rates); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// ParseRatesCSV reads rows of date,base,quote,rate. The header row is
+// required and may list the columns in any order.
+func ParseRatesCSV(r io.Reader, source string) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rate header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("exchange rate file is missing the %q column", name)
+		}
+	}
+
+	rates := []models.ExchangeRate{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		rate, err := newExchangeRate(
+			record[columns["base"]],
+			record[columns["quote"]],
+			record[columns["rate"]],
+			record[columns["date"]],
+			source,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ParseRatesECBXML reads the European Central Bank reference rate format
+// (eurofxref-daily.xml / eurofxref-hist.xml), where every rate is against EUR
+func ParseRatesECBXML(r io.Reader, source string) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rate XML: %v", err)
+	}
+
+	rates := []models.ExchangeRate{}
+	for _, day := range envelope.Cube.Days {
+		for _, cube := range day.Rates {
+			rate, err := newExchangeRate(ecbBaseCurrency, cube.Currency, cube.Rate, day.Time, source)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", day.Time, cube.Currency, err)
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+func newExchangeRate(base, quote, rate, date, source string) (models.ExchangeRate, error) {
+	baseCurrency, err := money.NormalizeCurrency(base)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	quoteCurrency, err := money.NormalizeCurrency(quote)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	parsedRate, err := money.ParseRate(rate)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	// Rates are stored to RateDecimals places, and one that rounds to
+	// zero there would convert everything to nothing
+	if parsedRate, err = parsedRate.Rounded(); err != nil {
+		return models.ExchangeRate{}, err
+	}
+	rateDate, err := time.Parse("2006-01-02", strings.TrimSpace(date))
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("invalid date %q", date)
+	}
+
+	return models.ExchangeRate{
+		BaseCurrency:  baseCurrency,
+		QuoteCurrency: quoteCurrency,
+		Rate:          parsedRate,
+		RateDate:      rateDate,
+		Source:        source,
+	}, nil
+}
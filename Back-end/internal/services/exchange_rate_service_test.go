@@ -0,0 +1,115 @@
+package services
+
+import (
+	"expense-splitter/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rateLines formats rates as "date base quote rate source" for comparison
+func rateLines(rates []models.ExchangeRate) []string {
+	lines := make([]string, len(rates))
+	for i, r := range rates {
+		lines[i] = strings.Join([]string{r.RateDate.Format("2006-01-02"), r.BaseCurrency, r.QuoteCurrency, r.Rate.String(), r.Source}, " ")
+	}
+	return lines
+}
+
+func TestParseRatesCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "rows",
+			in:   "date,base,quote,rate\n2024-01-02,USD,THB,34.25\n2024-01-02,eur,thb,37.5\n",
+			want: []string{"2024-01-02 USD THB 34.25 test", "2024-01-02 EUR THB 37.5 test"},
+		},
+		{
+			name: "columns in any order",
+			in:   "Rate, Quote, Base, Date\n34.25, THB, USD, 2024-01-02\n",
+			want: []string{"2024-01-02 USD THB 34.25 test"},
+		},
+		{name: "header only", in: "date,base,quote,rate\n", want: []string{}},
+		{name: "empty", in: "", wantErr: true},
+		{name: "missing column", in: "date,base,quote\n2024-01-02,USD,THB\n", wantErr: true},
+		{name: "short row", in: "date,base,quote,rate\n2024-01-02,USD,THB\n", wantErr: true},
+		{name: "bad currency", in: "date,base,quote,rate\n2024-01-02,DOLLAR,THB,34.25\n", wantErr: true},
+		{name: "bad rate", in: "date,base,quote,rate\n2024-01-02,USD,THB,0\n", wantErr: true},
+		{name: "rate rounding to zero", in: "date,base,quote,rate\n2024-01-02,IDR,USD,0.000000001\n", wantErr: true},
+		{name: "rate rounded to storage", in: "date,base,quote,rate\n2024-01-02,USD,THB,34.123456789\n", want: []string{"2024-01-02 USD THB 34.12345679 test"}},
+		{name: "bad date", in: "date,base,quote,rate\n02/01/2024,USD,THB,34.25\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRatesCSV(strings.NewReader(tt.in), "test")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRatesCSV() = %v, want an error", rateLines(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRatesCSV() error = %v", err)
+			}
+			if !slices.Equal(rateLines(got), tt.want) {
+				t.Errorf("ParseRatesCSV() = %v, want %v", rateLines(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRatesECBXML(t *testing.T) {
+	const daily = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+			<Cube currency="THB" rate="37.631"/>
+		</Cube>
+		<Cube time="2024-01-01">
+			<Cube currency="USD" rate="1.1039"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "daily rates",
+			in:   daily,
+			want: []string{"2024-01-02 EUR USD 1.0956 ecb", "2024-01-02 EUR THB 37.631 ecb", "2024-01-01 EUR USD 1.1039 ecb"},
+		},
+		{name: "no rates", in: `<Envelope><Cube></Cube></Envelope>`, want: []string{}},
+		{name: "not XML", in: "date,base,quote,rate", wantErr: true},
+		{name: "bad rate", in: `<Envelope><Cube><Cube time="2024-01-02"><Cube currency="USD" rate="x"/></Cube></Cube></Envelope>`, wantErr: true},
+		{name: "bad date", in: `<Envelope><Cube><Cube time="yesterday"><Cube currency="USD" rate="1.1"/></Cube></Cube></Envelope>`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRatesECBXML(strings.NewReader(tt.in), "ecb")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRatesECBXML() = %v, want an error", rateLines(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRatesECBXML() error = %v", err)
+			}
+			if !slices.Equal(rateLines(got), tt.want) {
+				t.Errorf("ParseRatesECBXML() = %v, want %v", rateLines(got), tt.want)
+			}
+		})
+	}
+}
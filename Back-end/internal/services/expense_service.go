@@ -2,96 +2,402 @@ package services
 
 import (
 	"database/sql"
+	"errors"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/mail"
 	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
 	"fmt"
 	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrExpenseNotFound    = errors.New("expense not found")
+	ErrPaymentNotFound    = errors.New("payment confirmation not found")
+	ErrInvalidExpenseDate = errors.New("expense_date must be a YYYY-MM-DD date")
 )
 
+// expenseDateLayout is the format of CreateExpenseRequest.ExpenseDate
+const expenseDateLayout = "2006-01-02"
+
+// expenseColumns are the columns scanExpense reads, from expenses e joined
+// with the payer as users u
+const expenseColumns = `e.id, e.group_id, e.description, e.amount, e.currency, e.exchange_rate, e.paid_by, u.name,
+		e.split_type, e.expense_date, e.category, e.notes, e.created_at,
+		e.discount, e.service_charge_percent, e.tax_percent, e.tip`
+
 type ExpenseService struct {
-	db *sql.DB
+	db           *sql.DB
+	groupService *GroupService
+	rateService  *ExchangeRateService
+	events       events.Publisher
+}
+
+func NewExpenseService(db *sql.DB, groupService *GroupService, rateService *ExchangeRateService, publisher events.Publisher) *ExpenseService {
+	return &ExpenseService{db: db, groupService: groupService, rateService: rateService, events: publisher}
+}
+
+// GetExpenseGroupID returns the group an expense belongs to, for
+// authorization. Expenses in the trash are not found.
+func (s *ExpenseService) GetExpenseGroupID(expenseID int) (int, error) {
+	var groupID int
+	err := s.db.QueryRow("SELECT group_id FROM expenses WHERE id = $1 AND deleted_at IS NULL", expenseID).Scan(&groupID)
+	if err == sql.ErrNoRows {
+		return 0, ErrExpenseNotFound
+	}
+	return groupID, err
+}
+
+// GetPaymentConfirmationGroupID returns the group a payment confirmation belongs to, for authorization
+func (s *ExpenseService) GetPaymentConfirmationGroupID(confirmationID int) (int, error) {
+	var groupID int
+	err := s.db.QueryRow("SELECT group_id FROM payment_confirmations WHERE id = $1", confirmationID).Scan(&groupID)
+	if err == sql.ErrNoRows {
+		return 0, ErrPaymentNotFound
+	}
+	return groupID, err
+}
+
+// requireSplitParticipants checks that the payers and everyone in splits belong to the group
+func (s *ExpenseService) requireSplitParticipants(groupID int, payers []models.ExpensePayer, splits []models.Split) error {
+	return s.groupService.RequireParticipants(groupID, splitParticipants(payers, splits))
 }
 
-func NewExpenseService(db *sql.DB) *ExpenseService {
-	return &ExpenseService{db: db}
+// splitParticipants lists the payers and everyone in splits
+func splitParticipants(payers []models.ExpensePayer, splits []models.Split) []int {
+	userIDs := []int{}
+	for _, payer := range payers {
+		userIDs = append(userIDs, payer.UserID)
+	}
+	for _, split := range splits {
+		userIDs = append(userIDs, split.UserID)
+	}
+	return userIDs
+}
+
+// resolveCurrency returns the currency to record (the group's base currency
+// when none is given) and its rate to the base currency on the given day,
+// rounded to the precision it is stored with
+func (s *ExpenseService) resolveCurrency(groupID int, currency string, on time.Time) (string, money.Rate, error) {
+	var baseCurrency string
+	if err := s.db.QueryRow("SELECT base_currency FROM groups WHERE id = $1", groupID).Scan(&baseCurrency); err != nil {
+		return "", money.Rate{}, fmt.Errorf("group not found: %v", err)
+	}
+	if currency == "" {
+		currency = baseCurrency
+	}
+
+	rate, err := s.rateService.GetRate(currency, baseCurrency, on)
+	if err != nil {
+		return "", money.Rate{}, err
+	}
+	rounded, err := rate.Rounded()
+	if err != nil {
+		return "", money.Rate{}, fmt.Errorf("%s to %s: %w", currency, baseCurrency, err)
+	}
+	return currency, rounded, nil
 }
 
-func (s *ExpenseService) CreateExpense(groupID int, description string, amount float64, paidBy int, splitWith []int) (*models.Expense, error) {
+// parseExpenseDate parses a YYYY-MM-DD date, returning fallback when value
+// is empty
+func parseExpenseDate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	date, err := time.Parse(expenseDateLayout, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidExpenseDate
+	}
+	return date, nil
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// buildSplits returns the amount and splits of the expense described by req.
+// Itemized expenses take their amount from the items, so req.Amount is only
+// checked against it when given.
+func buildSplits(req models.CreateExpenseRequest, splitType string) (money.Money, []models.Split, models.ExpenseAdjustments, error) {
+	if splitType != models.SplitItemized {
+		splits, err := computeSplits(req.Amount, splitType, req.SplitWith, req.SplitValues)
+		return req.Amount, splits, models.ExpenseAdjustments{}, err
+	}
+
+	total, splits, err := computeItemizedSplits(req.Items, req.Adjustments)
+	if err != nil {
+		return 0, nil, models.ExpenseAdjustments{}, err
+	}
+	if req.Amount != 0 && req.Amount != total {
+		return 0, nil, models.ExpenseAdjustments{}, fmt.Errorf("%w: items add up to %s but the expense is %s", ErrInvalidSplit, total, req.Amount)
+	}
+
+	adj := models.ExpenseAdjustments{}
+	if req.Adjustments != nil {
+		adj = *req.Adjustments
+	}
+	return total, splits, adj, nil
+}
+
+func (s *ExpenseService) CreateExpense(req models.CreateExpenseRequest, actorID int) (*models.Expense, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
+	expense, err := s.createExpense(tx, req, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(events.New(events.ExpenseCreated, expense.GroupID, expense.ID, actorID, expense))
+	return expense, nil
+}
+
+// createExpense validates req and records the expense inside tx, so callers
+// can create it atomically with their own changes. An actorID of 0 records
+// the expense as created by the system.
+func (s *ExpenseService) createExpense(tx *sql.Tx, req models.CreateExpenseRequest, actorID int) (*models.Expense, error) {
+	splitType := normalizeSplitType(req.SplitType)
+	amount, splits, adj, err := buildSplits(req, splitType)
+	if err != nil {
+		return nil, err
+	}
+
+	expenseDate, err := parseExpenseDate(req.ExpenseDate, today())
+	if err != nil {
+		return nil, err
+	}
+
+	category := NormalizeCategory(req.Category)
+	if category == "" {
+		category = DefaultCategory
+	}
+	if err := requireCategory(s.db, req.GroupID, category); err != nil {
+		return nil, err
+	}
+
+	notes := ""
+	if req.Notes != nil {
+		notes = *req.Notes
+	}
+
+	payers, paidBy, err := computePayers(req.PaidBy, req.Payers, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requireSplitParticipants(req.GroupID, payers, splits); err != nil {
+		return nil, err
+	}
+
+	currency, rate, err := s.resolveCurrency(req.GroupID, req.Currency, expenseDate)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create expense
 	query := `
-		INSERT INTO expenses (group_id, description, amount, paid_by)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, group_id, description, amount, paid_by, created_at
+		INSERT INTO expenses (group_id, description, amount, currency, exchange_rate, paid_by, split_type, expense_date, category, notes,
+		                      discount, service_charge_percent, tax_percent, tip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
 	`
 
+	var expenseID int
+	err = tx.QueryRow(query, req.GroupID, req.Description, amount, currency, rate, paidBy, splitType,
+		expenseDate, category, notes, adj.Discount, adj.ServiceChargePercent, adj.TaxPercent, adj.Tip).Scan(&expenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create expense: %v", err)
+	}
+
+	// Create payers and splits
+	if err := insertPayers(tx, expenseID, payers); err != nil {
+		return nil, err
+	}
+	if err := insertSplits(tx, expenseID, splits); err != nil {
+		return nil, err
+	}
+	if splitType == models.SplitItemized {
+		if err := insertItems(tx, expenseID, req.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	expense, err := loadExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    expense.GroupID,
+		actorID:    actorID,
+		entityType: models.AuditEntityExpense,
+		entityID:   expense.ID,
+		action:     models.AuditActionCreate,
+		after:      expense,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := notifyExpense(tx, models.NotificationExpenseAdded, actorID, expense); err != nil {
+		return nil, err
+	}
+
+	return expense, nil
+}
+
+// scanExpense reads a row selected with expenseColumns
+func scanExpense(row interface{ Scan(...any) error }) (*models.Expense, error) {
 	expense := &models.Expense{}
-	err = tx.QueryRow(query, groupID, description, amount, paidBy).Scan(
+	adj := &models.ExpenseAdjustments{}
+	if err := row.Scan(
 		&expense.ID,
 		&expense.GroupID,
 		&expense.Description,
 		&expense.Amount,
+		&expense.Currency,
+		&expense.ExchangeRate,
 		&expense.PaidBy,
+		&expense.PaidByName,
+		&expense.SplitType,
+		&expense.ExpenseDate,
+		&expense.Category,
+		&expense.Notes,
 		&expense.CreatedAt,
-	)
+		&adj.Discount,
+		&adj.ServiceChargePercent,
+		&adj.TaxPercent,
+		&adj.Tip,
+	); err != nil {
+		return nil, err
+	}
+	expense.BaseAmount = expense.Amount.Convert(expense.ExchangeRate)
+	if expense.SplitType == models.SplitItemized {
+		expense.Adjustments = adj
+	}
+	return expense, nil
+}
+
+func (s *ExpenseService) GetExpense(expenseID int) (*models.Expense, error) {
+	return loadExpense(s.db, expenseID)
+}
+
+// loadExpense reads an expense with its payers, splits and items through q
+func loadExpense(q queryer, expenseID int) (*models.Expense, error) {
+	query := `
+		SELECT ` + expenseColumns + `
+		FROM expenses e
+		JOIN users u ON e.paid_by = u.id
+		WHERE e.id = $1
+	`
+
+	expense, err := scanExpense(q.QueryRow(query, expenseID))
+	if err == sql.ErrNoRows {
+		return nil, ErrExpenseNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create expense: %v", err)
+		return nil, err
+	}
+
+	if expense.Payers, err = getExpensePayers(q, expenseID); err != nil {
+		return nil, err
 	}
 
-	// Create splits
-	splitAmount := amount / float64(len(splitWith))
-	for _, userID := range splitWith {
-		splitQuery := `
-			INSERT INTO expense_splits (expense_id, user_id, amount)
-			VALUES ($1, $2, $3)
-		`
-		if _, err := tx.Exec(splitQuery, expense.ID, userID, splitAmount); err != nil {
-			return nil, fmt.Errorf("failed to create split: %v", err)
+	splits, err := getExpenseSplits(q, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	expense.Splits = splits
+
+	if expense.SplitType == models.SplitItemized {
+		if expense.Items, err = getExpenseItems(q, expenseID); err != nil {
+			return nil, err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	return expense, nil
+}
+
+func getExpenseItems(q queryer, expenseID int) ([]models.ExpenseItem, error) {
+	query := `
+		SELECT i.id, i.name, i.amount, COALESCE(array_agg(c.user_id ORDER BY c.user_id) FILTER (WHERE c.user_id IS NOT NULL), '{}')
+		FROM expense_items i
+		LEFT JOIN expense_item_consumers c ON c.item_id = i.id
+		WHERE i.expense_id = $1
+		GROUP BY i.id
+		ORDER BY i.position
+	`
+
+	rows, err := q.Query(query, expenseID)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	items := []models.ExpenseItem{}
+	for rows.Next() {
+		var item models.ExpenseItem
+		var consumers pq.Int64Array
+		if err := rows.Scan(&item.ID, &item.Name, &item.Amount, &consumers); err != nil {
+			return nil, err
+		}
+		item.Consumers = make([]int, len(consumers))
+		for i, id := range consumers {
+			item.Consumers[i] = int(id)
+		}
+		items = append(items, item)
+	}
 
-	return s.GetExpense(expense.ID)
+	return items, rows.Err()
 }
 
-func (s *ExpenseService) GetExpense(expenseID int) (*models.Expense, error) {
+func getExpensePayers(q queryer, expenseID int) ([]models.ExpensePayer, error) {
 	query := `
-		SELECT e.id, e.group_id, e.description, e.amount, e.paid_by, u.name, e.created_at
-		FROM expenses e
-		JOIN users u ON e.paid_by = u.id
-		WHERE e.id = $1
+		SELECT ep.user_id, u.name, ep.amount
+		FROM expense_payers ep
+		JOIN users u ON ep.user_id = u.id
+		WHERE ep.expense_id = $1
+		ORDER BY ep.amount DESC, ep.user_id
 	`
 
-	expense := &models.Expense{}
-	err := s.db.QueryRow(query, expenseID).Scan(
-		&expense.ID,
-		&expense.GroupID,
-		&expense.Description,
-		&expense.Amount,
-		&expense.PaidBy,
-		&expense.PaidByName,
-		&expense.CreatedAt,
-	)
+	rows, err := q.Query(query, expenseID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	payers := []models.ExpensePayer{}
+	for rows.Next() {
+		var payer models.ExpensePayer
+		if err := rows.Scan(&payer.UserID, &payer.UserName, &payer.Amount); err != nil {
+			return nil, err
+		}
+		payers = append(payers, payer)
+	}
 
-	// Get splits
-	splitsQuery := `
-		SELECT es.id, es.expense_id, es.user_id, u.name, es.amount
+	return payers, rows.Err()
+}
+
+func getExpenseSplits(q queryer, expenseID int) ([]models.Split, error) {
+	query := `
+		SELECT es.id, es.expense_id, es.user_id, u.name, es.amount, es.value
 		FROM expense_splits es
 		JOIN users u ON es.user_id = u.id
 		WHERE es.expense_id = $1
+		ORDER BY es.id
 	`
 
-	rows, err := s.db.Query(splitsQuery, expenseID)
+	rows, err := q.Query(query, expenseID)
 	if err != nil {
 		return nil, err
 	}
@@ -100,26 +406,53 @@ func (s *ExpenseService) GetExpense(expenseID int) (*models.Expense, error) {
 	splits := []models.Split{}
 	for rows.Next() {
 		var split models.Split
-		if err := rows.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.UserName, &split.Amount); err != nil {
+		var value sql.NullFloat64
+		if err := rows.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.UserName, &split.Amount, &value); err != nil {
 			return nil, err
 		}
+		if value.Valid {
+			split.Value = &value.Float64
+		}
 		splits = append(splits, split)
 	}
 
-	expense.Splits = splits
-	return expense, nil
+	return splits, rows.Err()
 }
 
-func (s *ExpenseService) GetGroupExpenses(groupID int) ([]models.Expense, error) {
+// GetGroupExpenses lists a group's expenses, newest expense date first,
+// narrowed by filter
+func (s *ExpenseService) GetGroupExpenses(groupID int, filter models.ExpenseFilter) ([]models.Expense, error) {
 	query := `
-		SELECT e.id, e.group_id, e.description, e.amount, e.paid_by, u.name, e.created_at
+		SELECT ` + expenseColumns + `
 		FROM expenses e
 		JOIN users u ON e.paid_by = u.id
-		WHERE e.group_id = $1
-		ORDER BY e.created_at DESC
+		WHERE e.group_id = $1 AND e.deleted_at IS NULL
 	`
+	args := []any{groupID}
 
-	rows, err := s.db.Query(query, groupID)
+	if filter.Category != "" {
+		args = append(args, NormalizeCategory(filter.Category))
+		query += fmt.Sprintf(" AND e.category = $%d", len(args))
+	}
+	if filter.PaidBy != 0 {
+		args = append(args, filter.PaidBy)
+		query += fmt.Sprintf(" AND e.paid_by = $%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND e.expense_date >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND e.expense_date <= $%d", len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		query += fmt.Sprintf(" AND (e.description ILIKE $%[1]d OR e.notes ILIKE $%[1]d)", len(args))
+	}
+	query += " ORDER BY e.expense_date DESC, e.created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -127,161 +460,507 @@ func (s *ExpenseService) GetGroupExpenses(groupID int) ([]models.Expense, error)
 
 	expenses := []models.Expense{}
 	for rows.Next() {
-		var expense models.Expense
-		if err := rows.Scan(
-			&expense.ID,
-			&expense.GroupID,
-			&expense.Description,
-			&expense.Amount,
-			&expense.PaidBy,
-			&expense.PaidByName,
-			&expense.CreatedAt,
-		); err != nil {
+		expense, err := scanExpense(rows)
+		if err != nil {
 			return nil, err
 		}
+		expenses = append(expenses, *expense)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		// Get splits for this expense
-		splitsQuery := `
-			SELECT es.id, es.expense_id, es.user_id, u.name, es.amount
-			FROM expense_splits es
-			JOIN users u ON es.user_id = u.id
-			WHERE es.expense_id = $1
-		`
-
-		splitRows, err := s.db.Query(splitsQuery, expense.ID)
+	// Get splits for each expense
+	for i := range expenses {
+		splits, err := getExpenseSplits(s.db, expenses[i].ID)
 		if err != nil {
 			return nil, err
 		}
+		expenses[i].Splits = splits
+
+		if expenses[i].Payers, err = getExpensePayers(s.db, expenses[i].ID); err != nil {
+			return nil, err
+		}
 
-		splits := []models.Split{}
-		for splitRows.Next() {
-			var split models.Split
-			if err := splitRows.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.UserName, &split.Amount); err != nil {
-				splitRows.Close()
+		if expenses[i].SplitType == models.SplitItemized {
+			if expenses[i].Items, err = getExpenseItems(s.db, expenses[i].ID); err != nil {
 				return nil, err
 			}
-			splits = append(splits, split)
 		}
-		splitRows.Close()
-
-		expense.Splits = splits
-		expenses = append(expenses, expense)
 	}
 
 	return expenses, nil
 }
 
-func (s *ExpenseService) UpdateExpense(expenseID int, description string, amount float64, paidBy int, splitWith []int) (*models.Expense, error) {
+func (s *ExpenseService) UpdateExpense(expenseID int, req models.CreateExpenseRequest, actorID int) (*models.Expense, error) {
+	splitType := normalizeSplitType(req.SplitType)
+	amount, splits, adj, err := buildSplits(req, splitType)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
+	before, err := lockExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the rate recorded with the expense unless its currency or date changes
+	groupID := before.GroupID
+	currency, rate, storedDate := before.Currency, before.ExchangeRate, before.ExpenseDate
+	category, notes := before.Category, before.Notes
+
+	expenseDate, err := parseExpenseDate(req.ExpenseDate, storedDate)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Category != "" {
+		category = NormalizeCategory(req.Category)
+		if err := requireCategory(s.db, groupID, category); err != nil {
+			return nil, err
+		}
+	}
+	if req.Notes != nil {
+		notes = *req.Notes
+	}
+
+	payers, paidBy, err := computePayers(req.PaidBy, req.Payers, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requireSplitParticipants(groupID, payers, splits); err != nil {
+		return nil, err
+	}
+	if (req.Currency != "" && req.Currency != currency) || !expenseDate.Equal(storedDate) {
+		if req.Currency != "" {
+			currency = req.Currency
+		}
+		currency, rate, err = s.resolveCurrency(groupID, currency, expenseDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Update expense
 	query := `
 		UPDATE expenses
-		SET description = $1, amount = $2, paid_by = $3
-		WHERE id = $4
+		SET description = $1, amount = $2, currency = $3, exchange_rate = $4, paid_by = $5, split_type = $6,
+		    expense_date = $7, category = $8, notes = $9,
+		    discount = $10, service_charge_percent = $11, tax_percent = $12, tip = $13
+		WHERE id = $14
 	`
-	if _, err := tx.Exec(query, description, amount, paidBy, expenseID); err != nil {
+	if _, err := tx.Exec(query, req.Description, amount, currency, rate, paidBy, splitType,
+		expenseDate, category, notes, adj.Discount, adj.ServiceChargePercent, adj.TaxPercent, adj.Tip, expenseID); err != nil {
 		return nil, err
 	}
 
-	// Delete old splits
+	// Delete old payers, splits and items
+	if _, err := tx.Exec("DELETE FROM expense_payers WHERE expense_id = $1", expenseID); err != nil {
+		return nil, err
+	}
 	if _, err := tx.Exec("DELETE FROM expense_splits WHERE expense_id = $1", expenseID); err != nil {
 		return nil, err
 	}
+	if _, err := tx.Exec("DELETE FROM expense_items WHERE expense_id = $1", expenseID); err != nil {
+		return nil, err
+	}
 
-	// Create new splits
-	splitAmount := amount / float64(len(splitWith))
-	for _, userID := range splitWith {
-		splitQuery := `
-			INSERT INTO expense_splits (expense_id, user_id, amount)
-			VALUES ($1, $2, $3)
-		`
-		if _, err := tx.Exec(splitQuery, expenseID, userID, splitAmount); err != nil {
+	// Create new payers, splits and items
+	if err := insertPayers(tx, expenseID, payers); err != nil {
+		return nil, err
+	}
+	if err := insertSplits(tx, expenseID, splits); err != nil {
+		return nil, err
+	}
+	if splitType == models.SplitItemized {
+		if err := insertItems(tx, expenseID, req.Items); err != nil {
 			return nil, err
 		}
 	}
 
+	after, err := loadExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    actorID,
+		entityType: models.AuditEntityExpense,
+		entityID:   expenseID,
+		action:     models.AuditActionUpdate,
+		before:     before,
+		after:      after,
+	}); err != nil {
+		return nil, err
+	}
+
+	// People taken off the expense hear about it too
+	if err := notifyExpense(tx, models.NotificationExpenseUpdated, actorID, before, after); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return s.GetExpense(expenseID)
+	s.events.Publish(events.New(events.ExpenseUpdated, groupID, expenseID, actorID, after))
+	return after, nil
 }
 
-func (s *ExpenseService) DeleteExpense(expenseID int) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	_, err := s.db.Exec(query, expenseID)
-	return err
+// lockExpense locks an expense that is not in the trash for the rest of tx
+// and returns its current state
+func lockExpense(tx *sql.Tx, expenseID int) (*models.Expense, error) {
+	var locked int
+	err := tx.QueryRow("SELECT id FROM expenses WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", expenseID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, ErrExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loadExpense(tx, expenseID)
 }
 
-func (s *ExpenseService) CalculateSettlements(groupID int) ([]models.Settlement, []models.Balance, error) {
+func insertSplits(tx *sql.Tx, expenseID int, splits []models.Split) error {
+	query := `
+		INSERT INTO expense_splits (expense_id, user_id, amount, value)
+		VALUES ($1, $2, $3, $4)
+	`
+	for _, split := range splits {
+		if _, err := tx.Exec(query, expenseID, split.UserID, split.Amount, split.Value); err != nil {
+			return fmt.Errorf("failed to create split: %v", err)
+		}
+	}
+	return nil
+}
+
+func insertPayers(tx *sql.Tx, expenseID int, payers []models.ExpensePayer) error {
+	query := `
+		INSERT INTO expense_payers (expense_id, user_id, amount)
+		VALUES ($1, $2, $3)
+	`
+	for _, payer := range payers {
+		if _, err := tx.Exec(query, expenseID, payer.UserID, payer.Amount); err != nil {
+			return fmt.Errorf("failed to add payer: %v", err)
+		}
+	}
+	return nil
+}
+
+func insertItems(tx *sql.Tx, expenseID int, items []models.ExpenseItem) error {
+	itemQuery := `
+		INSERT INTO expense_items (expense_id, name, amount, position)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	consumerQuery := `
+		INSERT INTO expense_item_consumers (item_id, user_id)
+		SELECT $1, unnest($2::int[])
+	`
+	for i, item := range items {
+		var itemID int
+		if err := tx.QueryRow(itemQuery, expenseID, item.Name, item.Amount, i).Scan(&itemID); err != nil {
+			return fmt.Errorf("failed to create item: %v", err)
+		}
+		if _, err := tx.Exec(consumerQuery, itemID, pq.Array(item.Consumers)); err != nil {
+			return fmt.Errorf("failed to add item consumers: %v", err)
+		}
+	}
+	return nil
+}
+
+func normalizeSplitType(splitType string) string {
+	if splitType == "" {
+		return models.SplitEqual
+	}
+	return splitType
+}
+
+// DeleteExpense moves an expense to the group's trash, where it no longer
+// counts towards balances. TrashService restores or purges it.
+func (s *ExpenseService) DeleteExpense(expenseID, actorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockExpense(tx, expenseID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE expenses
+		SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1
+		WHERE id = $2
+	`
+	if _, err := tx.Exec(query, actorID, expenseID); err != nil {
+		return err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    before.GroupID,
+		actorID:    actorID,
+		entityType: models.AuditEntityExpense,
+		entityID:   expenseID,
+		action:     models.AuditActionDelete,
+		before:     before,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.ExpenseDeleted, before.GroupID, expenseID, actorID, nil))
+	return nil
+}
+
+// ledgerEntry moves amount from debtor to creditor: the creditor's balance
+// goes up and the debtor's goes down
+type ledgerEntry struct {
+	creditor int
+	debtor   int
+	amount   money.Money
+	currency string
+	rate     money.Rate // Rate to the group's base currency
+}
+
+// loadLedger returns every expense split and confirmed payment in a group as
+// ledger entries, along with user names and the group's base currency
+func (s *ExpenseService) loadLedger(groupID int) ([]ledgerEntry, map[int]string, string, error) {
+	var baseCurrency string
+	if err := s.db.QueryRow("SELECT base_currency FROM groups WHERE id = $1", groupID).Scan(&baseCurrency); err != nil {
+		return nil, nil, "", fmt.Errorf("group not found: %v", err)
+	}
+
+	nameMap := make(map[int]string)
+
+	// Get what everyone paid towards the group's expenses
+	payerQuery := `
+		SELECT ep.expense_id, ep.user_id, u.name, ep.amount
+		FROM expense_payers ep
+		JOIN expenses e ON e.id = ep.expense_id
+		JOIN users u ON ep.user_id = u.id
+		WHERE e.group_id = $1 AND e.deleted_at IS NULL
+		ORDER BY ep.expense_id, ep.user_id
+	`
+
+	payerRows, err := s.db.Query(payerQuery, groupID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer payerRows.Close()
+
+	payersByExpense := make(map[int][]models.ExpensePayer)
+	for payerRows.Next() {
+		var expenseID int
+		var payer models.ExpensePayer
+		if err := payerRows.Scan(&expenseID, &payer.UserID, &payer.UserName, &payer.Amount); err != nil {
+			return nil, nil, "", err
+		}
+		nameMap[payer.UserID] = payer.UserName
+		payersByExpense[expenseID] = append(payersByExpense[expenseID], payer)
+	}
+	if err := payerRows.Err(); err != nil {
+		return nil, nil, "", err
+	}
+
 	// Get all expenses and splits for the group
 	query := `
-		SELECT e.paid_by, es.user_id, es.amount, u1.name as paid_by_name, u2.name as user_name
+		SELECT e.id, e.currency, e.exchange_rate, es.user_id, u.name, es.amount
 		FROM expenses e
 		JOIN expense_splits es ON e.id = es.expense_id
-		JOIN users u1 ON e.paid_by = u1.id
-		JOIN users u2 ON es.user_id = u2.id
-		WHERE e.group_id = $1
+		JOIN users u ON es.user_id = u.id
+		WHERE e.group_id = $1 AND e.deleted_at IS NULL
+		ORDER BY e.id, es.id
 	`
 
 	rows, err := s.db.Query(query, groupID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", err
 	}
 	defer rows.Close()
 
-	// Calculate balances: positive = owed to them, negative = they owe
-	balanceMap := make(map[int]float64)
-	nameMap := make(map[int]string)
+	type expenseSplits struct {
+		id       int
+		currency string
+		rate     money.Rate
+		splits   []models.Split
+	}
+	expenses := []*expenseSplits{}
 
 	for rows.Next() {
-		var paidBy, userID int
-		var amount float64
-		var paidByName, userName string
+		var expenseID int
+		var currency string
+		var rate money.Rate
+		var split models.Split
 
-		if err := rows.Scan(&paidBy, &userID, &amount, &paidByName, &userName); err != nil {
-			return nil, nil, err
+		if err := rows.Scan(&expenseID, &currency, &rate, &split.UserID, &split.UserName, &split.Amount); err != nil {
+			return nil, nil, "", err
 		}
 
-		nameMap[paidBy] = paidByName
-		nameMap[userID] = userName
+		if len(expenses) == 0 || expenses[len(expenses)-1].id != expenseID {
+			expenses = append(expenses, &expenseSplits{id: expenseID, currency: currency, rate: rate})
+		}
+		current := expenses[len(expenses)-1]
+		current.splits = append(current.splits, split)
+		nameMap[split.UserID] = split.UserName
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, "", err
+	}
 
-		// Person who paid gets positive balance
-		balanceMap[paidBy] += amount
-		// Person who owes gets negative balance
-		balanceMap[userID] -= amount
+	// Payers get a positive balance, the people who owe them a negative one
+	entries := []ledgerEntry{}
+	for _, e := range expenses {
+		for _, d := range matchPayers(payersByExpense[e.id], e.splits) {
+			entries = append(entries, ledgerEntry{
+				creditor: d.creditor,
+				debtor:   d.debtor,
+				amount:   d.amount,
+				currency: e.currency,
+				rate:     e.rate,
+			})
+		}
 	}
 
 	// Adjust balances for confirmed payments
 	paymentQuery := `
-		SELECT from_user_id, to_user_id, amount
+		SELECT from_user_id, to_user_id, amount, currency, exchange_rate
 		FROM payment_confirmations
-		WHERE group_id = $1 AND confirmed_by IS NOT NULL
+		WHERE group_id = $1 AND status = 'confirmed'
 	`
 
 	paymentRows, err := s.db.Query(paymentQuery, groupID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", err
 	}
 	defer paymentRows.Close()
 
 	for paymentRows.Next() {
-		var fromUserID, toUserID int
-		var amount float64
+		var entry ledgerEntry
 
-		if err := paymentRows.Scan(&fromUserID, &toUserID, &amount); err != nil {
-			return nil, nil, err
+		// from_user paid, so their debt decreases; to_user received, so their credit decreases
+		if err := paymentRows.Scan(&entry.creditor, &entry.debtor, &entry.amount, &entry.currency, &entry.rate); err != nil {
+			return nil, nil, "", err
 		}
+		entries = append(entries, entry)
+	}
 
-		balanceMap[fromUserID] += amount // from_user paid, so their debt decreases
-		balanceMap[toUserID] -= amount   // to_user received, so their credit decreases
+	return entries, nameMap, baseCurrency, paymentRows.Err()
+}
+
+// CalculateSettlements settles the whole group in its base currency, using
+// the exchange rate recorded with each expense and payment
+func (s *ExpenseService) CalculateSettlements(groupID int) ([]models.Settlement, []models.Balance, error) {
+	entries, nameMap, baseCurrency, err := s.loadLedger(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Calculate balances: positive = owed to them, negative = they owe
+	balanceMap := make(map[int]money.Money)
+	for _, entry := range entries {
+		amount := entry.amount.Convert(entry.rate)
+		balanceMap[entry.creditor] += amount
+		balanceMap[entry.debtor] -= amount
+	}
+
+	settlements, balances := settleBalances(balanceMap, nameMap, baseCurrency)
+	return settlements, balances, nil
+}
+
+// CalculateSettlementsPerCurrency settles each currency separately without
+// converting, so people can pay each other back in the currency they spent
+func (s *ExpenseService) CalculateSettlementsPerCurrency(groupID int) ([]models.CurrencySettlements, error) {
+	entries, nameMap, _, err := s.loadLedger(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	balanceMaps := make(map[string]map[int]money.Money)
+	for _, entry := range entries {
+		if balanceMaps[entry.currency] == nil {
+			balanceMaps[entry.currency] = make(map[int]money.Money)
+		}
+		balanceMaps[entry.currency][entry.creditor] += entry.amount
+		balanceMaps[entry.currency][entry.debtor] -= entry.amount
+	}
+
+	results := []models.CurrencySettlements{}
+	for currency, balanceMap := range balanceMaps {
+		settlements, balances := settleBalances(balanceMap, nameMap, currency)
+		results = append(results, models.CurrencySettlements{
+			Currency:    currency,
+			Settlements: settlements,
+			Balances:    balances,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Currency < results[j].Currency
+	})
+
+	return results, nil
+}
+
+// settlementsIn returns the group's settlements in currency, or in the base
+// currency when currency is empty, along with that currency and whether the
+// settlements convert every other currency into it
+func (s *ExpenseService) settlementsIn(groupID int, currency string) ([]models.Settlement, string, bool, error) {
+	group, err := s.groupService.GetGroup(groupID)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if currency == "" || currency == group.BaseCurrency {
+		settlements, _, err := s.CalculateSettlements(groupID)
+		return settlements, group.BaseCurrency, true, err
 	}
 
+	perCurrency, err := s.CalculateSettlementsPerCurrency(groupID)
+	if err != nil {
+		return nil, "", false, err
+	}
+	for _, cs := range perCurrency {
+		if cs.Currency == currency {
+			return cs.Settlements, currency, false, nil
+		}
+	}
+	return nil, currency, false, nil
+}
+
+// findSettlement finds the payment the group's settlements suggest
+// debtorID makes to creditorID in currency, or in the base currency when
+// currency is empty
+func (s *ExpenseService) findSettlement(groupID, debtorID, creditorID int, currency string) (*models.Settlement, error) {
+	settlements, _, _, err := s.settlementsIn(groupID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, settlement := range settlements {
+		if settlement.From == debtorID && settlement.To == creditorID {
+			return &settlement, nil
+		}
+	}
+	return nil, ErrNoSettlement
+}
+
+func settleBalances(balanceMap map[int]money.Money, nameMap map[int]string, currency string) ([]models.Settlement, []models.Balance) {
 	// Convert to balance slice
 	balances := []models.Balance{}
 	for userID, balance := range balanceMap {
@@ -289,6 +968,7 @@ func (s *ExpenseService) CalculateSettlements(groupID int) ([]models.Settlement,
 			UserID:   userID,
 			UserName: nameMap[userID],
 			Balance:  balance,
+			Currency: currency,
 		})
 	}
 
@@ -299,56 +979,142 @@ func (s *ExpenseService) CalculateSettlements(groupID int) ([]models.Settlement,
 
 	// Calculate optimal settlements using greedy algorithm
 	settlements := optimizeSettlements(balanceMap, nameMap)
+	for i := range settlements {
+		settlements[i].Currency = currency
+	}
 
-	return settlements, balances, nil
+	return settlements, balances
 }
 
-func (s *ExpenseService) CreatePaymentConfirmation(groupID, fromUserID, toUserID int, amount float64, slipURL string) (*models.PaymentConfirmation, error) {
+// CreatePaymentConfirmation records a payment from fromUserID to toUserID
+// for the recipient to confirm. A payment may cover part of what is
+// outstanding between them; one for more is refused with ErrOverpayment
+// unless allowOverpayment is set, in which case the excess is flagged.
+func (s *ExpenseService) CreatePaymentConfirmation(groupID, fromUserID, toUserID int, amount money.Money, currency, slipURL string, allowOverpayment bool) (*models.PaymentConfirmation, error) {
+	if err := s.groupService.RequireParticipants(groupID, []int{toUserID}); err != nil {
+		return nil, err
+	}
+
+	currency, rate, err := s.resolveCurrency(groupID, currency, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO payment_confirmations (group_id, from_user_id, to_user_id, amount, slip_url)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, group_id, from_user_id, to_user_id, amount, slip_url, confirmed_by, confirmed_at
+		INSERT INTO payment_confirmations (group_id, from_user_id, to_user_id, amount, currency, exchange_rate, slip_url, slip_trans_ref, slip_data, overpayment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, group_id, from_user_id, to_user_id, amount, currency, exchange_rate, slip_url, slip_trans_ref, slip_data, overpayment, status, created_at
 	`
 
-	var confirmedBy sql.NullInt64
-	var confirmedAt sql.NullTime
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Payments between the same two people are checked one at a time, so
+	// two made together cannot both fit in what is outstanding. The lock
+	// is held until the payment is committed, so the next check sees it.
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended($1, 0))", fmt.Sprintf("payment:%d:%d:%d", groupID, fromUserID, toUserID)); err != nil {
+		return nil, err
+	}
+
+	// What is owed is settled in the base currency, whatever the payment
+	// is made in
+	outstanding, err := s.GetOutstanding(groupID, fromUserID, toUserID, "")
+	if err != nil {
+		return nil, err
+	}
+	excess := max(amount.Convert(rate)-outstanding.Outstanding, 0)
+	if excess > 0 && !allowOverpayment {
+		return nil, fmt.Errorf("%w: %s %s is outstanding", ErrOverpayment, outstanding.Outstanding, outstanding.Currency)
+	}
+	// The excess is recorded in the payment's own currency
+	overpayment := min(excess.Convert(rate.Inverse()), amount)
+
+	slipID, transRef, slipData, err := uploadedSlip(tx, fromUserID, slipURL)
+	if err != nil {
+		return nil, err
+	}
 
 	pc := &models.PaymentConfirmation{}
-	err := s.db.QueryRow(query, groupID, fromUserID, toUserID, amount, slipURL).Scan(
+	err = tx.QueryRow(query, groupID, fromUserID, toUserID, amount, currency, rate, slipURL, transRef, slipData, overpayment).Scan(
 		&pc.ID,
 		&pc.GroupID,
 		&pc.FromUserID,
 		&pc.ToUserID,
 		&pc.Amount,
+		&pc.Currency,
+		&pc.ExchangeRate,
 		&pc.SlipURL,
-		&confirmedBy,
-		&confirmedAt,
+		&pc.SlipTransRef,
+		&slipData,
+		&pc.Overpayment,
+		&pc.Status,
+		&pc.CreatedAt,
 	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, ErrSlipAlreadyUsed
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment confirmation: %v", err)
 	}
+	pc.SlipData = slipData
 
-	// Handle nullable fields
-	if confirmedBy.Valid {
-		pc.ConfirmedBy = &confirmedBy.Int64
+	// The slip now belongs to the confirmation and is removed with it
+	if _, err := tx.Exec("UPDATE payment_slips SET payment_confirmation_id = $1 WHERE id = $2", pc.ID, slipID); err != nil {
+		return nil, err
+	}
+
+	if err := insertPaymentTransition(tx, pc.ID, models.AuditActionCreate, "", pc.Status, fromUserID, ""); err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    fromUserID,
+		entityType: models.AuditEntityPayment,
+		entityID:   pc.ID,
+		action:     models.AuditActionCreate,
+		after:      pc,
+	}); err != nil {
+		return nil, err
 	}
-	if confirmedAt.Valid {
-		pc.ConfirmedAt = &confirmedAt.Time
+
+	if err := notify(tx, notification{
+		userID:   toUserID,
+		kind:     models.NotificationPaymentReceived,
+		actorID:  fromUserID,
+		groupID:  groupID,
+		entityID: pc.ID,
+		data:     pc,
+	}); err != nil {
+		return nil, err
+	}
+	if err := queuePaymentMail(tx, models.NotificationPaymentReceived, toUserID, fromUserID, groupID, mail.PaymentData{Amount: pc.Amount, Currency: pc.Currency}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
+	s.events.Publish(events.New(events.PaymentCreated, groupID, pc.ID, fromUserID, pc))
 	return pc, nil
 }
 
 func (s *ExpenseService) GetPaymentConfirmations(groupID int) ([]models.PaymentConfirmation, error) {
 	query := `
-		SELECT pc.id, pc.group_id, pc.from_user_id, pc.to_user_id, pc.amount, pc.slip_url, pc.confirmed_by, pc.confirmed_at,
+		SELECT pc.id, pc.group_id, pc.from_user_id, pc.to_user_id, pc.amount, pc.currency, pc.exchange_rate, pc.slip_url,
+		       pc.slip_trans_ref, pc.slip_data, ps.storage_key, pc.overpayment, pc.status, pc.status_reason, pc.confirmed_by, pc.confirmed_at, pc.created_at,
 		       u1.name as from_name, u2.name as to_name, u3.name as confirmed_by_name
 		FROM payment_confirmations pc
 		JOIN users u1 ON pc.from_user_id = u1.id
 		JOIN users u2 ON pc.to_user_id = u2.id
 		LEFT JOIN users u3 ON pc.confirmed_by = u3.id
+		LEFT JOIN payment_slips ps ON ps.payment_confirmation_id = pc.id
 		WHERE pc.group_id = $1
-		ORDER BY pc.confirmed_at DESC
+		ORDER BY pc.created_at DESC
 	`
 
 	rows, err := s.db.Query(query, groupID)
@@ -364,16 +1130,31 @@ func (s *ExpenseService) GetPaymentConfirmations(groupID int) ([]models.PaymentC
 		var confirmedByName sql.NullString
 		var confirmedBy sql.NullInt64
 		var confirmedAt sql.NullTime
+		var slipTransRef, slipKey, statusReason sql.NullString
+		var slipData []byte
 
 		err := rows.Scan(
-			&pc.ID, &pc.GroupID, &pc.FromUserID, &pc.ToUserID, &pc.Amount, &pc.SlipURL,
-			&confirmedBy, &confirmedAt, &fromName, &toName, &confirmedByName,
+			&pc.ID, &pc.GroupID, &pc.FromUserID, &pc.ToUserID, &pc.Amount, &pc.Currency, &pc.ExchangeRate, &pc.SlipURL,
+			&slipTransRef, &slipData, &slipKey, &pc.Overpayment, &pc.Status, &statusReason, &confirmedBy, &confirmedAt, &pc.CreatedAt,
+			&fromName, &toName, &confirmedByName,
 		)
 		if err != nil {
 			return nil, err
 		}
 
 		// Handle nullable fields
+		if slipTransRef.Valid {
+			pc.SlipTransRef = slipTransRef.String
+		}
+		if slipKey.Valid {
+			pc.SlipKey = slipKey.String
+		}
+		if slipData != nil {
+			pc.SlipData = slipData
+		}
+		if statusReason.Valid {
+			pc.StatusReason = statusReason.String
+		}
 		if confirmedBy.Valid {
 			pc.ConfirmedBy = &confirmedBy.Int64
 		}
@@ -394,53 +1175,35 @@ func (s *ExpenseService) GetPaymentConfirmations(groupID int) ([]models.PaymentC
 	return confirmations, nil
 }
 
-func (s *ExpenseService) ConfirmPayment(confirmationID, confirmedBy int) error {
-	query := `
-		UPDATE payment_confirmations
-		SET confirmed_by = $1, confirmed_at = CURRENT_TIMESTAMP
-		WHERE id = $2 AND confirmed_by IS NULL
-	`
-
-	result, err := s.db.Exec(query, confirmedBy, confirmationID)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("payment confirmation not found or already confirmed")
-	}
-
-	return nil
-}
-
 // optimizeSettlements calculates minimum transactions needed to settle all debts
-func optimizeSettlements(balanceMap map[int]float64, nameMap map[int]string) []models.Settlement {
+func optimizeSettlements(balanceMap map[int]money.Money, nameMap map[int]string) []models.Settlement {
 	// Separate creditors (positive balance) and debtors (negative balance)
 	type person struct {
 		id      int
-		balance float64
+		balance money.Money
 	}
 
 	var creditors, debtors []person
 	for id, balance := range balanceMap {
-		if balance > 0.01 { // creditor
+		if balance > 0 { // creditor
 			creditors = append(creditors, person{id: id, balance: balance})
-		} else if balance < -0.01 { // debtor
+		} else if balance < 0 { // debtor
 			debtors = append(debtors, person{id: id, balance: -balance})
 		}
 	}
 
-	// Sort by amount (largest first)
+	// Sort by amount (largest first), then by ID so results are deterministic
 	sort.Slice(creditors, func(i, j int) bool {
-		return creditors[i].balance > creditors[j].balance
+		if creditors[i].balance != creditors[j].balance {
+			return creditors[i].balance > creditors[j].balance
+		}
+		return creditors[i].id < creditors[j].id
 	})
 	sort.Slice(debtors, func(i, j int) bool {
-		return debtors[i].balance > debtors[j].balance
+		if debtors[i].balance != debtors[j].balance {
+			return debtors[i].balance > debtors[j].balance
+		}
+		return debtors[i].id < debtors[j].id
 	})
 
 	settlements := []models.Settlement{}
@@ -455,23 +1218,21 @@ func optimizeSettlements(balanceMap map[int]float64, nameMap map[int]string) []m
 			amount = debtor.balance
 		}
 
-		if amount > 0.01 {
-			settlements = append(settlements, models.Settlement{
-				From:     debtor.id,
-				FromName: nameMap[debtor.id],
-				To:       creditor.id,
-				ToName:   nameMap[creditor.id],
-				Amount:   amount,
-			})
-		}
+		settlements = append(settlements, models.Settlement{
+			From:     debtor.id,
+			FromName: nameMap[debtor.id],
+			To:       creditor.id,
+			ToName:   nameMap[creditor.id],
+			Amount:   amount,
+		})
 
 		creditor.balance -= amount
 		debtor.balance -= amount
 
-		if creditor.balance < 0.01 {
+		if creditor.balance == 0 {
 			i++
 		}
-		if debtor.balance < 0.01 {
+		if debtor.balance == 0 {
 			j++
 		}
 	}
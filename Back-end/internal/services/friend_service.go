@@ -2,10 +2,30 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"expense-splitter/internal/models"
 	"fmt"
 )
 
+var (
+	ErrFriendRequestNotFound = errors.New("friend request not found")
+	ErrFriendRequestExists   = errors.New("friend request already sent")
+	ErrAlreadyFriends        = errors.New("friendship already exists")
+	ErrCannotFriendSelf      = errors.New("cannot add yourself as a friend")
+	ErrUserBlocked           = errors.New("cannot send a friend request to this user")
+	ErrCannotBlockSelf       = errors.New("cannot block yourself")
+)
+
+// excludeBlocked is a search condition that drops users u who blocked, or
+// were blocked by, the user in the given query placeholder
+func excludeBlocked(param string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = %[1]s AND b.blocked_id = u.id)
+			OR (b.blocker_id = u.id AND b.blocked_id = %[1]s)
+		)`, param)
+}
+
 type FriendService struct {
 	db *sql.DB
 }
@@ -14,47 +34,323 @@ func NewFriendService(db *sql.DB) *FriendService {
 	return &FriendService{db: db}
 }
 
-func (s *FriendService) AddFriend(userID, friendID int) error {
-	// Check if trying to add self
+// SendFriendRequest asks friendID to become friends with userID. If friendID
+// already has a pending request to userID, that request is accepted instead.
+func (s *FriendService) SendFriendRequest(userID, friendID int) (*models.FriendRequest, error) {
 	if userID == friendID {
-		return fmt.Errorf("cannot add yourself as a friend")
+		return nil, ErrCannotFriendSelf
 	}
 
-	// Check if friendship already exists
-	exists, err := s.AreFriends(userID, friendID)
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var blocked, friends bool
+	checkQuery := `
+		SELECT
+			EXISTS(
+				SELECT 1 FROM user_blocks
+				WHERE (blocker_id = $1 AND blocked_id = $2)
+				OR (blocker_id = $2 AND blocked_id = $1)
+			),
+			EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2)
+	`
+	if err := tx.QueryRow(checkQuery, userID, friendID).Scan(&blocked, &friends); err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserBlocked
 	}
-	if exists {
-		return fmt.Errorf("friendship already exists")
+	if friends {
+		return nil, ErrAlreadyFriends
 	}
 
-	// Create bidirectional friendship
-	tx, err := s.db.Begin()
+	// Two people asking each other means both want it
+	reverseQuery := `
+		UPDATE friend_requests
+		SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE from_user_id = $2 AND to_user_id = $3 AND status = 'pending'
+		RETURNING id, from_user_id, to_user_id, status, created_at, responded_at
+	`
+	req, err := scanFriendRequest(tx.QueryRow(reverseQuery, models.FriendRequestAccepted, friendID, userID))
+	if err == nil {
+		if err := addFriendship(tx, userID, friendID); err != nil {
+			return nil, err
+		}
+		if err := notifyFriend(tx, models.NotificationFriendAccepted, friendID, userID, req.ID); err != nil {
+			return nil, err
+		}
+		return req, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	insertQuery := `
+		INSERT INTO friend_requests (from_user_id, to_user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (from_user_id, to_user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id, from_user_id, to_user_id, status, created_at, responded_at
+	`
+	req, err = scanFriendRequest(tx.QueryRow(insertQuery, userID, friendID))
+	if err == sql.ErrNoRows {
+		return nil, ErrFriendRequestExists
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to send friend request: %v", err)
+	}
+
+	if err := notifyFriend(tx, models.NotificationFriendRequest, friendID, userID, req.ID); err != nil {
+		return nil, err
 	}
-	defer tx.Rollback()
 
-	// Insert friendship in both directions
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func scanFriendRequest(row *sql.Row) (*models.FriendRequest, error) {
+	req := &models.FriendRequest{}
+	var respondedAt sql.NullTime
+
+	if err := row.Scan(&req.ID, &req.FromUserID, &req.ToUserID, &req.Status, &req.CreatedAt, &respondedAt); err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if respondedAt.Valid {
+		req.RespondedAt = &respondedAt.Time
+	}
+
+	return req, nil
+}
+
+func addFriendship(tx *sql.Tx, userID, friendID int) error {
 	query := `
 		INSERT INTO friendships (user_id, friend_id)
 		VALUES ($1, $2), ($2, $1)
 		ON CONFLICT DO NOTHING
 	`
 
-	_, err = tx.Exec(query, userID, friendID)
-	if err != nil {
+	if _, err := tx.Exec(query, userID, friendID); err != nil {
 		return fmt.Errorf("failed to add friend: %v", err)
 	}
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
+// notifyFriend tells userID about a friend request from, or accepted by,
+// actorID
+func notifyFriend(tx *sql.Tx, kind string, userID, actorID, requestID int) error {
+	return notify(tx, notification{
+		userID:   userID,
+		kind:     kind,
+		actorID:  actorID,
+		entityID: requestID,
+	})
+}
+
+// GetIncomingRequests lists the pending requests sent to userID
+func (s *FriendService) GetIncomingRequests(userID int) ([]models.FriendRequest, error) {
+	query := `
+		SELECT fr.id, fr.from_user_id, fr.to_user_id, fr.status, fr.created_at,
+		       u.id, u.email, u.name, u.created_at
+		FROM friend_requests fr
+		JOIN users u ON u.id = fr.from_user_id
+		WHERE fr.to_user_id = $1 AND fr.status = 'pending'
+		ORDER BY fr.created_at DESC
+	`
+	return s.listRequests(query, userID)
+}
+
+// GetOutgoingRequests lists the pending requests userID has sent
+func (s *FriendService) GetOutgoingRequests(userID int) ([]models.FriendRequest, error) {
+	query := `
+		SELECT fr.id, fr.from_user_id, fr.to_user_id, fr.status, fr.created_at,
+		       u.id, u.email, u.name, u.created_at
+		FROM friend_requests fr
+		JOIN users u ON u.id = fr.to_user_id
+		WHERE fr.from_user_id = $1 AND fr.status = 'pending'
+		ORDER BY fr.created_at DESC
+	`
+	return s.listRequests(query, userID)
+}
+
+func (s *FriendService) listRequests(query string, userID int) ([]models.FriendRequest, error) {
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.FriendRequest{}
+	for rows.Next() {
+		var req models.FriendRequest
+		var user models.User
+		if err := rows.Scan(
+			&req.ID, &req.FromUserID, &req.ToUserID, &req.Status, &req.CreatedAt,
+			&user.ID, &user.Email, &user.Name, &user.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		req.User = &user
+		requests = append(requests, req)
+	}
+
+	return requests, rows.Err()
+}
+
+// AcceptFriendRequest accepts a pending request sent to userID and makes the
+// two users friends
+func (s *FriendService) AcceptFriendRequest(userID, requestID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE friend_requests
+		SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND to_user_id = $3 AND status = 'pending'
+		RETURNING from_user_id
+	`
+
+	var fromUserID int
+	err = tx.QueryRow(query, models.FriendRequestAccepted, requestID, userID).Scan(&fromUserID)
+	if err == sql.ErrNoRows {
+		return ErrFriendRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := addFriendship(tx, userID, fromUserID); err != nil {
+		return err
+	}
+	if err := notifyFriend(tx, models.NotificationFriendAccepted, fromUserID, userID, requestID); err != nil {
 		return err
 	}
 
+	return tx.Commit()
+}
+
+// DeclineFriendRequest declines a pending request sent to userID
+func (s *FriendService) DeclineFriendRequest(userID, requestID int) error {
+	query := `
+		UPDATE friend_requests
+		SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND to_user_id = $3 AND status = 'pending'
+	`
+	return s.closeRequest(query, models.FriendRequestDeclined, requestID, userID)
+}
+
+// CancelFriendRequest withdraws a pending request userID has sent
+func (s *FriendService) CancelFriendRequest(userID, requestID int) error {
+	query := `
+		UPDATE friend_requests
+		SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND from_user_id = $3 AND status = 'pending'
+	`
+	return s.closeRequest(query, models.FriendRequestCancelled, requestID, userID)
+}
+
+func (s *FriendService) closeRequest(query, status string, requestID, userID int) error {
+	result, err := s.db.Exec(query, status, requestID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrFriendRequestNotFound
+	}
 	return nil
 }
 
+// BlockUser blocks blockedID for userID. It ends any friendship between them
+// and closes their pending requests.
+func (s *FriendService) BlockUser(userID, blockedID int) error {
+	if userID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	blockQuery := `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(blockQuery, userID, blockedID); err != nil {
+		return fmt.Errorf("failed to block user: %v", err)
+	}
+
+	friendshipQuery := `
+		DELETE FROM friendships
+		WHERE (user_id = $1 AND friend_id = $2)
+		OR (user_id = $2 AND friend_id = $1)
+	`
+	if _, err := tx.Exec(friendshipQuery, userID, blockedID); err != nil {
+		return err
+	}
+
+	requestQuery := `
+		UPDATE friend_requests
+		SET status = CASE WHEN from_user_id = $1 THEN $3 ELSE $4 END,
+		    responded_at = CURRENT_TIMESTAMP
+		WHERE status = 'pending'
+		AND ((from_user_id = $1 AND to_user_id = $2) OR (from_user_id = $2 AND to_user_id = $1))
+	`
+	if _, err := tx.Exec(requestQuery, userID, blockedID, models.FriendRequestCancelled, models.FriendRequestDeclined); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *FriendService) UnblockUser(userID, blockedID int) error {
+	_, err := s.db.Exec("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", userID, blockedID)
+	return err
+}
+
+func (s *FriendService) GetBlockedUsers(userID int) ([]models.User, error) {
+	query := `
+		SELECT u.id, u.email, u.name, u.created_at
+		FROM users u
+		JOIN user_blocks b ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 func (s *FriendService) RemoveFriend(userID, friendID int) error {
 	// Remove bidirectional friendship
 	query := `
@@ -119,6 +415,7 @@ func (s *FriendService) SearchFriends(userID int, query string) ([]models.User,
 		JOIN friendships f ON u.id = f.friend_id
 		WHERE f.user_id = $1
 		AND (u.email ILIKE $2 OR u.name ILIKE $2)
+		AND ` + excludeBlocked("$1") + `
 		ORDER BY u.name
 		LIMIT 20
 	`
@@ -2,19 +2,35 @@ package services
 
 import (
 	"database/sql"
+	"errors"
+	"expense-splitter/internal/events"
 	"expense-splitter/internal/models"
 	"fmt"
 )
 
+// DefaultBaseCurrency is used for groups created without a base currency
+const DefaultBaseCurrency = "THB"
+
+var (
+	ErrBaseCurrencyLocked = errors.New("base currency cannot be changed once the group has expenses or payments")
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrNotGroupMember     = errors.New("you are not a member of this group")
+	ErrNotParticipant     = errors.New("user is not a member of this group")
+	ErrPermissionDenied   = errors.New("your role in this group does not allow this")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrOwnerRoleChange    = errors.New("the owner's role can only change by transferring ownership")
+)
+
 type GroupService struct {
-	db *sql.DB
+	db     *sql.DB
+	events events.Publisher
 }
 
-func NewGroupService(db *sql.DB) *GroupService {
-	return &GroupService{db: db}
+func NewGroupService(db *sql.DB, publisher events.Publisher) *GroupService {
+	return &GroupService{db: db, events: publisher}
 }
 
-func (s *GroupService) CreateGroup(name, description string, createdBy int) (*models.Group, error) {
+func (s *GroupService) CreateGroup(name, description, baseCurrency string, createdBy int) (*models.Group, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
@@ -23,31 +39,36 @@ func (s *GroupService) CreateGroup(name, description string, createdBy int) (*mo
 
 	// Create group
 	query := `
-		INSERT INTO groups (name, description, created_by)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, description, created_by, created_at
+		INSERT INTO groups (name, description, created_by, base_currency)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, name, description, created_by, base_currency, require_join_approval, created_at
 	`
 
 	group := &models.Group{}
-	err = tx.QueryRow(query, name, description, createdBy).Scan(
+	err = tx.QueryRow(query, name, description, createdBy, baseCurrency).Scan(
 		&group.ID,
 		&group.Name,
 		&group.Description,
 		&group.CreatedBy,
+		&group.BaseCurrency,
+		&group.RequireJoinApproval,
 		&group.CreatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create group: %v", err)
 	}
 
-	// Add creator as member
+	// Add creator as owner
 	memberQuery := `
-		INSERT INTO group_members (group_id, user_id)
-		VALUES ($1, $2)
+		INSERT INTO group_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
 	`
-	if _, err := tx.Exec(memberQuery, group.ID, createdBy); err != nil {
+	if _, err := tx.Exec(memberQuery, group.ID, createdBy, models.RoleOwner); err != nil {
 		return nil, fmt.Errorf("failed to add creator as member: %v", err)
 	}
+	if err := writeMemberAudit(tx, group.ID, createdBy, createdBy, models.AuditActionCreate, "", models.RoleOwner); err != nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -58,7 +79,7 @@ func (s *GroupService) CreateGroup(name, description string, createdBy int) (*mo
 
 func (s *GroupService) GetGroup(groupID int) (*models.Group, error) {
 	query := `
-		SELECT id, name, description, created_by, created_at
+		SELECT id, name, description, created_by, base_currency, require_join_approval, created_at
 		FROM groups
 		WHERE id = $1
 	`
@@ -69,6 +90,8 @@ func (s *GroupService) GetGroup(groupID int) (*models.Group, error) {
 		&group.Name,
 		&group.Description,
 		&group.CreatedBy,
+		&group.BaseCurrency,
+		&group.RequireJoinApproval,
 		&group.CreatedAt,
 	)
 	if err != nil {
@@ -77,7 +100,7 @@ func (s *GroupService) GetGroup(groupID int) (*models.Group, error) {
 
 	// Get members
 	membersQuery := `
-		SELECT u.id, u.email, u.name, u.created_at
+		SELECT u.id, COALESCE(u.email, ''), u.name, u.is_guest, gm.role, u.created_at
 		FROM users u
 		JOIN group_members gm ON u.id = gm.user_id
 		WHERE gm.group_id = $1
@@ -92,7 +115,7 @@ func (s *GroupService) GetGroup(groupID int) (*models.Group, error) {
 	members := []models.User{}
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsGuest, &user.Role, &user.CreatedAt); err != nil {
 			return nil, err
 		}
 		members = append(members, user)
@@ -104,10 +127,12 @@ func (s *GroupService) GetGroup(groupID int) (*models.Group, error) {
 
 func (s *GroupService) GetUserGroups(userID int) ([]models.Group, error) {
 	query := `
-		SELECT g.id, g.name, g.description, g.created_by, g.created_at
+		SELECT g.id, g.name, g.description, g.created_by, g.base_currency, g.require_join_approval, gm.role, g.created_at,
+		       ` + unreadActivity + `
 		FROM groups g
 		JOIN group_members gm ON g.id = gm.group_id
-		WHERE gm.user_id = $1
+		LEFT JOIN group_activity_seen s ON s.group_id = g.id AND s.user_id = gm.user_id
+		WHERE gm.user_id = $1 AND g.deleted_at IS NULL
 		ORDER BY g.created_at DESC
 	`
 
@@ -125,7 +150,11 @@ func (s *GroupService) GetUserGroups(userID int) ([]models.Group, error) {
 			&group.Name,
 			&group.Description,
 			&group.CreatedBy,
+			&group.BaseCurrency,
+			&group.RequireJoinApproval,
+			&group.Role,
 			&group.CreatedAt,
+			&group.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
@@ -135,25 +164,246 @@ func (s *GroupService) GetUserGroups(userID int) ([]models.Group, error) {
 	return groups, nil
 }
 
-func (s *GroupService) AddMember(groupID, userID int) error {
+// AddMember adds userID to the group with role. Adding someone as an admin
+// hands out a role, so it takes PermManageRoles as well as
+// PermManageMembers, just as ChangeMemberRole does.
+func (s *GroupService) AddMember(groupID, actorID, userID int, role string) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	if role != models.RoleMember && role != models.RoleViewer {
+		if err := s.RequirePermission(groupID, actorID, PermManageRoles); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Guests belong to the group that created them and cannot be added elsewhere
 	query := `
-		INSERT INTO group_members (group_id, user_id)
-		VALUES ($1, $2)
+		INSERT INTO group_members (group_id, user_id, role)
+		SELECT $1, id, $3 FROM users WHERE id = $2 AND NOT is_guest
 		ON CONFLICT DO NOTHING
+		RETURNING user_id
 	`
 
-	_, err := s.db.Exec(query, groupID, userID)
-	return err
+	var added int
+	err = tx.QueryRow(query, groupID, userID, role).Scan(&added)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeMemberAudit(tx, groupID, actorID, userID, models.AuditActionCreate, "", role); err != nil {
+		return err
+	}
+	if err := notifyMember(tx, models.NotificationAddedToGroup, groupID, actorID, userID, role); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.MemberAdded, groupID, userID, actorID, models.AuditMember{UserID: userID, Role: role}))
+	return nil
 }
 
-func (s *GroupService) RemoveMember(groupID, userID int) error {
+// RemoveMember lets anyone leave a group, and lets members with
+// PermManageMembers remove others. Only the owner can remove an admin, and
+// the owner cannot be removed until ownership is transferred.
+func (s *GroupService) RemoveMember(groupID, actorID, userID int) error {
+	role, err := s.GetMemberRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == models.RoleOwner {
+		return ErrOwnerRoleChange
+	}
+
+	if actorID != userID {
+		actorRole, err := s.GetMemberRole(groupID, actorID)
+		if err != nil {
+			return err
+		}
+		if !RoleHasPermission(actorRole, PermManageMembers) {
+			return ErrPermissionDenied
+		}
+		if role == models.RoleAdmin && actorRole != models.RoleOwner {
+			return ErrPermissionDenied
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		DELETE FROM group_members
 		WHERE group_id = $1 AND user_id = $2
+		RETURNING role
+	`
+
+	err = tx.QueryRow(query, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeMemberAudit(tx, groupID, actorID, userID, models.AuditActionDelete, role, ""); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.MemberRemoved, groupID, userID, actorID, nil))
+	return nil
+}
+
+// GetMemberRole returns the user's role in the group, or ErrNotGroupMember
+func (s *GroupService) GetMemberRole(groupID, userID int) (string, error) {
+	query := `
+		SELECT role FROM group_members
+		WHERE group_id = $1 AND user_id = $2
+	`
+
+	var role string
+	err := s.db.QueryRow(query, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotGroupMember
+	}
+	return role, err
+}
+
+// ChangeMemberRole sets a member's role to admin, member or viewer. The
+// owner's role cannot be changed here; use TransferOwnership.
+func (s *GroupService) ChangeMemberRole(groupID, actorID, userID int, role string) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	current, err := s.GetMemberRole(groupID, userID)
+	if err != nil {
+		return fmt.Errorf("%w: user %d", ErrNotParticipant, userID)
+	}
+	if current == models.RoleOwner {
+		return ErrOwnerRoleChange
+	}
+
+	if current == role {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND user_id = $3
+	`
+
+	if _, err := tx.Exec(query, role, groupID, userID); err != nil {
+		return err
+	}
+
+	if err := writeMemberAudit(tx, groupID, actorID, userID, models.AuditActionUpdate, current, role); err != nil {
+		return err
+	}
+	if err := notifyMember(tx, models.NotificationRoleChanged, groupID, actorID, userID, role); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.MemberUpdated, groupID, userID, actorID, models.AuditMember{UserID: userID, Role: role}))
+	return nil
+}
+
+// TransferOwnership makes newOwnerID the owner and demotes the current
+// owner to admin. groups.created_by follows the owner.
+func (s *GroupService) TransferOwnership(groupID, ownerID, newOwnerID int) error {
+	if _, err := s.GetMemberRole(groupID, newOwnerID); err != nil {
+		return fmt.Errorf("%w: user %d", ErrNotParticipant, newOwnerID)
+	}
+	if ownerID == newOwnerID {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Demote first so the one-owner-per-group index is never violated
+	demoteQuery := `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND user_id = $3 AND role = $4
 	`
+	result, err := tx.Exec(demoteQuery, models.RoleAdmin, groupID, ownerID, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrPermissionDenied
+	}
+
+	var previousRole string
+	if err := tx.QueryRow("SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2 FOR UPDATE", groupID, newOwnerID).Scan(&previousRole); err != nil {
+		return fmt.Errorf("%w: user %d", ErrNotParticipant, newOwnerID)
+	}
+
+	promoteQuery := `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND user_id = $3
+	`
+	if _, err := tx.Exec(promoteQuery, models.RoleOwner, groupID, newOwnerID); err != nil {
+		return fmt.Errorf("failed to transfer ownership: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE groups SET created_by = $1 WHERE id = $2", newOwnerID, groupID); err != nil {
+		return fmt.Errorf("failed to transfer ownership: %v", err)
+	}
+
+	if err := writeMemberAudit(tx, groupID, ownerID, ownerID, models.AuditActionUpdate, models.RoleOwner, models.RoleAdmin); err != nil {
+		return err
+	}
+	if err := writeMemberAudit(tx, groupID, ownerID, newOwnerID, models.AuditActionUpdate, previousRole, models.RoleOwner); err != nil {
+		return err
+	}
+	if err := notifyMember(tx, models.NotificationRoleChanged, groupID, ownerID, newOwnerID, models.RoleOwner); err != nil {
+		return err
+	}
 
-	_, err := s.db.Exec(query, groupID, userID)
-	return err
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.MemberUpdated, groupID, ownerID, ownerID, models.AuditMember{UserID: ownerID, Role: models.RoleAdmin}))
+	s.events.Publish(events.New(events.MemberUpdated, groupID, newOwnerID, ownerID, models.AuditMember{UserID: newOwnerID, Role: models.RoleOwner}))
+	return nil
 }
 
 func (s *GroupService) IsUserMember(groupID, userID int) (bool, error) {
@@ -169,52 +419,154 @@ func (s *GroupService) IsUserMember(groupID, userID int) (bool, error) {
 	return exists, err
 }
 
-func (s *GroupService) UpdateGroup(groupID int, name, description string, userID int) (*models.Group, error) {
-	// Check if user is the creator/owner
-	isOwner, err := s.IsUserOwner(groupID, userID)
+// RequireMember returns ErrGroupNotFound if the group does not exist and
+// ErrNotGroupMember if userID does not belong to it
+func (s *GroupService) RequireMember(groupID, userID int) error {
+	return s.RequirePermission(groupID, userID, PermViewGroup)
+}
+
+// RequirePermission is RequireMember plus a check that the user's role grants
+// perm, returning ErrPermissionDenied if it does not
+func (s *GroupService) RequirePermission(groupID, userID int, perm Permission) error {
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1 AND deleted_at IS NULL)", groupID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrGroupNotFound
+	}
+
+	role, err := s.GetMemberRole(groupID, userID)
 	if err != nil {
+		return err
+	}
+	if !RoleHasPermission(role, perm) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// RequireParticipants checks that every user ID, such as the payer and the
+// people an expense is split with, belongs to the group
+func (s *GroupService) RequireParticipants(groupID int, userIDs []int) error {
+	for _, userID := range userIDs {
+		isMember, err := s.IsUserMember(groupID, userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return fmt.Errorf("%w: user %d", ErrNotParticipant, userID)
+		}
+	}
+	return nil
+}
+
+// UpdateGroup changes the group's name and description. An empty
+// baseCurrency leaves the base currency as it is; it can only be changed
+// while the group has no expenses or payments, since their stored exchange
+// rates are relative to it.
+func (s *GroupService) UpdateGroup(groupID int, name, description, baseCurrency string, userID int) (*models.Group, error) {
+	if err := s.RequirePermission(groupID, userID, PermEditGroup); err != nil {
 		return nil, err
 	}
-	if !isOwner {
-		return nil, fmt.Errorf("only group owner can update the group")
+
+	if baseCurrency != "" {
+		lockedQuery := `
+			SELECT g.base_currency != $2 AND (
+				EXISTS(SELECT 1 FROM expenses WHERE group_id = $1)
+				OR EXISTS(SELECT 1 FROM payment_confirmations WHERE group_id = $1)
+			)
+			FROM groups g
+			WHERE g.id = $1
+		`
+		var locked bool
+		if err := s.db.QueryRow(lockedQuery, groupID, baseCurrency).Scan(&locked); err != nil {
+			return nil, fmt.Errorf("failed to update group: %v", err)
+		}
+		if locked {
+			return nil, ErrBaseCurrencyLocked
+		}
 	}
 
 	query := `
 		UPDATE groups
-		SET name = $1, description = $2
-		WHERE id = $3
-		RETURNING id, name, description, created_by, created_at
+		SET name = $1, description = $2, base_currency = COALESCE(NULLIF($3, ''), base_currency)
+		WHERE id = $4
+		RETURNING id, name, description, created_by, base_currency, require_join_approval, created_at
 	`
 
 	group := &models.Group{}
-	err = s.db.QueryRow(query, name, description, groupID).Scan(
+	err := s.db.QueryRow(query, name, description, baseCurrency, groupID).Scan(
 		&group.ID,
 		&group.Name,
 		&group.Description,
 		&group.CreatedBy,
+		&group.BaseCurrency,
+		&group.RequireJoinApproval,
 		&group.CreatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update group: %v", err)
 	}
 
+	s.events.Publish(events.New(events.GroupUpdated, groupID, groupID, userID, group))
 	return group, nil
 }
 
 func (s *GroupService) DeleteGroup(groupID, userID int) error {
-	// Check if user is the creator/owner
-	isOwner, err := s.IsUserOwner(groupID, userID)
+	if err := s.RequirePermission(groupID, userID, PermDeleteGroup); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	if !isOwner {
-		return fmt.Errorf("only group owner can delete the group")
+	defer tx.Rollback()
+
+	// Move the group to the trash; its members and expenses are only
+	// removed when TrashService purges it
+	query := `
+		UPDATE groups
+		SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING id, name, description, created_by, base_currency, require_join_approval, created_at
+	`
+
+	group := &models.Group{}
+	err = tx.QueryRow(query, userID, groupID).Scan(
+		&group.ID,
+		&group.Name,
+		&group.Description,
+		&group.CreatedBy,
+		&group.BaseCurrency,
+		&group.RequireJoinApproval,
+		&group.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %v", err)
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    userID,
+		entityType: models.AuditEntityGroup,
+		entityID:   groupID,
+		action:     models.AuditActionDelete,
+		before:     group,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	// Delete group (cascade will handle members and expenses)
-	query := `DELETE FROM groups WHERE id = $1`
-	_, err = s.db.Exec(query, groupID)
-	return err
+	s.events.Publish(events.New(events.GroupDeleted, groupID, groupID, userID, nil))
+	return nil
 }
 
 func (s *GroupService) IsUserOwner(groupID, userID int) (bool, error) {
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/models"
+	"fmt"
+	"slices"
+)
+
+var ErrGuestNotFound = errors.New("guest not found")
+
+// GuestService manages placeholder members: people who are split with but
+// have no account yet. A guest is a users row with only a name, so expenses,
+// splits and payments reference it like any other user until it is claimed.
+type GuestService struct {
+	db     *sql.DB
+	events events.Publisher
+}
+
+func NewGuestService(db *sql.DB, publisher events.Publisher) *GuestService {
+	return &GuestService{db: db, events: publisher}
+}
+
+// AddGuest creates a guest user and makes it a member of the group
+func (s *GuestService) AddGuest(groupID, actorID int, name string) (*models.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (name, is_guest, guest_group_id)
+		VALUES ($1, TRUE, $2)
+		RETURNING id, created_at
+	`
+
+	guest := &models.User{Name: name, IsGuest: true, Role: models.RoleMember}
+	if err := tx.QueryRow(query, name, groupID).Scan(&guest.ID, &guest.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to create guest: %v", err)
+	}
+
+	memberQuery := `
+		INSERT INTO group_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`
+	if _, err := tx.Exec(memberQuery, groupID, guest.ID, models.RoleMember); err != nil {
+		return nil, fmt.Errorf("failed to add guest to group: %v", err)
+	}
+	if err := writeMemberAudit(tx, groupID, actorID, guest.ID, models.AuditActionCreate, "", models.RoleMember); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(events.New(events.MemberAdded, groupID, guest.ID, actorID, guest))
+	return guest, nil
+}
+
+// CreateClaimToken issues a new token the real person behind a guest can use
+// to claim it. Any earlier token for the guest stops working.
+func (s *GuestService) CreateClaimToken(groupID, guestID int) (string, error) {
+	token, err := newInviteToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate claim token: %v", err)
+	}
+
+	query := `
+		UPDATE users
+		SET guest_claim_token = $1
+		WHERE id = $2 AND is_guest AND guest_group_id = $3
+	`
+
+	result, err := s.db.Exec(query, token, guestID, groupID)
+	if err != nil {
+		return "", err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected == 0 {
+		return "", ErrGuestNotFound
+	}
+
+	return token, nil
+}
+
+// ClaimGuest merges the guest behind token into userID and returns the
+// guest's group. Every expense, split and payment moves to userID, so
+// balances carry over unchanged, and the guest row is deleted. If userID
+// already shares an expense with the guest their splits are added together.
+func (s *GuestService) ClaimGuest(token string, userID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var guestID, groupID int
+	var guestRole string
+	err = tx.QueryRow(`
+		SELECT u.id, u.guest_group_id, gm.role
+		FROM users u
+		JOIN group_members gm ON gm.user_id = u.id AND gm.group_id = u.guest_group_id
+		JOIN groups g ON g.id = u.guest_group_id
+		WHERE u.guest_claim_token = $1 AND u.is_guest AND g.deleted_at IS NULL
+		FOR UPDATE OF u
+	`, token).Scan(&guestID, &groupID, &guestRole)
+	if err == sql.ErrNoRows {
+		return 0, ErrGuestNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := mergeUser(tx, guestID, userID); err != nil {
+		return 0, err
+	}
+
+	memberQuery := `
+		INSERT INTO group_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = group_members.role
+		RETURNING role
+	`
+	var role string
+	if err := tx.QueryRow(memberQuery, groupID, userID, models.RoleMember).Scan(&role); err != nil {
+		return 0, fmt.Errorf("failed to add member: %v", err)
+	}
+
+	// Recorded against the guest, whose expenses and payments now belong to userID
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    userID,
+		entityType: models.AuditEntityMember,
+		entityID:   guestID,
+		action:     models.AuditActionClaim,
+		before:     models.AuditMember{UserID: guestID, Role: guestRole},
+		after:      models.AuditMember{UserID: userID, Role: role},
+	}); err != nil {
+		return 0, err
+	}
+
+	// Deleting the guest also drops its group membership
+	if _, err := tx.Exec("DELETE FROM users WHERE id = $1", guestID); err != nil {
+		return 0, fmt.Errorf("failed to delete guest: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// The guest's expenses and payments now belong to userID
+	s.events.Publish(events.New(events.MemberRemoved, groupID, guestID, userID, nil))
+	s.events.Publish(events.New(events.MemberAdded, groupID, userID, userID, models.AuditMember{UserID: userID, Role: role}))
+	return groupID, nil
+}
+
+// mergeUser repoints every record that references fromID to toID. Tables
+// that gain user references must be added here.
+func mergeUser(tx *sql.Tx, fromID, toID int) error {
+	statements := []string{
+		// Fold splits on expenses both users share into toID's split
+		`UPDATE expense_splits t
+		SET amount = t.amount + f.amount,
+		    value = CASE WHEN t.value IS NULL OR f.value IS NULL THEN t.value ELSE t.value + f.value END
+		FROM expense_splits f
+		WHERE f.expense_id = t.expense_id AND f.user_id = $1 AND t.user_id = $2`,
+		`DELETE FROM expense_splits
+		WHERE user_id = $1
+		AND expense_id IN (SELECT expense_id FROM expense_splits WHERE user_id = $2)`,
+		`UPDATE expense_splits SET user_id = $2 WHERE user_id = $1`,
+		`DELETE FROM expense_item_consumers
+		WHERE user_id = $1
+		AND item_id IN (SELECT item_id FROM expense_item_consumers WHERE user_id = $2)`,
+		`UPDATE expense_item_consumers SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE expense_payers t
+		SET amount = t.amount + f.amount
+		FROM expense_payers f
+		WHERE f.expense_id = t.expense_id AND f.user_id = $1 AND t.user_id = $2`,
+		`DELETE FROM expense_payers
+		WHERE user_id = $1
+		AND expense_id IN (SELECT expense_id FROM expense_payers WHERE user_id = $2)`,
+		`UPDATE expense_payers SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE expenses SET paid_by = $2 WHERE paid_by = $1`,
+		`UPDATE payment_confirmations SET from_user_id = $2 WHERE from_user_id = $1`,
+		`UPDATE payment_confirmations SET to_user_id = $2 WHERE to_user_id = $1`,
+		`UPDATE payment_confirmations SET confirmed_by = $2 WHERE confirmed_by = $1`,
+		`UPDATE payment_confirmation_transitions SET actor_id = $2 WHERE actor_id = $1`,
+		// The guest's open requests give way to ones the user already has, and
+		// requests between the guest and the user themselves no longer make sense
+		`UPDATE payment_requests
+		SET status = 'cancelled', closed_at = CURRENT_TIMESTAMP
+		WHERE status = 'open'
+		AND ((from_user_id = $1 AND to_user_id = $2) OR (from_user_id = $2 AND to_user_id = $1))`,
+		`UPDATE payment_requests f
+		SET status = 'cancelled', closed_at = CURRENT_TIMESTAMP
+		FROM payment_requests t
+		WHERE f.status = 'open' AND t.status = 'open'
+		AND f.group_id = t.group_id AND f.currency = t.currency
+		AND ((f.from_user_id = $1 AND t.from_user_id = $2 AND f.to_user_id = t.to_user_id)
+		  OR (f.to_user_id = $1 AND t.to_user_id = $2 AND f.from_user_id = t.from_user_id))`,
+		`UPDATE payment_requests SET from_user_id = $2 WHERE from_user_id = $1`,
+		`UPDATE payment_requests SET to_user_id = $2 WHERE to_user_id = $1`,
+		`UPDATE recurring_expenses SET created_by = $2 WHERE created_by = $1`,
+	}
+
+	// Templates are read before the guest's memberships go away
+	if err := mergeTemplates(tx, fromID, toID); err != nil {
+		return err
+	}
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, fromID, toID); err != nil {
+			return fmt.Errorf("failed to merge user %d into %d: %v", fromID, toID, err)
+		}
+	}
+	return nil
+}
+
+// mergeTemplates repoints the user IDs inside the recurring expense templates
+// of fromID's groups to toID, so the series keep posting once fromID is gone
+func mergeTemplates(tx *sql.Tx, fromID, toID int) error {
+	query := `
+		SELECT id, template
+		FROM recurring_expenses
+		WHERE group_id IN (SELECT group_id FROM group_members WHERE user_id = $1)
+		FOR UPDATE
+	`
+
+	rows, err := tx.Query(query, fromID)
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[int][]byte)
+	for rows.Next() {
+		var id int
+		var template []byte
+		if err := rows.Scan(&id, &template); err != nil {
+			rows.Close()
+			return err
+		}
+		templates[id] = template
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, template := range templates {
+		var req models.CreateExpenseRequest
+		if err := json.Unmarshal(template, &req); err != nil {
+			return fmt.Errorf("invalid template for recurring expense %d: %v", id, err)
+		}
+		if !mergeTemplateUser(&req, fromID, toID) {
+			continue
+		}
+
+		merged, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE recurring_expenses SET template = $1 WHERE id = $2", merged, id); err != nil {
+			return fmt.Errorf("failed to merge user %d into recurring expense %d: %v", fromID, id, err)
+		}
+	}
+	return nil
+}
+
+// mergeTemplateUser replaces fromID with toID throughout req, adding fromID's
+// payments and split values to toID's where both appear, the way mergeUser
+// folds splits. It reports whether anything changed.
+func mergeTemplateUser(req *models.CreateExpenseRequest, fromID, toID int) bool {
+	changed := false
+
+	if req.PaidBy == fromID {
+		req.PaidBy = toID
+		changed = true
+	}
+
+	payers := req.Payers[:0]
+	for _, payer := range req.Payers {
+		if payer.UserID == fromID {
+			payer.UserID = toID
+			changed = true
+		}
+		if i := slices.IndexFunc(payers, func(p models.ExpensePayer) bool { return p.UserID == payer.UserID }); i >= 0 {
+			payers[i].Amount += payer.Amount
+			continue
+		}
+		payers = append(payers, payer)
+	}
+	req.Payers = payers
+
+	values := req.SplitValues[:0]
+	for _, value := range req.SplitValues {
+		if value.UserID == fromID {
+			value.UserID = toID
+			changed = true
+		}
+		if i := slices.IndexFunc(values, func(v models.SplitValue) bool { return v.UserID == value.UserID }); i >= 0 {
+			values[i].Value += value.Value
+			continue
+		}
+		values = append(values, value)
+	}
+	req.SplitValues = values
+
+	var merged bool
+	req.SplitWith, merged = replaceUserID(req.SplitWith, fromID, toID)
+	changed = changed || merged
+	for i := range req.Items {
+		req.Items[i].Consumers, merged = replaceUserID(req.Items[i].Consumers, fromID, toID)
+		changed = changed || merged
+	}
+
+	return changed
+}
+
+// replaceUserID replaces fromID with toID in ids, dropping it if toID is
+// already there
+func replaceUserID(ids []int, fromID, toID int) ([]int, bool) {
+	i := slices.Index(ids, fromID)
+	if i < 0 {
+		return ids, false
+	}
+	if slices.Contains(ids, toID) {
+		return slices.Delete(ids, i, i+1), true
+	}
+	ids[i] = toID
+	return ids, true
+}
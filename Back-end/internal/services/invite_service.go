@@ -0,0 +1,344 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/models"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrInviteUnusable      = errors.New("invite has expired, been revoked or reached its use limit")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+)
+
+// Results of JoinGroup
+const (
+	JoinStatusJoined        = "joined"
+	JoinStatusAlreadyMember = "already_member"
+	JoinStatusPending       = "pending"
+)
+
+type InviteService struct {
+	db     *sql.DB
+	events events.Publisher
+}
+
+func NewInviteService(db *sql.DB, publisher events.Publisher) *InviteService {
+	return &InviteService{db: db, events: publisher}
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateInvite creates a shareable invite token. A nil expiresAt or maxUses
+// means no limit.
+func (s *InviteService) CreateInvite(groupID, createdBy int, expiresAt *time.Time, maxUses *int) (*models.GroupInvite, error) {
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite token: %v", err)
+	}
+
+	query := `
+		INSERT INTO group_invites (group_id, token, created_by, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	invite := &models.GroupInvite{
+		GroupID:   groupID,
+		Token:     token,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		MaxUses:   maxUses,
+	}
+	err = s.db.QueryRow(query, groupID, token, createdBy, expiresAt, maxUses).Scan(&invite.ID, &invite.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %v", err)
+	}
+
+	return invite, nil
+}
+
+func (s *InviteService) GetGroupInvites(groupID int) ([]models.GroupInvite, error) {
+	query := `
+		SELECT id, group_id, token, COALESCE(created_by, 0), expires_at, max_uses, use_count, revoked_at, created_at
+		FROM group_invites
+		WHERE group_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.GroupInvite{}
+	for rows.Next() {
+		var invite models.GroupInvite
+		var expiresAt, revokedAt sql.NullTime
+		var maxUses sql.NullInt64
+
+		if err := rows.Scan(
+			&invite.ID,
+			&invite.GroupID,
+			&invite.Token,
+			&invite.CreatedBy,
+			&expiresAt,
+			&maxUses,
+			&invite.UseCount,
+			&revokedAt,
+			&invite.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if expiresAt.Valid {
+			invite.ExpiresAt = &expiresAt.Time
+		}
+		if maxUses.Valid {
+			n := int(maxUses.Int64)
+			invite.MaxUses = &n
+		}
+		if revokedAt.Valid {
+			invite.RevokedAt = &revokedAt.Time
+		}
+
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+func (s *InviteService) RevokeInvite(groupID, inviteID int) error {
+	query := `
+		UPDATE group_invites
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND group_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := s.db.Exec(query, inviteID, groupID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// JoinGroup redeems an invite token for userID. If the group requires
+// approval a pending join request is created instead of a membership.
+func (s *InviteService) JoinGroup(token string, userID int) (*models.JoinGroupResponse, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the invite so concurrent joins cannot exceed max_uses
+	inviteQuery := `
+		SELECT i.id, i.group_id, g.require_join_approval,
+		       i.revoked_at IS NULL
+		       AND (i.expires_at IS NULL OR i.expires_at > CURRENT_TIMESTAMP)
+		       AND (i.max_uses IS NULL OR i.use_count < i.max_uses)
+		FROM group_invites i
+		JOIN groups g ON g.id = i.group_id
+		WHERE i.token = $1 AND g.deleted_at IS NULL
+		FOR UPDATE OF i
+	`
+
+	var inviteID int
+	var requireApproval, usable bool
+	resp := &models.JoinGroupResponse{}
+	err = tx.QueryRow(inviteQuery, token).Scan(&inviteID, &resp.GroupID, &requireApproval, &usable)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var isMember bool
+	memberQuery := `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2)`
+	if err := tx.QueryRow(memberQuery, resp.GroupID, userID).Scan(&isMember); err != nil {
+		return nil, err
+	}
+	if isMember {
+		resp.Status = JoinStatusAlreadyMember
+		return resp, nil
+	}
+
+	if !usable {
+		return nil, ErrInviteUnusable
+	}
+
+	if requireApproval {
+		requestQuery := `
+			INSERT INTO group_join_requests (group_id, user_id, invite_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (group_id, user_id) WHERE status = 'pending' DO NOTHING
+		`
+		result, err := tx.Exec(requestQuery, resp.GroupID, userID, inviteID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create join request: %v", err)
+		}
+		resp.Status = JoinStatusPending
+
+		// Asking again while a request is open does not use up the invite
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return resp, err
+		}
+	} else {
+		joinQuery := `
+			INSERT INTO group_members (group_id, user_id, role)
+			VALUES ($1, $2, $3)
+		`
+		if _, err := tx.Exec(joinQuery, resp.GroupID, userID, models.RoleMember); err != nil {
+			return nil, fmt.Errorf("failed to join group: %v", err)
+		}
+		if err := writeMemberAudit(tx, resp.GroupID, userID, userID, models.AuditActionCreate, "", models.RoleMember); err != nil {
+			return nil, err
+		}
+		resp.Status = JoinStatusJoined
+	}
+
+	if _, err := tx.Exec("UPDATE group_invites SET use_count = use_count + 1 WHERE id = $1", inviteID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if resp.Status == JoinStatusJoined {
+		s.events.Publish(events.New(events.MemberAdded, resp.GroupID, userID, userID, models.AuditMember{UserID: userID, Role: models.RoleMember}))
+	}
+	return resp, nil
+}
+
+func (s *InviteService) SetRequireApproval(groupID int, requireApproval bool) error {
+	_, err := s.db.Exec("UPDATE groups SET require_join_approval = $1 WHERE id = $2", requireApproval, groupID)
+	return err
+}
+
+// GetJoinRequests lists the group's join requests with the given status
+func (s *InviteService) GetJoinRequests(groupID int, status string) ([]models.JoinRequest, error) {
+	query := `
+		SELECT jr.id, jr.group_id, jr.user_id, u.name, u.email, jr.status, jr.decided_by, jr.decided_at, jr.created_at
+		FROM group_join_requests jr
+		JOIN users u ON u.id = jr.user_id
+		WHERE jr.group_id = $1 AND jr.status = $2
+		ORDER BY jr.created_at
+	`
+
+	rows, err := s.db.Query(query, groupID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.JoinRequest{}
+	for rows.Next() {
+		var jr models.JoinRequest
+		var decidedBy sql.NullInt64
+		var decidedAt sql.NullTime
+
+		if err := rows.Scan(
+			&jr.ID, &jr.GroupID, &jr.UserID, &jr.UserName, &jr.UserEmail,
+			&jr.Status, &decidedBy, &decidedAt, &jr.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if decidedBy.Valid {
+			jr.DecidedBy = &decidedBy.Int64
+		}
+		if decidedAt.Valid {
+			jr.DecidedAt = &decidedAt.Time
+		}
+
+		requests = append(requests, jr)
+	}
+
+	return requests, rows.Err()
+}
+
+// DecideJoinRequest accepts or rejects a pending join request. Accepting adds
+// the user to the group as a member.
+func (s *InviteService) DecideJoinRequest(groupID, requestID, decidedBy int, accept bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := models.JoinRequestRejected
+	if accept {
+		status = models.JoinRequestAccepted
+	}
+
+	query := `
+		UPDATE group_join_requests
+		SET status = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND group_id = $4 AND status = 'pending'
+		RETURNING user_id
+	`
+
+	var userID int
+	err = tx.QueryRow(query, status, decidedBy, requestID, groupID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	added := false
+	if accept {
+		memberQuery := `
+			INSERT INTO group_members (group_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`
+		result, err := tx.Exec(memberQuery, groupID, userID, models.RoleMember)
+		if err != nil {
+			return fmt.Errorf("failed to add member: %v", err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected > 0 {
+			if err := writeMemberAudit(tx, groupID, decidedBy, userID, models.AuditActionCreate, "", models.RoleMember); err != nil {
+				return err
+			}
+			added = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if added {
+		s.events.Publish(events.New(events.MemberAdded, groupID, userID, decidedBy, models.AuditMember{UserID: userID, Role: models.RoleMember}))
+	}
+	return nil
+}
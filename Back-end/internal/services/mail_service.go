@@ -0,0 +1,341 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"expense-splitter/internal/mail"
+	"expense-splitter/internal/models"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	// maxMailAttempts is how many times a message is tried before it is
+	// marked failed. With the backoff below that spans about a day.
+	maxMailAttempts = 10
+	maxMailBackoff  = 6 * time.Hour
+	mailBatchSize   = 50
+	mailSendTimeout = 30 * time.Second
+	// mailLease is how long a claimed batch has to be sent before another
+	// sender may take it over. It outlasts a batch that times out throughout.
+	mailLease = mailBatchSize*mailSendTimeout + 5*time.Minute
+
+	summaryInterval = 7 * 24 * time.Hour
+)
+
+// queueMail renders the kind template for userID in their language and adds
+// it to the outbox. Like notify it runs in the caller's transaction, so mail
+// is only sent for changes that were committed. Guests, who have no address,
+// and users who turned kind off are skipped.
+func queueMail(tx *sql.Tx, userID int, kind string, data any) error {
+	query := `
+		SELECT u.email, u.locale
+		FROM users u
+		WHERE u.id = $1 AND NOT u.is_guest AND u.email IS NOT NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = u.id AND p.type = $2 AND NOT p.enabled
+		)
+	`
+
+	var email, locale string
+	err := tx.QueryRow(query, userID, kind).Scan(&email, &locale)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg, err := mail.Render(kind, locale, data)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO email_outbox (user_id, to_address, template, subject, text_body, html_body)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.Exec(insertQuery, userID, email, kind, msg.Subject, msg.Text, msg.HTML); err != nil {
+		return fmt.Errorf("failed to queue mail: %v", err)
+	}
+	return nil
+}
+
+// queuePaymentMail mails userID about a payment in groupID made, confirmed
+// or requested by actorID, filling in the names in data. Nobody is mailed
+// about their own action.
+func queuePaymentMail(tx *sql.Tx, kind string, userID, actorID, groupID int, data mail.PaymentData) error {
+	if userID == actorID {
+		return nil
+	}
+
+	query := `
+		SELECT r.name, a.name, g.name
+		FROM users r, users a, groups g
+		WHERE r.id = $1 AND a.id = $2 AND g.id = $3
+	`
+	if err := tx.QueryRow(query, userID, actorID, groupID).Scan(&data.Recipient, &data.Actor, &data.Group); err != nil {
+		return err
+	}
+	return queueMail(tx, userID, kind, data)
+}
+
+// MailService delivers the outbox through a Mailer and sends the weekly
+// balance summaries
+type MailService struct {
+	db             *sql.DB
+	mailer         mail.Mailer
+	expenseService *ExpenseService
+}
+
+func NewMailService(db *sql.DB, mailer mail.Mailer, expenseService *ExpenseService) *MailService {
+	return &MailService{db: db, mailer: mailer, expenseService: expenseService}
+}
+
+// Deliver sends the messages that are due and returns how many were sent.
+// Messages are claimed for a lease and the claim is committed before any is
+// sent, so no lock is held while talking to the mail server. Each message
+// is then marked sent, or retried later after twice as long as the previous
+// attempt, on its own.
+func (s *MailService) Deliver(ctx context.Context) (int, error) {
+	due, err := s.claimMail()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, m := range due {
+		sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+		sendErr := s.mailer.Send(sendCtx, m.msg)
+		cancel()
+
+		if sendErr == nil {
+			if _, err := s.db.Exec("UPDATE email_outbox SET status = 'sent', sent_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'sending'", m.id); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		status := "pending"
+		if m.attempts >= maxMailAttempts {
+			status = "failed"
+			log.Printf("Mail: giving up on message %d to %s: %v", m.id, m.msg.To, sendErr)
+		}
+		backoff := min(time.Duration(1<<m.attempts)*time.Minute, maxMailBackoff)
+
+		retryQuery := `
+			UPDATE email_outbox
+			SET status = $1, last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+			WHERE id = $4 AND status = 'sending'
+		`
+		if _, err := s.db.Exec(retryQuery, status, sendErr.Error(), backoff.Seconds(), m.id); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+type outboxMessage struct {
+	id       int64
+	msg      mail.Message
+	attempts int // Including the one about to be made
+}
+
+// claimMail marks the messages that are due, and those whose lease ran out,
+// as sending and counts the attempt. Messages that ran out of attempts while
+// sending are given up on.
+func (s *MailService) claimMail() ([]outboxMessage, error) {
+	expiredQuery := `
+		UPDATE email_outbox
+		SET status = 'failed', last_error = COALESCE(last_error, 'delivery was interrupted')
+		WHERE status = 'sending' AND next_attempt_at <= CURRENT_TIMESTAMP AND attempts >= $1
+	`
+	if _, err := s.db.Exec(expiredQuery, maxMailAttempts); err != nil {
+		return nil, err
+	}
+
+	// SKIP LOCKED lets several instances claim at once without taking the
+	// same message
+	query := `
+		UPDATE email_outbox
+		SET status = 'sending', attempts = attempts + 1,
+		    next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ('pending', 'sending') AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, to_address, subject, text_body, html_body, attempts
+	`
+
+	rows, err := s.db.Query(query, mailLease.Seconds(), mailBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []outboxMessage
+	for rows.Next() {
+		var m outboxMessage
+		if err := rows.Scan(&m.id, &m.msg.To, &m.msg.Subject, &m.msg.Text, &m.msg.HTML, &m.attempts); err != nil {
+			return nil, err
+		}
+		due = append(due, m)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(due, func(a, b outboxMessage) int { return cmp.Compare(a.id, b.id) })
+	return due, rows.Err()
+}
+
+// SendWeeklySummaries queues a summary of what each user owes and is owed
+// for users whose last one was a week ago or more, and returns how many were
+// queued. Users who are settled up everywhere get no mail that week.
+func (s *MailService) SendWeeklySummaries() (int, error) {
+	query := `
+		SELECT u.id, u.name
+		FROM users u
+		WHERE NOT u.is_guest AND u.email IS NOT NULL
+		AND (u.last_summary_at IS NULL OR u.last_summary_at <= CURRENT_TIMESTAMP - make_interval(secs => $1))
+		AND EXISTS (
+			SELECT 1 FROM group_members gm
+			JOIN groups g ON g.id = gm.group_id
+			WHERE gm.user_id = u.id AND g.deleted_at IS NULL
+		)
+		ORDER BY u.id
+	`
+
+	rows, err := s.db.Query(query, summaryInterval.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	type recipient struct {
+		id   int
+		name string
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.id, &r.name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Groups are shared between users, so each is settled once per run
+	settlements := make(map[int][]models.Settlement)
+	queued := 0
+	for _, r := range recipients {
+		groups, err := s.expenseService.groupService.GetUserGroups(r.id)
+		if err != nil {
+			return queued, err
+		}
+
+		data := mail.SummaryData{Recipient: r.name}
+		for _, group := range groups {
+			groupSettlements, ok := settlements[group.ID]
+			if !ok {
+				if groupSettlements, _, err = s.expenseService.CalculateSettlements(group.ID); err != nil {
+					return queued, err
+				}
+				settlements[group.ID] = groupSettlements
+			}
+
+			for _, settlement := range groupSettlements {
+				switch r.id {
+				case settlement.From:
+					data.Owes = append(data.Owes, mail.SummaryLine{
+						Group: group.Name, Person: settlement.ToName, Amount: settlement.Amount, Currency: settlement.Currency,
+					})
+				case settlement.To:
+					data.Owed = append(data.Owed, mail.SummaryLine{
+						Group: group.Name, Person: settlement.FromName, Amount: settlement.Amount, Currency: settlement.Currency,
+					})
+				}
+			}
+		}
+
+		sent, err := s.queueSummary(r.id, data)
+		if err != nil {
+			return queued, err
+		}
+		if sent {
+			queued++
+		}
+	}
+
+	return queued, nil
+}
+
+// queueSummary claims userID's summary for this week and queues it if there
+// is anything in it. Another instance may have sent the summary since the
+// recipients were listed, in which case the claim fails and nothing is queued.
+func (s *MailService) queueSummary(userID int, data mail.SummaryData) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	claimQuery := `
+		UPDATE users SET last_summary_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_summary_at IS NULL OR last_summary_at <= CURRENT_TIMESTAMP - make_interval(secs => $2))
+		RETURNING id
+	`
+	var claimed int
+	err = tx.QueryRow(claimQuery, userID, summaryInterval.Seconds()).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sent := len(data.Owes) > 0 || len(data.Owed) > 0
+	if sent {
+		if err := queueMail(tx, userID, models.NotificationWeeklySummary, data); err != nil {
+			return false, err
+		}
+	}
+
+	return sent, tx.Commit()
+}
+
+// Run delivers the outbox and queues weekly summaries every interval until
+// ctx is cancelled
+func (s *MailService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if queued, err := s.SendWeeklySummaries(); err != nil {
+			log.Printf("Mail: weekly summaries: %v", err)
+		} else if queued > 0 {
+			log.Printf("Mail: queued %d weekly summaries", queued)
+		}
+
+		if _, err := s.Deliver(ctx); err != nil {
+			log.Printf("Mail: delivery: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+var (
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrInvalidNotificationType = errors.New("invalid notification type")
+)
+
+const (
+	defaultNotificationLimit = 30
+	maxNotificationLimit     = 100
+)
+
+// notification is one message to put in a user's inbox. An actorID of 0
+// means the change was made by the system, and a groupID of 0 that it
+// happened outside any group.
+type notification struct {
+	userID   int
+	kind     string
+	actorID  int
+	groupID  int
+	entityID int
+	data     any
+}
+
+// notify adds n to the recipient's inbox. Like writeAudit it runs in the
+// transaction that makes the change, so nobody is told about a change that
+// was rolled back. People are not told about their own changes, guests
+// cannot read an inbox, and types the recipient has turned off are skipped.
+func notify(tx *sql.Tx, n notification) error {
+	if n.userID == n.actorID {
+		return nil
+	}
+
+	var data []byte
+	if n.data != nil {
+		var err error
+		if data, err = json.Marshal(n.data); err != nil {
+			return fmt.Errorf("failed to encode notification: %v", err)
+		}
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, type, actor_id, group_id, entity_id, data)
+		SELECT u.id, $2, $3, $4, $5, $6
+		FROM users u
+		WHERE u.id = $1 AND NOT u.is_guest
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = u.id AND p.type = $2 AND NOT p.enabled
+		)
+	`
+
+	actor := sql.NullInt64{Int64: int64(n.actorID), Valid: n.actorID != 0}
+	group := sql.NullInt64{Int64: int64(n.groupID), Valid: n.groupID != 0}
+	if _, err := tx.Exec(query, n.userID, n.kind, actor, group, n.entityID, data); err != nil {
+		return fmt.Errorf("failed to write notification: %v", err)
+	}
+	return nil
+}
+
+// notifyExpense tells everyone who paid for or shares in the given versions
+// of an expense about a change to it
+func notifyExpense(tx *sql.Tx, kind string, actorID int, expenses ...*models.Expense) error {
+	var recipients []int
+	for _, expense := range expenses {
+		for _, payer := range expense.Payers {
+			recipients = append(recipients, payer.UserID)
+		}
+		for _, split := range expense.Splits {
+			recipients = append(recipients, split.UserID)
+		}
+	}
+	slices.Sort(recipients)
+	recipients = slices.Compact(recipients)
+
+	// The newest version describes the expense
+	expense := expenses[len(expenses)-1]
+	data := expenseNotice{
+		Description: expense.Description,
+		Amount:      expense.Amount,
+		Currency:    expense.Currency,
+	}
+
+	for _, userID := range recipients {
+		if err := notify(tx, notification{
+			userID:   userID,
+			kind:     kind,
+			actorID:  actorID,
+			groupID:  expense.GroupID,
+			entityID: expense.ID,
+			data:     data,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyMember tells userID they joined groupID or have a new role there
+func notifyMember(tx *sql.Tx, kind string, groupID, actorID, userID int, role string) error {
+	return notify(tx, notification{
+		userID:   userID,
+		kind:     kind,
+		actorID:  actorID,
+		groupID:  groupID,
+		entityID: userID,
+		data:     models.AuditMember{UserID: userID, Role: role},
+	})
+}
+
+// expenseNotice is the data of expense notifications
+type expenseNotice struct {
+	Description string      `json:"description"`
+	Amount      money.Money `json:"amount"`
+	Currency    string      `json:"currency"`
+}
+
+// NotificationService reads and manages users' inboxes. Notifications are
+// written by the services that make the changes.
+type NotificationService struct {
+	db *sql.DB
+}
+
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// GetNotifications returns a page of userID's notifications, newest first.
+// cursor is the NextCursor of the previous page, or empty for the newest.
+func (s *NotificationService) GetNotifications(userID int, cursor string, limit int, unreadOnly bool) (*models.NotificationList, error) {
+	var before int64
+	if cursor != "" {
+		var err error
+		if before, err = strconv.ParseInt(cursor, 10, 64); err != nil || before <= 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+	if limit <= 0 || limit > maxNotificationLimit {
+		limit = defaultNotificationLimit
+	}
+
+	list := &models.NotificationList{Items: []models.Notification{}}
+	countQuery := "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+	if err := s.db.QueryRow(countQuery, userID).Scan(&list.UnreadCount); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT n.id, n.type, n.actor_id, u.name, n.group_id, g.name, n.entity_id, n.data, n.read_at, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON n.actor_id = u.id
+		LEFT JOIN groups g ON n.group_id = g.id
+		WHERE n.user_id = $1
+	`
+	args := []any{userID}
+
+	if unreadOnly {
+		query += " AND n.read_at IS NULL"
+	}
+	if before != 0 {
+		args = append(args, before)
+		query += fmt.Sprintf(" AND n.id < $%d", len(args))
+	}
+
+	// Fetch one extra row to learn whether there is another page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY n.id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n models.Notification
+		var actorID, groupID sql.NullInt64
+		var actorName, groupName sql.NullString
+		var data []byte
+		var readAt sql.NullTime
+		if err := rows.Scan(
+			&n.ID, &n.Type, &actorID, &actorName, &groupID, &groupName, &n.EntityID, &data, &readAt, &n.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if actorID.Valid {
+			n.ActorID = &actorID.Int64
+			n.ActorName = actorName.String
+		}
+		if groupID.Valid {
+			n.GroupID = &groupID.Int64
+			n.GroupName = groupName.String
+		}
+		if data != nil {
+			n.Data = data
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+
+		list.Items = append(list.Items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list.Items) > limit {
+		list.Items = list.Items[:limit]
+		list.NextCursor = strconv.FormatInt(list.Items[limit-1].ID, 10)
+	}
+
+	return list, nil
+}
+
+// MarkRead marks one of userID's notifications read. Marking a read
+// notification again keeps its original read time.
+func (s *NotificationService) MarkRead(userID int, notificationID int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := s.db.Exec(query, notificationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all of userID's notifications read and returns how many
+// were unread
+func (s *NotificationService) MarkAllRead(userID int) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	result, err := s.db.Exec(query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetPreferences lists every notification type and whether userID gets it
+func (s *NotificationService) GetPreferences(userID int) ([]models.NotificationPreference, error) {
+	rows, err := s.db.Query("SELECT type, enabled FROM notification_preferences WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enabled := make(map[string]bool)
+	for rows.Next() {
+		var kind string
+		var on bool
+		if err := rows.Scan(&kind, &on); err != nil {
+			return nil, err
+		}
+		enabled[kind] = on
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, kind := range models.NotificationTypes {
+		on, set := enabled[kind]
+		preferences = append(preferences, models.NotificationPreference{Type: kind, Enabled: on || !set})
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences turns the given notification types on or off for
+// userID. Types that are not listed keep their current setting.
+func (s *NotificationService) UpdatePreferences(userID int, preferences []models.NotificationPreference) ([]models.NotificationPreference, error) {
+	for _, preference := range preferences {
+		if !slices.Contains(models.NotificationTypes, preference.Type) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidNotificationType, preference.Type)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+	`
+	for _, preference := range preferences {
+		if _, err := tx.Exec(query, userID, preference.Type, preference.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to save notification preference: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPreferences(userID)
+}
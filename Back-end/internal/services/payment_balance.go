@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"sort"
+)
+
+var ErrOverpayment = errors.New("payment is more than is outstanding")
+
+// pairPayment is a pending or confirmed payment, as counted towards what one
+// person has paid another back
+type pairPayment struct {
+	from     int
+	fromName string
+	to       int
+	toName   string
+	amount   money.Money
+	currency string
+	rate     money.Rate // Rate to the group's base currency
+	status   string
+}
+
+type pair struct {
+	from, to int
+}
+
+// loadPairPayments returns the group's pending and confirmed payments
+func (s *ExpenseService) loadPairPayments(groupID int) ([]pairPayment, error) {
+	query := `
+		SELECT pc.from_user_id, u1.name, pc.to_user_id, u2.name, pc.amount, pc.currency, pc.exchange_rate, pc.status
+		FROM payment_confirmations pc
+		JOIN users u1 ON pc.from_user_id = u1.id
+		JOIN users u2 ON pc.to_user_id = u2.id
+		WHERE pc.group_id = $1 AND pc.status IN ('pending', 'confirmed')
+	`
+
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []pairPayment
+	for rows.Next() {
+		var p pairPayment
+		if err := rows.Scan(&p.from, &p.fromName, &p.to, &p.toName, &p.amount, &p.currency, &p.rate, &p.status); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
+
+// buildPairBalances breaks settlements in currency down by pair, adding
+// every pair that has made payments. Converted settlements count every
+// payment at its recorded rate; otherwise only payments in currency count.
+func buildPairBalances(payments []pairPayment, settlements []models.Settlement, currency string, converted bool) []models.PairBalance {
+	pairs := make(map[pair]*models.PairBalance)
+	get := func(from int, fromName string, to int, toName string) *models.PairBalance {
+		key := pair{from, to}
+		if pairs[key] == nil {
+			pairs[key] = &models.PairBalance{
+				FromUserID:   from,
+				FromUserName: fromName,
+				ToUserID:     to,
+				ToUserName:   toName,
+				Currency:     currency,
+			}
+		}
+		return pairs[key]
+	}
+
+	// Settlements already take confirmed payments off what is owed
+	for _, settlement := range settlements {
+		get(settlement.From, settlement.FromName, settlement.To, settlement.ToName).Outstanding = settlement.Amount
+	}
+
+	for _, payment := range payments {
+		amount := payment.amount
+		if converted {
+			amount = amount.Convert(payment.rate)
+		} else if payment.currency != currency {
+			continue
+		}
+
+		balance := get(payment.from, payment.fromName, payment.to, payment.toName)
+		switch payment.status {
+		case models.PaymentConfirmed:
+			balance.Paid += amount
+		case models.PaymentPending:
+			balance.Pending += amount
+		}
+	}
+
+	results := make([]models.PairBalance, 0, len(pairs))
+	for _, balance := range pairs {
+		balance.Outstanding = max(balance.Outstanding-balance.Pending, 0)
+		results = append(results, *balance)
+	}
+
+	// Sort pairs for consistent results
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].FromUserID != results[j].FromUserID {
+			return results[i].FromUserID < results[j].FromUserID
+		}
+		return results[i].ToUserID < results[j].ToUserID
+	})
+
+	return results
+}
+
+// PairBalances breaks the group's base currency settlements down into what
+// each pair has paid, has pending and still owes
+func (s *ExpenseService) PairBalances(groupID int, settlements []models.Settlement) ([]models.PairBalance, error) {
+	group, err := s.groupService.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.loadPairPayments(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildPairBalances(payments, settlements, group.BaseCurrency, true), nil
+}
+
+// PairBalancesPerCurrency fills in the pairs of each currency's settlements
+func (s *ExpenseService) PairBalancesPerCurrency(groupID int, currencies []models.CurrencySettlements) error {
+	payments, err := s.loadPairPayments(groupID)
+	if err != nil {
+		return err
+	}
+
+	for i := range currencies {
+		currencies[i].Pairs = buildPairBalances(payments, currencies[i].Settlements, currencies[i].Currency, false)
+	}
+	return nil
+}
+
+// GetOutstanding returns how much debtorID still owes creditorID in
+// currency, or in the base currency when currency is empty, once their
+// pending payments are confirmed
+func (s *ExpenseService) GetOutstanding(groupID, debtorID, creditorID int, currency string) (*models.PairBalance, error) {
+	if err := s.groupService.RequireParticipants(groupID, []int{debtorID, creditorID}); err != nil {
+		return nil, err
+	}
+
+	settlements, currency, converted, err := s.settlementsIn(groupID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.loadPairPayments(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, balance := range buildPairBalances(payments, settlements, currency, converted) {
+		if balance.FromUserID == debtorID && balance.ToUserID == creditorID {
+			return &balance, nil
+		}
+	}
+
+	// Nothing is owed and nothing has been paid
+	balance := &models.PairBalance{FromUserID: debtorID, ToUserID: creditorID, Currency: currency}
+	query := "SELECT d.name, c.name FROM users d, users c WHERE d.id = $1 AND c.id = $2"
+	if err := s.db.QueryRow(query, debtorID, creditorID).Scan(&balance.FromUserName, &balance.ToUserName); err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
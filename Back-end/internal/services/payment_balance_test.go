@@ -0,0 +1,99 @@
+package services
+
+import (
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"slices"
+	"testing"
+)
+
+func TestBuildPairBalances(t *testing.T) {
+	usdTHB, err := money.ParseRate("35")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := func(from, to int, amount money.Money, currency string, rate money.Rate, status string) pairPayment {
+		return pairPayment{from: from, fromName: "A", to: to, toName: "B", amount: amount, currency: currency, rate: rate, status: status}
+	}
+	settlement := func(from, to int, amount money.Money) models.Settlement {
+		return models.Settlement{From: from, FromName: "A", To: to, ToName: "B", Amount: amount}
+	}
+	balance := func(from, to int, paid, pending, outstanding money.Money) models.PairBalance {
+		return models.PairBalance{FromUserID: from, FromUserName: "A", ToUserID: to, ToUserName: "B", Currency: "THB", Paid: paid, Pending: pending, Outstanding: outstanding}
+	}
+
+	tests := []struct {
+		name        string
+		payments    []pairPayment
+		settlements []models.Settlement
+		converted   bool
+		want        []models.PairBalance
+	}{
+		{
+			name:        "nothing paid",
+			settlements: []models.Settlement{settlement(2, 1, 5000)},
+			want:        []models.PairBalance{balance(2, 1, 0, 0, 5000)},
+		},
+		{
+			name:        "pending payment comes off outstanding",
+			payments:    []pairPayment{payment(2, 1, 2000, "THB", money.OneRate(), models.PaymentPending)},
+			settlements: []models.Settlement{settlement(2, 1, 5000)},
+			want:        []models.PairBalance{balance(2, 1, 0, 2000, 3000)},
+		},
+		{
+			name: "confirmed payment is already settled",
+			payments: []pairPayment{
+				payment(2, 1, 2000, "THB", money.OneRate(), models.PaymentConfirmed),
+				payment(2, 1, 1000, "THB", money.OneRate(), models.PaymentPending),
+			},
+			settlements: []models.Settlement{settlement(2, 1, 3000)},
+			want:        []models.PairBalance{balance(2, 1, 2000, 1000, 2000)},
+		},
+		{
+			name:     "paid off pair without settlement",
+			payments: []pairPayment{payment(2, 1, 5000, "THB", money.OneRate(), models.PaymentConfirmed)},
+			want:     []models.PairBalance{balance(2, 1, 5000, 0, 0)},
+		},
+		{
+			name:        "pending above outstanding",
+			payments:    []pairPayment{payment(2, 1, 6000, "THB", money.OneRate(), models.PaymentPending)},
+			settlements: []models.Settlement{settlement(2, 1, 5000)},
+			want:        []models.PairBalance{balance(2, 1, 0, 6000, 0)},
+		},
+		{
+			name:        "other currency skipped",
+			payments:    []pairPayment{payment(2, 1, 100, "USD", usdTHB, models.PaymentPending)},
+			settlements: []models.Settlement{settlement(2, 1, 5000)},
+			want:        []models.PairBalance{balance(2, 1, 0, 0, 5000)},
+		},
+		{
+			name:        "other currency converted",
+			payments:    []pairPayment{payment(2, 1, 100, "USD", usdTHB, models.PaymentPending)},
+			settlements: []models.Settlement{settlement(2, 1, 5000)},
+			converted:   true,
+			want:        []models.PairBalance{balance(2, 1, 0, 3500, 1500)},
+		},
+		{
+			name: "sorted by payer then recipient",
+			settlements: []models.Settlement{
+				settlement(3, 1, 100),
+				settlement(2, 3, 200),
+				settlement(2, 1, 300),
+			},
+			want: []models.PairBalance{
+				balance(2, 1, 0, 0, 300),
+				balance(2, 3, 0, 0, 200),
+				balance(3, 1, 0, 0, 100),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildPairBalances(tt.payments, tt.settlements, "THB", tt.converted)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buildPairBalances() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expense-splitter/internal/mail"
+	"expense-splitter/internal/models"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+	ErrPaymentRequestExists   = errors.New("an open payment request for this debt already exists")
+	ErrNoSettlement           = errors.New("no suggested settlement from this user to you")
+	ErrInvalidRequestAmount   = errors.New("amount must be positive and no more than the suggested settlement")
+	ErrInvalidDueDate         = errors.New("due_date must be a YYYY-MM-DD date that is not in the past")
+)
+
+// DefaultReminderOffsets remind debtors three days before the due date, on
+// it, and three and seven days after
+var DefaultReminderOffsets = []time.Duration{-72 * time.Hour, 0, 72 * time.Hour, 168 * time.Hour}
+
+const paymentRequestColumns = `
+	pr.id, pr.group_id, pr.from_user_id, f.name, pr.to_user_id, t.name, pr.amount, pr.currency, pr.due_date,
+	pr.status, pr.payment_confirmation_id, pr.reminders_sent, pr.last_reminded_at, pr.created_at, pr.closed_at
+`
+
+const paymentRequestJoins = `
+	JOIN users f ON pr.from_user_id = f.id
+	JOIN users t ON pr.to_user_id = t.id
+`
+
+// PaymentRequestService turns suggested settlements into payment requests
+// with a due date and reminds debtors until they are paid
+type PaymentRequestService struct {
+	db             *sql.DB
+	expenseService *ExpenseService
+	offsets        []time.Duration // Sorted; measured from the start of the due date
+}
+
+func NewPaymentRequestService(db *sql.DB, expenseService *ExpenseService, offsets []time.Duration) *PaymentRequestService {
+	offsets = slices.Clone(offsets)
+	slices.Sort(offsets)
+	return &PaymentRequestService{db: db, expenseService: expenseService, offsets: offsets}
+}
+
+// CreateRequest asks req.FromUserID to pay creditorID what the group's
+// suggested settlements say they owe, or part of it
+func (s *PaymentRequestService) CreateRequest(groupID, creditorID int, req models.CreatePaymentRequestRequest) (*models.PaymentRequest, error) {
+	dueDate, err := time.Parse(expenseDateLayout, req.DueDate)
+	if err != nil || dueDate.Before(today()) {
+		return nil, ErrInvalidDueDate
+	}
+
+	settlement, err := s.expenseService.findSettlement(groupID, req.FromUserID, creditorID, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = settlement.Amount
+	}
+	if amount <= 0 || amount > settlement.Amount {
+		return nil, ErrInvalidRequestAmount
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Reminders whose time has already passed are skipped; the request
+	// itself is the first nudge
+	query := `
+		INSERT INTO payment_requests (group_id, from_user_id, to_user_id, amount, currency, due_date, reminders_sent)
+		VALUES ($1, $2, $3, $4, $5, $6, (
+			SELECT COUNT(*) FROM unnest($7::float8[]) AS o(secs)
+			WHERE $6::date + make_interval(secs => o.secs) <= LOCALTIMESTAMP
+		))
+		ON CONFLICT (group_id, from_user_id, to_user_id, currency) WHERE status = 'open' DO NOTHING
+		RETURNING id
+	`
+
+	var requestID int
+	err = tx.QueryRow(query, groupID, req.FromUserID, creditorID, amount, settlement.Currency, dueDate, pq.Array(s.offsetSeconds())).Scan(&requestID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPaymentRequestExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment request: %v", err)
+	}
+
+	pr, err := loadPaymentRequest(tx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.notifyRequest(tx, models.NotificationPaymentRequested, creditorID, pr); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// notifyRequest tells the debtor about pr in the app and by mail. actorID is
+// who sent it, or 0 for reminders sent by the system.
+func (s *PaymentRequestService) notifyRequest(tx *sql.Tx, kind string, actorID int, pr *models.PaymentRequest) error {
+	if err := notify(tx, notification{
+		userID:   pr.FromUserID,
+		kind:     kind,
+		actorID:  actorID,
+		groupID:  pr.GroupID,
+		entityID: pr.ID,
+		data:     pr,
+	}); err != nil {
+		return err
+	}
+
+	// The mail names the creditor even when the system sends it
+	data := mail.PaymentData{Amount: pr.Amount, Currency: pr.Currency, DueDate: pr.DueDate}
+	return queuePaymentMail(tx, kind, pr.FromUserID, pr.ToUserID, pr.GroupID, data)
+}
+
+func scanPaymentRequest(row interface{ Scan(...any) error }) (*models.PaymentRequest, error) {
+	pr := &models.PaymentRequest{}
+	var confirmationID sql.NullInt64
+	var lastRemindedAt, closedAt sql.NullTime
+
+	if err := row.Scan(
+		&pr.ID, &pr.GroupID, &pr.FromUserID, &pr.FromUserName, &pr.ToUserID, &pr.ToUserName, &pr.Amount, &pr.Currency, &pr.DueDate,
+		&pr.Status, &confirmationID, &pr.RemindersSent, &lastRemindedAt, &pr.CreatedAt, &closedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if confirmationID.Valid {
+		pr.PaymentConfirmationID = &confirmationID.Int64
+	}
+	if lastRemindedAt.Valid {
+		pr.LastRemindedAt = &lastRemindedAt.Time
+	}
+	if closedAt.Valid {
+		pr.ClosedAt = &closedAt.Time
+	}
+
+	return pr, nil
+}
+
+func loadPaymentRequest(q queryer, requestID int) (*models.PaymentRequest, error) {
+	query := `SELECT ` + paymentRequestColumns + ` FROM payment_requests pr ` + paymentRequestJoins + ` WHERE pr.id = $1`
+
+	pr, err := scanPaymentRequest(q.QueryRow(query, requestID))
+	if err == sql.ErrNoRows {
+		return nil, ErrPaymentRequestNotFound
+	}
+	return pr, err
+}
+
+// GetGroupRequests lists the group's payment requests, open ones first, then
+// by due date. status filters them when it is not empty.
+func (s *PaymentRequestService) GetGroupRequests(groupID int, status string) ([]models.PaymentRequest, error) {
+	query := `SELECT ` + paymentRequestColumns + ` FROM payment_requests pr ` + paymentRequestJoins + ` WHERE pr.group_id = $1`
+	args := []any{groupID}
+
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND pr.status = $%d", len(args))
+	}
+	query += " ORDER BY pr.status != 'open', pr.due_date, pr.id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.PaymentRequest{}
+	for rows.Next() {
+		pr, err := scanPaymentRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *pr)
+	}
+
+	return requests, rows.Err()
+}
+
+// CancelRequest withdraws an open request. Only the creditor who made it can.
+func (s *PaymentRequestService) CancelRequest(groupID, requestID, userID int) error {
+	var creditorID int
+	query := "SELECT to_user_id FROM payment_requests WHERE id = $1 AND group_id = $2 AND status = 'open'"
+	err := s.db.QueryRow(query, requestID, groupID).Scan(&creditorID)
+	if err == sql.ErrNoRows {
+		return ErrPaymentRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if creditorID != userID {
+		return ErrPermissionDenied
+	}
+
+	result, err := s.db.Exec("UPDATE payment_requests SET status = $1, closed_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = 'open'",
+		models.PaymentRequestCancelled, requestID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrPaymentRequestNotFound
+	}
+	return nil
+}
+
+// closePaymentRequests marks open requests that pc finishes paying as paid.
+// Partial payments add up: a request is paid once the payments confirmed
+// since it was made, and pc itself, cover it. It runs in the transaction
+// that confirms pc.
+func closePaymentRequests(tx *sql.Tx, pc *models.PaymentConfirmation) error {
+	query := `
+		UPDATE payment_requests pr
+		SET status = $1, payment_confirmation_id = $2, closed_at = CURRENT_TIMESTAMP
+		WHERE pr.group_id = $3 AND pr.from_user_id = $4 AND pr.to_user_id = $5 AND pr.currency = $6
+		AND pr.status = 'open'
+		AND pr.amount <= (
+			SELECT COALESCE(SUM(pc.amount), 0)
+			FROM payment_confirmations pc
+			WHERE pc.group_id = pr.group_id AND pc.from_user_id = pr.from_user_id
+			AND pc.to_user_id = pr.to_user_id AND pc.currency = pr.currency AND pc.status = 'confirmed'
+			AND (pc.created_at >= pr.created_at OR pc.id = $2)
+		)
+	`
+
+	if _, err := tx.Exec(query, models.PaymentRequestPaid, pc.ID, pc.GroupID, pc.FromUserID, pc.ToUserID, pc.Currency); err != nil {
+		return fmt.Errorf("failed to close payment requests: %v", err)
+	}
+	return nil
+}
+
+// reopenPaymentRequests checks the paid requests between pc's payer and
+// recipient again once pc is rejected or disputed, whichever payment closed
+// them. A request the confirmed payments no longer cover is opened again.
+// Only one request per debt can be open, so this is the newest of them,
+// and none if the debt already has an open request.
+func reopenPaymentRequests(tx *sql.Tx, pc *models.PaymentConfirmation) error {
+	query := `
+		UPDATE payment_requests
+		SET status = $1, payment_confirmation_id = NULL, closed_at = NULL
+		WHERE id = (
+			SELECT pr.id FROM payment_requests pr
+			WHERE pr.group_id = $2 AND pr.from_user_id = $3 AND pr.to_user_id = $4 AND pr.currency = $5
+			AND pr.status = $6
+			AND pr.amount > (
+				SELECT COALESCE(SUM(pc.amount), 0)
+				FROM payment_confirmations pc
+				WHERE pc.group_id = pr.group_id AND pc.from_user_id = pr.from_user_id
+				AND pc.to_user_id = pr.to_user_id AND pc.currency = pr.currency AND pc.status = 'confirmed'
+				AND (pc.created_at >= pr.created_at OR pc.id = pr.payment_confirmation_id)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM payment_requests o
+				WHERE o.group_id = pr.group_id AND o.from_user_id = pr.from_user_id
+				AND o.to_user_id = pr.to_user_id AND o.currency = pr.currency AND o.status = 'open'
+			)
+			ORDER BY pr.created_at DESC, pr.id DESC
+			LIMIT 1
+		)
+	`
+
+	if _, err := tx.Exec(query, models.PaymentRequestOpen, pc.GroupID, pc.FromUserID, pc.ToUserID, pc.Currency, models.PaymentRequestPaid); err != nil {
+		return fmt.Errorf("failed to reopen payment requests: %v", err)
+	}
+	return nil
+}
+
+func (s *PaymentRequestService) offsetSeconds() []float64 {
+	seconds := make([]float64, len(s.offsets))
+	for i, offset := range s.offsets {
+		seconds[i] = offset.Seconds()
+	}
+	return seconds
+}
+
+// SendReminders sends the reminders that have fallen due and returns how
+// many it sent. A request that missed several reminders, because the server
+// was down or the request was made close to its due date, gets only the
+// latest one.
+func (s *PaymentRequestService) SendReminders() (int, error) {
+	if len(s.offsets) == 0 {
+		return 0, nil
+	}
+
+	offsets := s.offsetSeconds()
+	// The next reminder of each request is the offset after the ones sent
+	query := `
+		SELECT id FROM payment_requests
+		WHERE status = 'open' AND reminders_sent < $1
+		AND due_date + make_interval(secs => ($2::float8[])[reminders_sent + 1]) <= LOCALTIMESTAMP
+		ORDER BY due_date, id
+	`
+
+	rows, err := s.db.Query(query, len(offsets), pq.Array(offsets))
+	if err != nil {
+		return 0, err
+	}
+
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, id := range due {
+		ok, err := s.remind(id)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// remind sends the latest reminder due for a request, unless another
+// instance got to it first
+func (s *PaymentRequestService) remind(requestID int) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var remindersSent int
+	var dueDate, now time.Time
+	lockQuery := `
+		SELECT reminders_sent, due_date, LOCALTIMESTAMP
+		FROM payment_requests
+		WHERE id = $1 AND status = 'open'
+		FOR UPDATE SKIP LOCKED
+	`
+	err = tx.QueryRow(lockQuery, requestID).Scan(&remindersSent, &dueDate, &now)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step := remindersSent
+	for step < len(s.offsets) && !dueDate.Add(s.offsets[step]).After(now) {
+		step++
+	}
+	if step == remindersSent {
+		return false, nil
+	}
+
+	// Reminders after the due date escalate to overdue notices
+	kind := models.NotificationPaymentReminder
+	if s.offsets[step-1] > 0 {
+		kind = models.NotificationPaymentOverdue
+	}
+
+	updateQuery := `
+		UPDATE payment_requests
+		SET reminders_sent = $1, last_reminded_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+	if _, err := tx.Exec(updateQuery, step, requestID); err != nil {
+		return false, err
+	}
+
+	pr, err := loadPaymentRequest(tx, requestID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.notifyRequest(tx, kind, 0, pr); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Run sends reminders every interval until ctx is cancelled
+func (s *PaymentRequestService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := s.SendReminders(); err != nil {
+			log.Printf("Payment reminders: %v", err)
+		} else if sent > 0 {
+			log.Printf("Payment reminders: sent %d", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ParseReminderOffsets reads a comma-separated list of durations relative to
+// the due date, such as "-72h,0h,72h"
+func ParseReminderOffsets(value string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/mail"
+	"expense-splitter/internal/models"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidTransition = errors.New("payment confirmation cannot make that change in its current status")
+	ErrReasonRequired    = errors.New("a reason is required")
+)
+
+// paymentTransition is a change of status a payment confirmation can go
+// through. Resolving a dispute ends in either status, so its target is
+// picked by the caller.
+type paymentTransition struct {
+	from           string
+	reasonRequired bool
+	event          string
+}
+
+var paymentTransitions = map[string]paymentTransition{
+	models.AuditActionConfirm: {from: models.PaymentPending, event: events.PaymentConfirmed},
+	models.AuditActionReject:  {from: models.PaymentPending, reasonRequired: true, event: events.PaymentRejected},
+	models.AuditActionDispute: {from: models.PaymentConfirmed, reasonRequired: true, event: events.PaymentDisputed},
+	models.AuditActionResolve: {from: models.PaymentDisputed, event: events.PaymentResolved},
+}
+
+// ConfirmPayment accepts a pending payment, so that it counts towards the
+// group's balances. Only the recipient or a group admin can confirm.
+func (s *ExpenseService) ConfirmPayment(confirmationID, userID int) error {
+	return s.changePaymentStatus(confirmationID, userID, models.AuditActionConfirm, models.PaymentConfirmed, "")
+}
+
+// RejectPayment turns down a pending payment, for example because the money
+// never arrived. Only the recipient or a group admin can reject.
+func (s *ExpenseService) RejectPayment(confirmationID, userID int, reason string) error {
+	return s.changePaymentStatus(confirmationID, userID, models.AuditActionReject, models.PaymentRejected, reason)
+}
+
+// DisputePayment questions a confirmed payment, which stops counting towards
+// balances until the dispute is resolved. Either side of the payment or a
+// group admin can dispute.
+func (s *ExpenseService) DisputePayment(confirmationID, userID int, reason string) error {
+	return s.changePaymentStatus(confirmationID, userID, models.AuditActionDispute, models.PaymentDisputed, reason)
+}
+
+// ResolveDispute confirms a disputed payment again if upheld, and rejects it
+// otherwise. Only the recipient or a group admin can resolve.
+func (s *ExpenseService) ResolveDispute(confirmationID, userID int, upheld bool, reason string) error {
+	to := models.PaymentRejected
+	if upheld {
+		to = models.PaymentConfirmed
+	}
+	return s.changePaymentStatus(confirmationID, userID, models.AuditActionResolve, to, reason)
+}
+
+// GetPaymentHistory lists every status change of a payment confirmation,
+// oldest first
+func (s *ExpenseService) GetPaymentHistory(confirmationID int) ([]models.PaymentTransition, error) {
+	query := `
+		SELECT t.id, t.action, t.from_status, t.to_status, t.actor_id, u.name, t.reason, t.created_at
+		FROM payment_confirmation_transitions t
+		LEFT JOIN users u ON t.actor_id = u.id
+		WHERE t.payment_confirmation_id = $1
+		ORDER BY t.id
+	`
+
+	rows, err := s.db.Query(query, confirmationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.PaymentTransition{}
+	for rows.Next() {
+		var t models.PaymentTransition
+		var fromStatus, actorName, reason sql.NullString
+		var actorID sql.NullInt64
+
+		if err := rows.Scan(&t.ID, &t.Action, &fromStatus, &t.ToStatus, &actorID, &actorName, &reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if fromStatus.Valid {
+			t.FromStatus = fromStatus.String
+		}
+		if actorID.Valid {
+			t.ActorID = &actorID.Int64
+		}
+		if actorName.Valid {
+			t.ActorName = actorName.String
+		}
+		if reason.Valid {
+			t.Reason = reason.String
+		}
+
+		history = append(history, t)
+	}
+
+	return history, rows.Err()
+}
+
+// changePaymentStatus moves a payment confirmation to status to through
+// action, recording the transition, and tells the other side about it
+func (s *ExpenseService) changePaymentStatus(confirmationID, userID int, action, to, reason string) error {
+	transition := paymentTransitions[action]
+	reason = strings.TrimSpace(reason)
+	// Rejecting a disputed payment takes a reason just like rejecting a
+	// pending one
+	if reason == "" && (transition.reasonRequired || to == models.PaymentRejected) {
+		return ErrReasonRequired
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockPayment(tx, confirmationID)
+	if err != nil {
+		return err
+	}
+	if before.Status != transition.from {
+		return ErrInvalidTransition
+	}
+	if err := s.requirePaymentDecision(before, userID, action); err != nil {
+		return err
+	}
+
+	after := *before
+	after.Status = to
+	after.StatusReason = reason
+	switch {
+	case action == models.AuditActionConfirm:
+		confirmer := int64(userID)
+		after.ConfirmedBy = &confirmer
+	case to == models.PaymentRejected:
+		after.ConfirmedBy = nil
+	}
+
+	// A dispute that is resolved in the payment's favour keeps its original
+	// confirmation
+	updateQuery := `
+		UPDATE payment_confirmations
+		SET status = $1, status_reason = NULLIF($2, ''), confirmed_by = $3,
+		    confirmed_at = CASE WHEN $3::integer IS NULL THEN NULL ELSE COALESCE(confirmed_at, CURRENT_TIMESTAMP) END
+		WHERE id = $4
+		RETURNING confirmed_at
+	`
+	var confirmedBy sql.NullInt64
+	if after.ConfirmedBy != nil {
+		confirmedBy = sql.NullInt64{Int64: *after.ConfirmedBy, Valid: true}
+	}
+	var confirmedAt sql.NullTime
+	if err := tx.QueryRow(updateQuery, to, reason, confirmedBy, confirmationID).Scan(&confirmedAt); err != nil {
+		return fmt.Errorf("failed to update payment confirmation: %v", err)
+	}
+
+	// Handle nullable fields
+	after.ConfirmedAt = nil
+	if confirmedAt.Valid {
+		after.ConfirmedAt = &confirmedAt.Time
+	}
+
+	if err := insertPaymentTransition(tx, confirmationID, action, before.Status, to, userID, reason); err != nil {
+		return err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    after.GroupID,
+		actorID:    userID,
+		entityType: models.AuditEntityPayment,
+		entityID:   after.ID,
+		action:     action,
+		before:     before,
+		after:      &after,
+	}); err != nil {
+		return err
+	}
+
+	if err := s.notifyPaymentStatus(tx, &after, userID, action); err != nil {
+		return err
+	}
+
+	// A payment that stops counting towards balances may leave requests
+	// for the same debt unpaid, so their reminders start again
+	switch to {
+	case models.PaymentConfirmed:
+		if err := closePaymentRequests(tx, &after); err != nil {
+			return err
+		}
+	case models.PaymentRejected, models.PaymentDisputed:
+		if err := reopenPaymentRequests(tx, &after); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(transition.event, after.GroupID, after.ID, userID, after))
+	return nil
+}
+
+// requirePaymentDecision checks that userID may take action on pc. The payer
+// never decides on their own payment, but may dispute it once confirmed.
+func (s *ExpenseService) requirePaymentDecision(pc *models.PaymentConfirmation, userID int, action string) error {
+	if action == models.AuditActionDispute && userID == pc.FromUserID {
+		return nil
+	}
+	if userID == pc.ToUserID {
+		return nil
+	}
+	if userID == pc.FromUserID {
+		return ErrPermissionDenied
+	}
+	return s.groupService.RequirePermission(pc.GroupID, userID, PermManagePayments)
+}
+
+// notifyPaymentStatus tells the payer, and for disputes the recipient as well,
+// about a status change made by actorID
+func (s *ExpenseService) notifyPaymentStatus(tx *sql.Tx, pc *models.PaymentConfirmation, actorID int, action string) error {
+	recipients := []int{pc.FromUserID}
+	var kind string
+	switch action {
+	case models.AuditActionConfirm:
+		kind = models.NotificationPaymentConfirmed
+	case models.AuditActionReject:
+		kind = models.NotificationPaymentRejected
+	case models.AuditActionDispute:
+		kind = models.NotificationPaymentDisputed
+		recipients = append(recipients, pc.ToUserID)
+	case models.AuditActionResolve:
+		kind = models.NotificationDisputeResolved
+		recipients = append(recipients, pc.ToUserID)
+	}
+
+	for _, userID := range recipients {
+		if err := notify(tx, notification{
+			userID:   userID,
+			kind:     kind,
+			actorID:  actorID,
+			groupID:  pc.GroupID,
+			entityID: pc.ID,
+			data:     pc,
+		}); err != nil {
+			return err
+		}
+	}
+
+	data := mail.PaymentData{Amount: pc.Amount, Currency: pc.Currency, Reason: pc.StatusReason}
+	switch action {
+	case models.AuditActionConfirm:
+		return queuePaymentMail(tx, models.NotificationPaymentConfirmed, pc.FromUserID, actorID, pc.GroupID, data)
+	case models.AuditActionReject:
+		return queuePaymentMail(tx, models.NotificationPaymentRejected, pc.FromUserID, actorID, pc.GroupID, data)
+	}
+	return nil
+}
+
+// lockPayment loads a payment confirmation and locks it until the
+// transaction ends, so that two status changes cannot race
+func lockPayment(tx *sql.Tx, confirmationID int) (*models.PaymentConfirmation, error) {
+	query := `
+		SELECT id, group_id, from_user_id, to_user_id, amount, currency, exchange_rate, slip_url, slip_trans_ref, slip_data, overpayment,
+		       status, status_reason, confirmed_by, confirmed_at, created_at
+		FROM payment_confirmations
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	pc := &models.PaymentConfirmation{}
+	var slipTransRef, statusReason sql.NullString
+	var slipData []byte
+	var confirmedBy sql.NullInt64
+	var confirmedAt sql.NullTime
+	err := tx.QueryRow(query, confirmationID).Scan(
+		&pc.ID,
+		&pc.GroupID,
+		&pc.FromUserID,
+		&pc.ToUserID,
+		&pc.Amount,
+		&pc.Currency,
+		&pc.ExchangeRate,
+		&pc.SlipURL,
+		&slipTransRef,
+		&slipData,
+		&pc.Overpayment,
+		&pc.Status,
+		&statusReason,
+		&confirmedBy,
+		&confirmedAt,
+		&pc.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if slipTransRef.Valid {
+		pc.SlipTransRef = slipTransRef.String
+	}
+	if slipData != nil {
+		pc.SlipData = slipData
+	}
+	if statusReason.Valid {
+		pc.StatusReason = statusReason.String
+	}
+	if confirmedBy.Valid {
+		pc.ConfirmedBy = &confirmedBy.Int64
+	}
+	if confirmedAt.Valid {
+		pc.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return pc, nil
+}
+
+// insertPaymentTransition adds a status change to a payment confirmation's
+// history. from is empty for its creation.
+func insertPaymentTransition(tx *sql.Tx, confirmationID int, action, from, to string, actorID int, reason string) error {
+	query := `
+		INSERT INTO payment_confirmation_transitions (payment_confirmation_id, action, from_status, to_status, actor_id, reason)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''))
+	`
+	if _, err := tx.Exec(query, confirmationID, action, from, to, actorID, reason); err != nil {
+		return fmt.Errorf("failed to record payment transition: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import "expense-splitter/internal/models"
+
+type Permission string
+
+const (
+	PermViewGroup         Permission = "view_group"
+	PermEditGroup         Permission = "edit_group"
+	PermDeleteGroup       Permission = "delete_group"
+	PermManageMembers     Permission = "manage_members"
+	PermManageRoles       Permission = "manage_roles"
+	PermManageJoinPolicy  Permission = "manage_join_policy"
+	PermEditExpenses      Permission = "edit_expenses"
+	PermRecordPayments    Permission = "record_payments"
+	PermConfirmPayments   Permission = "confirm_payments"
+	PermManagePayments    Permission = "manage_payments" // Decide on payments made to others
+	PermTransferOwnership Permission = "transfer_ownership"
+)
+
+// rolePermissions is the permission matrix for group roles. Owners can do
+// everything; viewers can only look.
+var rolePermissions = map[string]map[Permission]bool{
+	models.RoleOwner: {
+		PermViewGroup:         true,
+		PermEditGroup:         true,
+		PermDeleteGroup:       true,
+		PermManageMembers:     true,
+		PermManageRoles:       true,
+		PermManageJoinPolicy:  true,
+		PermEditExpenses:      true,
+		PermRecordPayments:    true,
+		PermConfirmPayments:   true,
+		PermManagePayments:    true,
+		PermTransferOwnership: true,
+	},
+	models.RoleAdmin: {
+		PermViewGroup:       true,
+		PermEditGroup:       true,
+		PermManageMembers:   true,
+		PermEditExpenses:    true,
+		PermRecordPayments:  true,
+		PermConfirmPayments: true,
+		PermManagePayments:  true,
+	},
+	models.RoleMember: {
+		PermViewGroup:       true,
+		PermEditExpenses:    true,
+		PermRecordPayments:  true,
+		PermConfirmPayments: true,
+	},
+	models.RoleViewer: {
+		PermViewGroup: true,
+	},
+}
+
+func RoleHasPermission(role string, perm Permission) bool {
+	return rolePermissions[role][perm]
+}
+
+// IsValidRole reports whether role can be given to a member. The owner role
+// is only handed over through TransferOwnership.
+func IsValidRole(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleMember || role == models.RoleViewer
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/promptpay"
+	"fmt"
+)
+
+var (
+	ErrNoPromptPayID     = errors.New("recipient has not set a PromptPay ID")
+	ErrPromptPayCurrency = errors.New("PromptPay can only be used to pay THB settlements")
+)
+
+// PromptPayService turns settlements into PromptPay QR codes the payer can
+// scan with their banking app
+type PromptPayService struct {
+	db             *sql.DB
+	expenseService *ExpenseService
+}
+
+func NewPromptPayService(db *sql.DB, expenseService *ExpenseService) *PromptPayService {
+	return &PromptPayService{db: db, expenseService: expenseService}
+}
+
+// SettlementQR builds the QR code for the settlement fromUserID owes
+// toUserID, paid to toUserID's PromptPay ID. currency picks the per-currency
+// settlement; empty means the group's base currency. The QR code asks for
+// what is outstanding, so payments still waiting for confirmation are not
+// paid twice.
+func (s *PromptPayService) SettlementQR(groupID, fromUserID, toUserID int, currency string, size int) (*models.SettlementQR, error) {
+	balance, err := s.expenseService.GetOutstanding(groupID, fromUserID, toUserID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Outstanding <= 0 {
+		return nil, ErrNoSettlement
+	}
+	settlement := &models.Settlement{
+		From:     balance.FromUserID,
+		FromName: balance.FromUserName,
+		To:       balance.ToUserID,
+		ToName:   balance.ToUserName,
+		Amount:   balance.Outstanding,
+		Currency: balance.Currency,
+	}
+	if settlement.Currency != promptpay.Currency {
+		return nil, ErrPromptPayCurrency
+	}
+
+	var id sql.NullString
+	if err := s.db.QueryRow("SELECT promptpay_id FROM users WHERE id = $1", toUserID).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to get PromptPay ID: %v", err)
+	}
+	if !id.Valid {
+		return nil, ErrNoPromptPayID
+	}
+
+	payload, err := promptpay.Payload(id.String, settlement.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	png, err := promptpay.QRCode(payload, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %v", err)
+	}
+
+	return &models.SettlementQR{
+		Settlement:  *settlement,
+		PromptPayID: id.String,
+		Payload:     payload,
+		QRCode:      png,
+	}, nil
+}
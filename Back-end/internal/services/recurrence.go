@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = errors.New("invalid recurrence")
+
+// customSearchDays is how far ahead a custom rule is searched for its next
+// matching day before the series is considered finished
+const customSearchDays = 5 * 366
+
+// schedule works out the occurrence dates of a recurring expense. Periodic
+// schedules count from the start date, so a monthly series starting on the
+// 31st falls on the last day of shorter months and returns to the 31st.
+type schedule struct {
+	frequency string
+	interval  int
+	rule      *dayRule
+	start     time.Time
+}
+
+func newSchedule(frequency string, interval int, rule string, start time.Time) (*schedule, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: interval must be greater than zero", ErrInvalidRecurrence)
+	}
+
+	sch := &schedule{frequency: frequency, interval: interval, start: start}
+	switch frequency {
+	case models.FrequencyDaily, models.FrequencyWeekly, models.FrequencyMonthly, models.FrequencyYearly:
+	case models.FrequencyCustom:
+		r, err := parseDayRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		sch.rule = r
+	default:
+		return nil, fmt.Errorf("%w: unknown frequency %q", ErrInvalidRecurrence, frequency)
+	}
+	return sch, nil
+}
+
+// next returns the first occurrence after the given day. It returns false if
+// a custom rule never matches again.
+func (sch *schedule) next(after time.Time) (time.Time, bool) {
+	if sch.rule != nil {
+		day := after.AddDate(0, 0, 1)
+		if day.Before(sch.start) {
+			day = sch.start
+		}
+		for i := 0; i < customSearchDays; i++ {
+			if sch.rule.matches(day) {
+				return day, true
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		return time.Time{}, false
+	}
+
+	if after.Before(sch.start) {
+		return sch.start, true
+	}
+
+	switch sch.frequency {
+	case models.FrequencyDaily, models.FrequencyWeekly:
+		step := sch.interval
+		if sch.frequency == models.FrequencyWeekly {
+			step *= 7
+		}
+		days := int(after.Sub(sch.start).Hours() / 24)
+		return sch.start.AddDate(0, 0, (days/step+1)*step), true
+	default:
+		months := sch.interval
+		if sch.frequency == models.FrequencyYearly {
+			months *= 12
+		}
+		elapsed := (after.Year()-sch.start.Year())*12 + int(after.Month()-sch.start.Month())
+		k := elapsed/months - 1
+		if k < 0 {
+			k = 0
+		}
+		for {
+			occurrence := addMonthsClamped(sch.start, k*months)
+			if occurrence.After(after) {
+				return occurrence, true
+			}
+			k++
+		}
+	}
+}
+
+// addMonthsClamped adds n months to t, moving to the last day of the month
+// when t's day does not exist there
+func addMonthsClamped(t time.Time, n int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// dayRule is the date part of a cron expression: day of month, month and
+// day of week. Each field takes *, numbers, ranges (1-5), lists (1,15) and
+// steps (*/2, 1-31/7). Sunday is 0 or 7. Like cron, when both day fields
+// are restricted a day matches if either of them does.
+type dayRule struct {
+	daysOfMonth   map[int]bool
+	months        map[int]bool
+	daysOfWeek    map[int]bool
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func parseDayRule(rule string) (*dayRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: rule needs three fields: day of month, month and day of week", ErrInvalidRecurrence)
+	}
+
+	var r dayRule
+	var err error
+	if r.daysOfMonth, err = parseRuleField(fields[0], 1, 31); err != nil {
+		return nil, err
+	}
+	if r.months, err = parseRuleField(fields[1], 1, 12); err != nil {
+		return nil, err
+	}
+	if r.daysOfWeek, err = parseRuleField(fields[2], 0, 7); err != nil {
+		return nil, err
+	}
+	if r.daysOfWeek[7] {
+		r.daysOfWeek[0] = true
+	}
+	r.anyDayOfMonth = fields[0] == "*"
+	r.anyDayOfWeek = fields[2] == "*"
+
+	return &r, nil
+}
+
+func parseRuleField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%w: bad step in %q", ErrInvalidRecurrence, part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("%w: bad value %q", ErrInvalidRecurrence, part)
+			}
+			hi = lo
+			if step > 1 {
+				// As in cron, "5/2" means every second value from 5
+				hi = max
+			}
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("%w: bad value %q", ErrInvalidRecurrence, part)
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%w: %q is outside %d-%d", ErrInvalidRecurrence, part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (r *dayRule) matches(day time.Time) bool {
+	if !r.months[int(day.Month())] {
+		return false
+	}
+
+	domMatch := r.daysOfMonth[day.Day()]
+	dowMatch := r.daysOfWeek[int(day.Weekday())]
+	switch {
+	case r.anyDayOfMonth && r.anyDayOfWeek:
+		return true
+	case r.anyDayOfMonth:
+		return dowMatch
+	case r.anyDayOfWeek:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		interval  int
+		rule      string
+		start     string
+		after     string
+		want      string // Empty when the series has no next occurrence
+	}{
+		{name: "before start", frequency: models.FrequencyDaily, interval: 1, start: "2024-01-10", after: "2024-01-01", want: "2024-01-10"},
+		{name: "daily", frequency: models.FrequencyDaily, interval: 1, start: "2024-01-01", after: "2024-01-01", want: "2024-01-02"},
+		{name: "every third day", frequency: models.FrequencyDaily, interval: 3, start: "2024-01-01", after: "2024-01-05", want: "2024-01-07"},
+		{name: "fortnightly", frequency: models.FrequencyWeekly, interval: 2, start: "2024-01-01", after: "2024-01-01", want: "2024-01-15"},
+		{name: "fortnightly between occurrences", frequency: models.FrequencyWeekly, interval: 2, start: "2024-01-01", after: "2024-01-10", want: "2024-01-15"},
+		{name: "monthly", frequency: models.FrequencyMonthly, interval: 1, start: "2024-01-15", after: "2024-03-15", want: "2024-04-15"},
+		{name: "monthly clamped to leap day", frequency: models.FrequencyMonthly, interval: 1, start: "2024-01-31", after: "2024-01-31", want: "2024-02-29"},
+		{name: "monthly back to the 31st", frequency: models.FrequencyMonthly, interval: 1, start: "2024-01-31", after: "2024-02-29", want: "2024-03-31"},
+		{name: "quarterly", frequency: models.FrequencyMonthly, interval: 3, start: "2024-01-31", after: "2024-02-01", want: "2024-04-30"},
+		{name: "yearly from leap day", frequency: models.FrequencyYearly, interval: 1, start: "2024-02-29", after: "2024-02-29", want: "2025-02-28"},
+		{name: "yearly back to leap day", frequency: models.FrequencyYearly, interval: 1, start: "2024-02-29", after: "2027-03-01", want: "2028-02-29"},
+		{name: "custom days of month", frequency: models.FrequencyCustom, interval: 1, rule: "1,15 * *", start: "2024-01-01", after: "2024-01-01", want: "2024-01-15"},
+		{name: "custom weekdays", frequency: models.FrequencyCustom, interval: 1, rule: "* * 1-5", start: "2024-01-01", after: "2024-01-05", want: "2024-01-08"},
+		{name: "custom before start", frequency: models.FrequencyCustom, interval: 1, rule: "* * *", start: "2024-01-10", after: "2024-01-01", want: "2024-01-10"},
+		{name: "custom never matching", frequency: models.FrequencyCustom, interval: 1, rule: "30 2 *", start: "2024-01-01", after: "2024-01-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, err := newSchedule(tt.frequency, tt.interval, tt.rule, date(tt.start))
+			if err != nil {
+				t.Fatalf("newSchedule() error = %v", err)
+			}
+			got, ok := sch.next(date(tt.after))
+			if tt.want == "" {
+				if ok {
+					t.Errorf("next(%s) = %s, want none", tt.after, got.Format("2006-01-02"))
+				}
+				return
+			}
+			if !ok || !got.Equal(date(tt.want)) {
+				t.Errorf("next(%s) = %s, %v, want %s", tt.after, got.Format("2006-01-02"), ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		interval  int
+		rule      string
+	}{
+		{name: "zero interval", frequency: models.FrequencyDaily, interval: 0},
+		{name: "unknown frequency", frequency: "hourly", interval: 1},
+		{name: "custom without rule", frequency: models.FrequencyCustom, interval: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSchedule(tt.frequency, tt.interval, tt.rule, date("2024-01-01")); !errors.Is(err, ErrInvalidRecurrence) {
+				t.Errorf("newSchedule() error = %v, want %v", err, ErrInvalidRecurrence)
+			}
+		})
+	}
+}
+
+func TestParseDayRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		match   []string
+		noMatch []string
+		wantErr bool
+	}{
+		{rule: "* * *", match: []string{"2024-01-01", "2024-12-31"}},
+		{rule: "1,15 * *", match: []string{"2024-01-01", "2024-02-15"}, noMatch: []string{"2024-01-02"}},
+		{rule: "*/10 * *", match: []string{"2024-01-01", "2024-01-11", "2024-01-31"}, noMatch: []string{"2024-01-10"}},
+		{rule: "5/10 * *", match: []string{"2024-01-05", "2024-01-25"}, noMatch: []string{"2024-01-01"}},
+		{rule: "1 1-3 *", match: []string{"2024-03-01"}, noMatch: []string{"2024-04-01"}},
+		// 2024-01-07 is a Sunday
+		{rule: "* * 7", match: []string{"2024-01-07"}, noMatch: []string{"2024-01-08"}},
+		{rule: "* * 0", match: []string{"2024-01-07"}},
+		// Both day fields restricted: either may match
+		{rule: "13 * 5", match: []string{"2024-01-05", "2024-02-13"}, noMatch: []string{"2024-01-06"}},
+		{rule: "* *", wantErr: true},
+		{rule: "* * * *", wantErr: true},
+		{rule: "0 * *", wantErr: true},
+		{rule: "32 * *", wantErr: true},
+		{rule: "* 13 *", wantErr: true},
+		{rule: "* * 8", wantErr: true},
+		{rule: "5-1 * *", wantErr: true},
+		{rule: "*/0 * *", wantErr: true},
+		{rule: "*/x * *", wantErr: true},
+		{rule: "a * *", wantErr: true},
+		{rule: "1-b * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := parseDayRule(tt.rule)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRecurrence) {
+					t.Fatalf("parseDayRule(%q) error = %v, want %v", tt.rule, err, ErrInvalidRecurrence)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDayRule(%q) error = %v", tt.rule, err)
+			}
+			for _, day := range tt.match {
+				if !r.matches(date(day)) {
+					t.Errorf("%q does not match %s", tt.rule, day)
+				}
+			}
+			for _, day := range tt.noMatch {
+				if r.matches(date(day)) {
+					t.Errorf("%q matches %s", tt.rule, day)
+				}
+			}
+		})
+	}
+}
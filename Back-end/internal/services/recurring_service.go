@@ -0,0 +1,574 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrRecurringNotFound = errors.New("recurring expense not found")
+	ErrRecurringEnded    = errors.New("recurring expense has no more occurrences")
+)
+
+const (
+	// maxRecurringAttempts is how many times in a row an occurrence is
+	// tried before its series is paused. With the backoff below that spans
+	// about a day.
+	maxRecurringAttempts = 10
+	maxRecurringBackoff  = 6 * time.Hour
+)
+
+const recurringColumns = `id, group_id, COALESCE(created_by, 0), template, frequency, repeat_interval, rule,
+		start_date, end_date, max_occurrences, occurrences, next_date, paused, last_error, created_at`
+
+// RecurringService stores recurring expense templates and posts their
+// occurrences as real expenses
+type RecurringService struct {
+	db             *sql.DB
+	expenseService *ExpenseService
+}
+
+func NewRecurringService(db *sql.DB, expenseService *ExpenseService) *RecurringService {
+	return &RecurringService{db: db, expenseService: expenseService}
+}
+
+func scanRecurring(row interface{ Scan(...any) error }) (*models.RecurringExpense, error) {
+	rec := &models.RecurringExpense{}
+	var template []byte
+	var endDate, nextDate sql.NullTime
+	var maxOccurrences sql.NullInt64
+
+	if err := row.Scan(
+		&rec.ID,
+		&rec.GroupID,
+		&rec.CreatedBy,
+		&template,
+		&rec.Frequency,
+		&rec.Interval,
+		&rec.Rule,
+		&rec.StartDate,
+		&endDate,
+		&maxOccurrences,
+		&rec.Occurrences,
+		&nextDate,
+		&rec.Paused,
+		&rec.LastError,
+		&rec.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(template, &rec.Template); err != nil {
+		return nil, fmt.Errorf("invalid template for recurring expense %d: %v", rec.ID, err)
+	}
+
+	// Handle nullable fields
+	if endDate.Valid {
+		rec.EndDate = &endDate.Time
+	}
+	if maxOccurrences.Valid {
+		n := int(maxOccurrences.Int64)
+		rec.MaxOccurrences = &n
+	}
+	if nextDate.Valid {
+		rec.NextDate = &nextDate.Time
+	}
+
+	return rec, nil
+}
+
+// buildRecurring validates req and fills in the schedule fields of rec
+func (s *RecurringService) buildRecurring(rec *models.RecurringExpense, req models.RecurringExpenseRequest) (*schedule, error) {
+	template := req.Template
+	template.GroupID = rec.GroupID
+	template.ExpenseDate = ""
+
+	// Check the template now rather than on the first occurrence
+	splitType := normalizeSplitType(template.SplitType)
+	amount, splits, _, err := buildSplits(template, splitType)
+	if err != nil {
+		return nil, err
+	}
+	payers, _, err := computePayers(template.PaidBy, template.Payers, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.expenseService.requireSplitParticipants(rec.GroupID, payers, splits); err != nil {
+		return nil, err
+	}
+	template.Category = NormalizeCategory(template.Category)
+	if template.Category != "" {
+		if err := requireCategory(s.db, rec.GroupID, template.Category); err != nil {
+			return nil, err
+		}
+	}
+
+	startDate, err := parseExpenseDate(req.StartDate, today())
+	if err != nil {
+		return nil, err
+	}
+
+	interval := req.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	sch, err := newSchedule(req.Frequency, interval, req.Rule, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.EndDate = nil
+	if req.EndDate != "" {
+		endDate, err := parseExpenseDate(req.EndDate, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if endDate.Before(startDate) {
+			return nil, fmt.Errorf("%w: end_date is before start_date", ErrInvalidRecurrence)
+		}
+		rec.EndDate = &endDate
+	}
+
+	rec.MaxOccurrences = nil
+	if req.MaxOccurrences < 0 {
+		return nil, fmt.Errorf("%w: max_occurrences must not be negative", ErrInvalidRecurrence)
+	}
+	if req.MaxOccurrences > 0 {
+		rec.MaxOccurrences = &req.MaxOccurrences
+	}
+
+	rec.Template = template
+	rec.Frequency = req.Frequency
+	rec.Interval = interval
+	rec.Rule = req.Rule
+	if req.Frequency != models.FrequencyCustom {
+		rec.Rule = ""
+	}
+	rec.StartDate = startDate
+
+	return sch, nil
+}
+
+// nextDate returns the occurrence that follows after, or nil once the series
+// has reached its end date or occurrence limit
+func nextDate(rec *models.RecurringExpense, sch *schedule, after time.Time) *time.Time {
+	if rec.MaxOccurrences != nil && rec.Occurrences >= *rec.MaxOccurrences {
+		return nil
+	}
+	next, ok := sch.next(after)
+	if !ok || (rec.EndDate != nil && next.After(*rec.EndDate)) {
+		return nil
+	}
+	return &next
+}
+
+func scheduleOf(rec *models.RecurringExpense) (*schedule, error) {
+	return newSchedule(rec.Frequency, rec.Interval, rec.Rule, rec.StartDate)
+}
+
+func (s *RecurringService) CreateRecurring(groupID, createdBy int, req models.RecurringExpenseRequest) (*models.RecurringExpense, error) {
+	rec := &models.RecurringExpense{GroupID: groupID, CreatedBy: createdBy}
+	sch, err := s.buildRecurring(rec, req)
+	if err != nil {
+		return nil, err
+	}
+	rec.NextDate = nextDate(rec, sch, rec.StartDate.AddDate(0, 0, -1))
+
+	template, err := json.Marshal(rec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO recurring_expenses (group_id, created_by, template, frequency, repeat_interval, rule,
+		                                start_date, end_date, max_occurrences, next_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING ` + recurringColumns
+
+	return scanRecurring(s.db.QueryRow(query, groupID, createdBy, template, rec.Frequency, rec.Interval, rec.Rule,
+		rec.StartDate, rec.EndDate, rec.MaxOccurrences, rec.NextDate))
+}
+
+func (s *RecurringService) GetGroupRecurring(groupID int) ([]models.RecurringExpense, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE group_id = $1 ORDER BY next_date NULLS LAST, id`
+
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurring := []models.RecurringExpense{}
+	for rows.Next() {
+		rec, err := scanRecurring(rows)
+		if err != nil {
+			return nil, err
+		}
+		recurring = append(recurring, *rec)
+	}
+
+	return recurring, rows.Err()
+}
+
+func (s *RecurringService) GetRecurring(groupID, recurringID int) (*models.RecurringExpense, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE id = $1 AND group_id = $2`
+
+	rec, err := scanRecurring(s.db.QueryRow(query, recurringID, groupID))
+	if err == sql.ErrNoRows {
+		return nil, ErrRecurringNotFound
+	}
+	return rec, err
+}
+
+// lockRecurring loads a series for update inside tx
+func lockRecurring(tx *sql.Tx, groupID, recurringID int) (*models.RecurringExpense, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE id = $1 AND group_id = $2 FOR UPDATE`
+
+	rec, err := scanRecurring(tx.QueryRow(query, recurringID, groupID))
+	if err == sql.ErrNoRows {
+		return nil, ErrRecurringNotFound
+	}
+	return rec, err
+}
+
+// resumeAfter is the day after which a rescheduled series continues: today
+// onwards, and never on or before an occurrence that was already handled
+func resumeAfter(tx *sql.Tx, recurringID int) (time.Time, error) {
+	after := today().AddDate(0, 0, -1)
+
+	var lastRun sql.NullTime
+	if err := tx.QueryRow("SELECT MAX(occurrence_date) FROM recurring_expense_runs WHERE recurring_id = $1", recurringID).Scan(&lastRun); err != nil {
+		return time.Time{}, err
+	}
+	if lastRun.Valid && lastRun.Time.After(after) {
+		after = lastRun.Time
+	}
+	return after, nil
+}
+
+// UpdateRecurring replaces the template and schedule of a series. Expenses
+// already posted are left alone; the series continues from today.
+func (s *RecurringService) UpdateRecurring(groupID, recurringID int, req models.RecurringExpenseRequest) (*models.RecurringExpense, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rec, err := lockRecurring(tx, groupID, recurringID)
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := s.buildRecurring(rec, req)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := resumeAfter(tx, recurringID)
+	if err != nil {
+		return nil, err
+	}
+	rec.NextDate = nextDate(rec, sch, after)
+
+	template, err := json.Marshal(rec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE recurring_expenses
+		SET template = $1, frequency = $2, repeat_interval = $3, rule = $4, start_date = $5,
+		    end_date = $6, max_occurrences = $7, next_date = $8, last_error = ''
+		WHERE id = $9
+		RETURNING ` + recurringColumns
+
+	rec, err = scanRecurring(tx.QueryRow(query, template, rec.Frequency, rec.Interval, rec.Rule, rec.StartDate,
+		rec.EndDate, rec.MaxOccurrences, rec.NextDate, recurringID))
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, tx.Commit()
+}
+
+// SetPaused pauses or resumes a series. Occurrences that fell due while it
+// was paused are not posted on resume.
+func (s *RecurringService) SetPaused(groupID, recurringID int, paused bool) (*models.RecurringExpense, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rec, err := lockRecurring(tx, groupID, recurringID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := rec.NextDate
+	if !paused && rec.Paused && next != nil {
+		sch, err := scheduleOf(rec)
+		if err != nil {
+			return nil, err
+		}
+		after, err := resumeAfter(tx, recurringID)
+		if err != nil {
+			return nil, err
+		}
+		if !next.After(after) {
+			next = nextDate(rec, sch, after)
+		}
+	}
+
+	query := `
+		UPDATE recurring_expenses
+		SET paused = $1, next_date = $2, last_error = CASE WHEN $1 THEN last_error ELSE '' END,
+		    attempts = CASE WHEN $1 THEN attempts ELSE 0 END, retry_at = CASE WHEN $1 THEN retry_at ELSE NULL END
+		WHERE id = $3
+		RETURNING ` + recurringColumns
+
+	rec, err = scanRecurring(tx.QueryRow(query, paused, next, recurringID))
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, tx.Commit()
+}
+
+// SkipNext skips the next occurrence of a series without posting it
+func (s *RecurringService) SkipNext(groupID, recurringID int) (*models.RecurringExpense, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rec, err := lockRecurring(tx, groupID, recurringID)
+	if err != nil {
+		return nil, err
+	}
+	if rec.NextDate == nil {
+		return nil, ErrRecurringEnded
+	}
+
+	runQuery := `
+		INSERT INTO recurring_expense_runs (recurring_id, occurrence_date, skipped)
+		VALUES ($1, $2, TRUE)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(runQuery, recurringID, *rec.NextDate); err != nil {
+		return nil, err
+	}
+
+	if rec, err = advanceRecurring(tx, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, tx.Commit()
+}
+
+// advanceRecurring counts the current occurrence as handled and moves the
+// series on to the next one
+func advanceRecurring(tx *sql.Tx, rec *models.RecurringExpense) (*models.RecurringExpense, error) {
+	sch, err := scheduleOf(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.Occurrences++
+	next := nextDate(rec, sch, *rec.NextDate)
+
+	query := `
+		UPDATE recurring_expenses
+		SET occurrences = $1, next_date = $2, last_error = '', attempts = 0, retry_at = NULL
+		WHERE id = $3
+		RETURNING ` + recurringColumns
+
+	return scanRecurring(tx.QueryRow(query, rec.Occurrences, next, rec.ID))
+}
+
+func (s *RecurringService) DeleteRecurring(groupID, recurringID int) error {
+	result, err := s.db.Exec("DELETE FROM recurring_expenses WHERE id = $1 AND group_id = $2", recurringID, groupID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecurringNotFound
+	}
+	return nil
+}
+
+// ProcessDue posts every occurrence that is due on or before now, including
+// ones missed while the server was down, and returns how many expenses it
+// created. Each occurrence is posted in the same transaction that records it
+// in recurring_expense_runs, and rows being handled elsewhere are skipped, so
+// several instances can run the scheduler at once.
+func (s *RecurringService) ProcessDue(now time.Time) (int, error) {
+	posted := 0
+	for {
+		done, created, err := s.processNext(now)
+		if err != nil {
+			return posted, err
+		}
+		if done {
+			return posted, nil
+		}
+		if created {
+			posted++
+		}
+	}
+}
+
+// processNext handles the earliest due occurrence. It reports done when
+// nothing is due.
+func (s *RecurringService) processNext(now time.Time) (done, created bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + recurringColumns + `
+		FROM recurring_expenses r
+		WHERE NOT paused AND next_date <= $1
+		AND (retry_at IS NULL OR retry_at <= CURRENT_TIMESTAMP)
+		AND NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = r.group_id AND g.deleted_at IS NOT NULL)
+		ORDER BY next_date, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rec, err := scanRecurring(tx.QueryRow(query, now))
+	if err == sql.ErrNoRows {
+		return true, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	// The run row is what stops an occurrence from being posted twice
+	var inserted bool
+	runQuery := `
+		INSERT INTO recurring_expense_runs (recurring_id, occurrence_date)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING TRUE
+	`
+	err = tx.QueryRow(runQuery, rec.ID, *rec.NextDate).Scan(&inserted)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, err
+	}
+
+	var expense *models.Expense
+	if inserted {
+		req := rec.Template
+		req.GroupID = rec.GroupID
+		req.ExpenseDate = rec.NextDate.Format(expenseDateLayout)
+
+		// Posted by the scheduler, so the audit log records no actor
+		expense, err = s.expenseService.createExpense(tx, req, 0)
+		if err != nil {
+			tx.Rollback()
+			if !isTemplateError(err) {
+				return false, false, s.retryLater(rec.ID, err)
+			}
+			return false, false, s.pauseWithError(rec.ID, err)
+		}
+
+		if _, err := tx.Exec("UPDATE recurring_expense_runs SET expense_id = $1 WHERE recurring_id = $2 AND occurrence_date = $3", expense.ID, rec.ID, *rec.NextDate); err != nil {
+			return false, false, err
+		}
+	}
+
+	if _, err := advanceRecurring(tx, rec); err != nil {
+		return false, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, false, err
+	}
+
+	if expense != nil {
+		s.expenseService.events.Publish(events.New(events.ExpenseCreated, expense.GroupID, expense.ID, 0, expense))
+	}
+	return false, inserted, nil
+}
+
+// isTemplateError reports whether err means the template itself can no longer
+// be posted, as opposed to a failure worth retrying
+func isTemplateError(err error) bool {
+	return errors.Is(err, ErrInvalidSplit) ||
+		errors.Is(err, ErrInvalidCategory) ||
+		errors.Is(err, ErrNotParticipant) ||
+		errors.Is(err, ErrExchangeRateNotFound) ||
+		errors.Is(err, money.ErrInvalidRate)
+}
+
+// pauseWithError stops a series whose template no longer produces a valid
+// expense, e.g. because a participant left the group, so it is not retried
+// forever. The reason is kept for the group to see.
+func (s *RecurringService) pauseWithError(recurringID int, cause error) error {
+	log.Printf("Pausing recurring expense %d: %v", recurringID, cause)
+	_, err := s.db.Exec("UPDATE recurring_expenses SET paused = TRUE, last_error = $1 WHERE id = $2", cause.Error(), recurringID)
+	return err
+}
+
+// retryLater puts off a series whose occurrence failed for a reason worth
+// retrying, waiting twice as long after each failure in a row, so the series
+// due after it are not held up. It is paused once it has failed
+// maxRecurringAttempts times.
+func (s *RecurringService) retryLater(recurringID int, cause error) error {
+	var attempts int
+	err := s.db.QueryRow("SELECT attempts + 1 FROM recurring_expenses WHERE id = $1", recurringID).Scan(&attempts)
+	if err != nil {
+		return err
+	}
+	if attempts >= maxRecurringAttempts {
+		return s.pauseWithError(recurringID, cause)
+	}
+
+	log.Printf("Retrying recurring expense %d later: %v", recurringID, cause)
+	backoff := min(time.Duration(1<<attempts)*time.Minute, maxRecurringBackoff)
+	query := `
+		UPDATE recurring_expenses
+		SET attempts = $1, last_error = $2, retry_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		WHERE id = $4
+	`
+	_, err = s.db.Exec(query, attempts, cause.Error(), backoff.Seconds(), recurringID)
+	return err
+}
+
+// Run calls ProcessDue every interval until ctx is cancelled
+func (s *RecurringService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := s.ProcessDue(today()); err != nil {
+			log.Printf("Recurring expenses: %v", err)
+		} else if count > 0 {
+			log.Printf("Recurring expenses: posted %d expenses", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/internal/slip"
+	"expense-splitter/internal/storage"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+const (
+	// unusedSlipRetention is how long a slip that no payment confirmation
+	// was made with is kept
+	unusedSlipRetention = 24 * time.Hour
+
+	maxDeletionAttempts = 10
+	deletionBatchSize   = 100
+)
+
+var (
+	ErrSlipNotFound    = errors.New("slip not found, upload it first")
+	ErrSlipAlreadyUsed = errors.New("this slip has already been used for a payment")
+)
+
+// SlipService reads uploaded payment slips, keeps them in file storage and
+// remembers what was on them until a payment confirmation is made with the
+// slip
+type SlipService struct {
+	db       *sql.DB
+	verifier slip.Verifier
+	files    storage.Storage
+}
+
+func NewSlipService(db *sql.DB, verifier slip.Verifier, files storage.Storage) *SlipService {
+	return &SlipService{db: db, verifier: verifier, files: files}
+}
+
+// UploadSlip reads the QR code on a slip image, checks the slip with the
+// verifier and stores the image. It returns the URL to pass when creating
+// the payment confirmation. Slips whose transfer already paid for a
+// confirmation are rejected before anything is stored. The image is stored
+// under the format it decoded as, whatever the client said it was.
+func (s *SlipService) UploadSlip(ctx context.Context, userID int, r io.ReadSeeker, size int64) (string, *slip.Slip, error) {
+	sl, format, err := slip.Decode(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := s.verifier.Verify(ctx, sl); err != nil {
+		return "", nil, err
+	}
+
+	var used bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM payment_confirmations WHERE slip_trans_ref = $1 AND status <> 'rejected')", sl.TransRef).Scan(&used); err != nil {
+		return "", nil, err
+	}
+	if used {
+		return "", nil, ErrSlipAlreadyUsed
+	}
+
+	key, err := storage.NewKey(fmt.Sprintf("slips/%d", userID), slip.Formats[format].Ext)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	if err := s.files.Put(ctx, key, r, size, slip.Formats[format].ContentType); err != nil {
+		return "", nil, fmt.Errorf("failed to store slip: %v", err)
+	}
+
+	url, err := s.files.URL(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := json.Marshal(sl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		INSERT INTO payment_slips (user_id, slip_url, storage_key, trans_ref, data)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := s.db.Exec(query, userID, url, key, sl.TransRef, data); err != nil {
+		// Nothing refers to the file yet, so it can go straight away
+		s.files.Delete(ctx, key)
+		return "", nil, fmt.Errorf("failed to record slip: %v", err)
+	}
+
+	return url, sl, nil
+}
+
+// SignURLs replaces the slip URLs of confirmations whose slip is in file
+// storage with fresh ones, since the URLs of some backends expire
+func (s *SlipService) SignURLs(ctx context.Context, confirmations []models.PaymentConfirmation) error {
+	for i := range confirmations {
+		if confirmations[i].SlipKey == "" {
+			continue
+		}
+		url, err := s.files.URL(ctx, confirmations[i].SlipKey)
+		if err != nil {
+			return err
+		}
+		confirmations[i].SlipURL = url
+	}
+	return nil
+}
+
+// Cleanup removes slips no payment confirmation was made with, then deletes
+// the files of slips that are gone from storage. It returns how many files
+// were deleted.
+func (s *SlipService) Cleanup(ctx context.Context) (int, error) {
+	// Removing the rows queues their files for deletion
+	query := `
+		DELETE FROM payment_slips
+		WHERE payment_confirmation_id IS NULL
+		AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`
+	if _, err := s.db.Exec(query, unusedSlipRetention.Seconds()); err != nil {
+		return 0, fmt.Errorf("failed to remove unused slips: %v", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several instances clean up without clashing
+	rows, err := tx.Query(`
+		SELECT id, storage_key
+		FROM storage_deletions
+		WHERE attempts < $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, maxDeletionAttempts, deletionBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type deletion struct {
+		id  int64
+		key string
+	}
+	var due []deletion
+	for rows.Next() {
+		var d deletion
+		if err := rows.Scan(&d.id, &d.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, d := range due {
+		if deleteErr := s.files.Delete(ctx, d.key); deleteErr != nil {
+			log.Printf("Storage: failed to delete %s: %v", d.key, deleteErr)
+			if _, err := tx.Exec("UPDATE storage_deletions SET attempts = attempts + 1, last_error = $1 WHERE id = $2", deleteErr.Error(), d.id); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+
+		if _, err := tx.Exec("DELETE FROM storage_deletions WHERE id = $1", d.id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, tx.Commit()
+}
+
+// Run calls Cleanup every interval until ctx is cancelled
+func (s *SlipService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := s.Cleanup(ctx); err != nil {
+			log.Printf("Storage cleanup: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Storage cleanup: deleted %d files", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// uploadedSlip returns the ID, transaction reference and data of the unused
+// slip userID uploaded to url
+func uploadedSlip(tx *sql.Tx, userID int, url string) (int, string, []byte, error) {
+	query := `
+		SELECT id, trans_ref, data
+		FROM payment_slips
+		WHERE user_id = $1 AND slip_url = $2 AND payment_confirmation_id IS NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	var slipID int
+	var transRef string
+	var data []byte
+	err := tx.QueryRow(query, userID, url).Scan(&slipID, &transRef, &data)
+	if err == sql.ErrNoRows {
+		return 0, "", nil, ErrSlipNotFound
+	}
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return slipID, transRef, data, nil
+}
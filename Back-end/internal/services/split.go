@@ -0,0 +1,271 @@
+package services
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var ErrInvalidSplit = errors.New("invalid split")
+
+// Percentages and shares are kept to four decimal places and turned into
+// integer weights so that allocation never touches float64
+const (
+	ratioScale      = 10000
+	fullPercentages = 100 * ratioScale
+)
+
+// computeSplits turns the split type and per-user values of a request into
+// the amount each participant owes. The amounts always add up to amount;
+// leftover minor units are handed out by money.Allocate.
+func computeSplits(amount money.Money, splitType string, splitWith []int, values []models.SplitValue) ([]models.Split, error) {
+	if splitType == models.SplitEqual {
+		if len(splitWith) == 0 {
+			return nil, fmt.Errorf("%w: split_with must not be empty", ErrInvalidSplit)
+		}
+		if err := checkDuplicateUsers(splitWith); err != nil {
+			return nil, err
+		}
+
+		splits := make([]models.Split, 0, len(splitWith))
+		for i, part := range amount.Split(len(splitWith)) {
+			splits = append(splits, models.Split{UserID: splitWith[i], Amount: part})
+		}
+		return splits, nil
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: split_values are required for %s split", ErrInvalidSplit, splitType)
+	}
+
+	userIDs := make([]int, 0, len(values))
+	for _, v := range values {
+		if v.Value < 0 {
+			return nil, fmt.Errorf("%w: value for user %d must not be negative", ErrInvalidSplit, v.UserID)
+		}
+		userIDs = append(userIDs, v.UserID)
+	}
+	if err := checkDuplicateUsers(userIDs); err != nil {
+		return nil, err
+	}
+
+	var amounts []money.Money
+	switch splitType {
+	case models.SplitExact:
+		total := money.Money(0)
+		for _, v := range values {
+			part := money.FromFloat(v.Value)
+			if math.Abs(part.Float64()-v.Value) > 1e-9 {
+				return nil, fmt.Errorf("%w: amount for user %d has more than two decimal places", ErrInvalidSplit, v.UserID)
+			}
+			amounts = append(amounts, part)
+			total += part
+		}
+		if total != amount {
+			return nil, fmt.Errorf("%w: exact amounts add up to %s but the expense is %s", ErrInvalidSplit, total, amount)
+		}
+	case models.SplitPercentage:
+		weights, total := ratioWeights(values)
+		if total != fullPercentages {
+			return nil, fmt.Errorf("%w: percentages add up to %s but must add up to 100", ErrInvalidSplit, formatRatio(total))
+		}
+		amounts, _ = amount.Allocate(weights)
+	case models.SplitShares:
+		weights, total := ratioWeights(values)
+		if total <= 0 {
+			return nil, fmt.Errorf("%w: total shares must be greater than zero", ErrInvalidSplit)
+		}
+		amounts, _ = amount.Allocate(weights)
+	default:
+		return nil, fmt.Errorf("%w: unknown split type %q", ErrInvalidSplit, splitType)
+	}
+
+	splits := make([]models.Split, 0, len(values))
+	for i, v := range values {
+		value := v.Value
+		splits = append(splits, models.Split{UserID: v.UserID, Amount: amounts[i], Value: &value})
+	}
+
+	return splits, nil
+}
+
+func ratioWeights(values []models.SplitValue) ([]int64, int64) {
+	weights := make([]int64, len(values))
+	var total int64
+	for i, v := range values {
+		weights[i] = int64(math.Round(v.Value * ratioScale))
+		total += weights[i]
+	}
+	return weights, total
+}
+
+func formatRatio(weight int64) string {
+	return strconv.FormatFloat(float64(weight)/ratioScale, 'f', -1, 64)
+}
+
+func checkDuplicateUsers(userIDs []int) error {
+	seen := make(map[int]bool, len(userIDs))
+	for _, id := range userIDs {
+		if seen[id] {
+			return fmt.Errorf("%w: user %d appears more than once", ErrInvalidSplit, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// computeItemizedSplits works out the total of an itemized receipt and what
+// each consumer owes. Every item is shared equally by its consumers; the
+// adjustments are then spread in proportion to each person's item subtotal
+// by allocating the whole total over those subtotals.
+func computeItemizedSplits(items []models.ExpenseItem, adj *models.ExpenseAdjustments) (money.Money, []models.Split, error) {
+	if len(items) == 0 {
+		return 0, nil, fmt.Errorf("%w: items are required for itemized split", ErrInvalidSplit)
+	}
+	if adj == nil {
+		adj = &models.ExpenseAdjustments{}
+	}
+
+	subtotal := money.Money(0)
+	userOrder := []int{}
+	userSubtotals := make(map[int]money.Money)
+
+	for i, item := range items {
+		if item.Amount < 0 {
+			return 0, nil, fmt.Errorf("%w: item %d must not have a negative amount", ErrInvalidSplit, i+1)
+		}
+		if len(item.Consumers) == 0 {
+			return 0, nil, fmt.Errorf("%w: item %d needs at least one consumer", ErrInvalidSplit, i+1)
+		}
+		if err := checkDuplicateUsers(item.Consumers); err != nil {
+			return 0, nil, err
+		}
+
+		for j, part := range item.Amount.Split(len(item.Consumers)) {
+			userID := item.Consumers[j]
+			if _, ok := userSubtotals[userID]; !ok {
+				userOrder = append(userOrder, userID)
+			}
+			userSubtotals[userID] += part
+		}
+		subtotal += item.Amount
+	}
+
+	if adj.Discount < 0 || adj.Tip < 0 {
+		return 0, nil, fmt.Errorf("%w: discount and tip must not be negative", ErrInvalidSplit)
+	}
+	if adj.Discount > subtotal {
+		return 0, nil, fmt.Errorf("%w: discount %s is more than the item subtotal %s", ErrInvalidSplit, adj.Discount, subtotal)
+	}
+	serviceWeight := int64(math.Round(adj.ServiceChargePercent * ratioScale))
+	taxWeight := int64(math.Round(adj.TaxPercent * ratioScale))
+	if serviceWeight < 0 || taxWeight < 0 || serviceWeight > fullPercentages || taxWeight > fullPercentages {
+		return 0, nil, fmt.Errorf("%w: service charge and tax must be between 0 and 100 percent", ErrInvalidSplit)
+	}
+
+	discounted := subtotal - adj.Discount
+	serviceCharge := discounted.MulFrac(serviceWeight, fullPercentages)
+	tax := (discounted + serviceCharge).MulFrac(taxWeight, fullPercentages)
+	total := discounted + serviceCharge + tax + adj.Tip
+	if total <= 0 {
+		return 0, nil, fmt.Errorf("%w: itemized total must be greater than zero", ErrInvalidSplit)
+	}
+
+	weights := make([]int64, len(userOrder))
+	for i, userID := range userOrder {
+		weights[i] = int64(userSubtotals[userID])
+	}
+	amounts, err := total.Allocate(weights)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: items must not all be free", ErrInvalidSplit)
+	}
+
+	splits := make([]models.Split, 0, len(userOrder))
+	for i, userID := range userOrder {
+		splits = append(splits, models.Split{UserID: userID, Amount: amounts[i]})
+	}
+
+	return total, splits, nil
+}
+
+// computePayers returns who paid how much towards an expense of amount, and
+// the primary payer stored in expenses.paid_by. Without payers, paidBy pays
+// everything. With payers, their contributions must add up to amount, and
+// paidBy is the primary payer if it is one of them.
+func computePayers(paidBy int, payers []models.ExpensePayer, amount money.Money) ([]models.ExpensePayer, int, error) {
+	if len(payers) == 0 {
+		if paidBy == 0 {
+			return nil, 0, fmt.Errorf("%w: paid_by or payers are required", ErrInvalidSplit)
+		}
+		return []models.ExpensePayer{{UserID: paidBy, Amount: amount}}, paidBy, nil
+	}
+
+	userIDs := make([]int, 0, len(payers))
+	total := money.Money(0)
+	primary := payers[0].UserID
+	for _, p := range payers {
+		if p.Amount <= 0 {
+			return nil, 0, fmt.Errorf("%w: contribution of payer %d must be greater than zero", ErrInvalidSplit, p.UserID)
+		}
+		if p.UserID == paidBy {
+			primary = paidBy
+		}
+		userIDs = append(userIDs, p.UserID)
+		total += p.Amount
+	}
+	if err := checkDuplicateUsers(userIDs); err != nil {
+		return nil, 0, err
+	}
+	if total != amount {
+		return nil, 0, fmt.Errorf("%w: payer contributions add up to %s but the expense is %s", ErrInvalidSplit, total, amount)
+	}
+
+	return payers, primary, nil
+}
+
+// debt is an amount one user owes another for a single expense
+type debt struct {
+	creditor int
+	debtor   int
+	amount   money.Money
+}
+
+// matchPayers pairs each split with the payers who covered it, walking both
+// lists in order so that every payer is credited exactly their contribution
+// and every participant is charged exactly their split. Payers and splits of
+// the same expense add up to the same amount.
+func matchPayers(payers []models.ExpensePayer, splits []models.Split) []debt {
+	debts := []debt{}
+	p := 0
+	var paidLeft money.Money
+	if len(payers) > 0 {
+		paidLeft = payers[0].Amount
+	}
+
+	for _, split := range splits {
+		owed := split.Amount
+		for owed > 0 && p < len(payers) {
+			if paidLeft == 0 {
+				p++
+				if p == len(payers) {
+					break
+				}
+				paidLeft = payers[p].Amount
+				continue
+			}
+
+			part := owed
+			if paidLeft < part {
+				part = paidLeft
+			}
+			debts = append(debts, debt{creditor: payers[p].UserID, debtor: split.UserID, amount: part})
+			owed -= part
+			paidLeft -= part
+		}
+	}
+
+	return debts
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"errors"
+	"expense-splitter/internal/models"
+	"expense-splitter/pkg/money"
+	"slices"
+	"testing"
+)
+
+// owed reduces splits to who owes what, in order
+func owed(splits []models.Split) []models.Split {
+	result := make([]models.Split, len(splits))
+	for i, split := range splits {
+		result[i] = models.Split{UserID: split.UserID, Amount: split.Amount}
+	}
+	return result
+}
+
+func TestComputeSplits(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    money.Money
+		splitType string
+		splitWith []int
+		values    []models.SplitValue
+		want      []models.Split
+		wantErr   bool
+	}{
+		{
+			name:      "equal",
+			amount:    9000,
+			splitType: models.SplitEqual,
+			splitWith: []int{1, 2, 3},
+			want:      []models.Split{{UserID: 1, Amount: 3000}, {UserID: 2, Amount: 3000}, {UserID: 3, Amount: 3000}},
+		},
+		{
+			name:      "equal with leftover",
+			amount:    10000,
+			splitType: models.SplitEqual,
+			splitWith: []int{1, 2, 3},
+			want:      []models.Split{{UserID: 1, Amount: 3334}, {UserID: 2, Amount: 3333}, {UserID: 3, Amount: 3333}},
+		},
+		{
+			name:      "equal without participants",
+			amount:    10000,
+			splitType: models.SplitEqual,
+			wantErr:   true,
+		},
+		{
+			name:      "equal with duplicate participant",
+			amount:    10000,
+			splitType: models.SplitEqual,
+			splitWith: []int{1, 1},
+			wantErr:   true,
+		},
+		{
+			name:      "exact",
+			amount:    10000,
+			splitType: models.SplitExact,
+			values:    []models.SplitValue{{UserID: 1, Value: 25.5}, {UserID: 2, Value: 74.5}},
+			want:      []models.Split{{UserID: 1, Amount: 2550}, {UserID: 2, Amount: 7450}},
+		},
+		{
+			name:      "exact not adding up",
+			amount:    10000,
+			splitType: models.SplitExact,
+			values:    []models.SplitValue{{UserID: 1, Value: 25}, {UserID: 2, Value: 74}},
+			wantErr:   true,
+		},
+		{
+			name:      "exact with three decimal places",
+			amount:    10000,
+			splitType: models.SplitExact,
+			values:    []models.SplitValue{{UserID: 1, Value: 25.505}, {UserID: 2, Value: 74.495}},
+			wantErr:   true,
+		},
+		{
+			name:      "percentage",
+			amount:    10000,
+			splitType: models.SplitPercentage,
+			values:    []models.SplitValue{{UserID: 1, Value: 33.3333}, {UserID: 2, Value: 33.3333}, {UserID: 3, Value: 33.3334}},
+			want:      []models.Split{{UserID: 1, Amount: 3333}, {UserID: 2, Amount: 3333}, {UserID: 3, Amount: 3334}},
+		},
+		{
+			name:      "percentage not adding up to 100",
+			amount:    10000,
+			splitType: models.SplitPercentage,
+			values:    []models.SplitValue{{UserID: 1, Value: 50}, {UserID: 2, Value: 49.99}},
+			wantErr:   true,
+		},
+		{
+			name:      "shares",
+			amount:    10000,
+			splitType: models.SplitShares,
+			values:    []models.SplitValue{{UserID: 1, Value: 1}, {UserID: 2, Value: 2}, {UserID: 3, Value: 0}},
+			want:      []models.Split{{UserID: 1, Amount: 3333}, {UserID: 2, Amount: 6667}, {UserID: 3, Amount: 0}},
+		},
+		{
+			name:      "shares all zero",
+			amount:    10000,
+			splitType: models.SplitShares,
+			values:    []models.SplitValue{{UserID: 1, Value: 0}, {UserID: 2, Value: 0}},
+			wantErr:   true,
+		},
+		{
+			name:      "negative value",
+			amount:    10000,
+			splitType: models.SplitShares,
+			values:    []models.SplitValue{{UserID: 1, Value: -1}, {UserID: 2, Value: 2}},
+			wantErr:   true,
+		},
+		{
+			name:      "duplicate value",
+			amount:    10000,
+			splitType: models.SplitShares,
+			values:    []models.SplitValue{{UserID: 1, Value: 1}, {UserID: 1, Value: 2}},
+			wantErr:   true,
+		},
+		{
+			name:      "missing values",
+			amount:    10000,
+			splitType: models.SplitExact,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown split type",
+			amount:    10000,
+			splitType: "halves",
+			values:    []models.SplitValue{{UserID: 1, Value: 1}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := computeSplits(tt.amount, tt.splitType, tt.splitWith, tt.values)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSplit) {
+					t.Fatalf("computeSplits() error = %v, want %v", err, ErrInvalidSplit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("computeSplits() error = %v", err)
+			}
+			if !slices.Equal(owed(got), tt.want) {
+				t.Errorf("computeSplits() = %v, want %v", owed(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRatioWeights(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []models.SplitValue
+		want      []int64
+		wantTotal int64
+	}{
+		{name: "whole numbers", values: []models.SplitValue{{UserID: 1, Value: 1}, {UserID: 2, Value: 2}}, want: []int64{10000, 20000}, wantTotal: 30000},
+		{name: "four decimal places", values: []models.SplitValue{{UserID: 1, Value: 33.3333}, {UserID: 2, Value: 66.6667}}, want: []int64{333333, 666667}, wantTotal: fullPercentages},
+		{name: "rounded past four places", values: []models.SplitValue{{UserID: 1, Value: 0.00005}}, want: []int64{1}, wantTotal: 1},
+		{name: "empty", want: []int64{}, wantTotal: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := ratioWeights(tt.values)
+			if !slices.Equal(got, tt.want) || total != tt.wantTotal {
+				t.Errorf("ratioWeights() = %v, %d, want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestComputeItemizedSplits(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []models.ExpenseItem
+		adj       *models.ExpenseAdjustments
+		wantTotal money.Money
+		want      []models.Split
+		wantErr   bool
+	}{
+		{
+			name: "shared and single items",
+			items: []models.ExpenseItem{
+				{Name: "Pizza", Amount: 30000, Consumers: []int{1, 2, 3}},
+				{Name: "Beer", Amount: 10000, Consumers: []int{2}},
+			},
+			wantTotal: 40000,
+			want:      []models.Split{{UserID: 1, Amount: 10000}, {UserID: 2, Amount: 20000}, {UserID: 3, Amount: 10000}},
+		},
+		{
+			name:      "uneven item",
+			items:     []models.ExpenseItem{{Name: "Cake", Amount: 100, Consumers: []int{1, 2, 3}}},
+			wantTotal: 100,
+			want:      []models.Split{{UserID: 1, Amount: 34}, {UserID: 2, Amount: 33}, {UserID: 3, Amount: 33}},
+		},
+		{
+			name: "service charge and tax",
+			items: []models.ExpenseItem{
+				{Name: "Curry", Amount: 10000, Consumers: []int{1}},
+				{Name: "Noodles", Amount: 30000, Consumers: []int{2}},
+			},
+			adj:       &models.ExpenseAdjustments{ServiceChargePercent: 10, TaxPercent: 7},
+			wantTotal: 47080,
+			want:      []models.Split{{UserID: 1, Amount: 11770}, {UserID: 2, Amount: 35310}},
+		},
+		{
+			name: "discount then tip",
+			items: []models.ExpenseItem{
+				{Name: "Curry", Amount: 10000, Consumers: []int{1}},
+				{Name: "Noodles", Amount: 30000, Consumers: []int{2}},
+			},
+			adj:       &models.ExpenseAdjustments{Discount: 4000, Tip: 2000},
+			wantTotal: 38000,
+			want:      []models.Split{{UserID: 1, Amount: 9500}, {UserID: 2, Amount: 28500}},
+		},
+		{
+			name:      "free item keeps its consumer",
+			items:     []models.ExpenseItem{{Name: "Water", Amount: 0, Consumers: []int{1}}, {Name: "Soup", Amount: 500, Consumers: []int{2}}},
+			wantTotal: 500,
+			want:      []models.Split{{UserID: 1, Amount: 0}, {UserID: 2, Amount: 500}},
+		},
+		{name: "no items", wantErr: true},
+		{name: "negative item", items: []models.ExpenseItem{{Amount: -100, Consumers: []int{1}}}, wantErr: true},
+		{name: "no consumers", items: []models.ExpenseItem{{Amount: 100}}, wantErr: true},
+		{name: "duplicate consumer", items: []models.ExpenseItem{{Amount: 100, Consumers: []int{1, 1}}}, wantErr: true},
+		{
+			name:    "discount above subtotal",
+			items:   []models.ExpenseItem{{Amount: 100, Consumers: []int{1}}},
+			adj:     &models.ExpenseAdjustments{Discount: 101},
+			wantErr: true,
+		},
+		{
+			name:    "negative tip",
+			items:   []models.ExpenseItem{{Amount: 100, Consumers: []int{1}}},
+			adj:     &models.ExpenseAdjustments{Tip: -1},
+			wantErr: true,
+		},
+		{
+			name:    "tax above 100 percent",
+			items:   []models.ExpenseItem{{Amount: 100, Consumers: []int{1}}},
+			adj:     &models.ExpenseAdjustments{TaxPercent: 100.01},
+			wantErr: true,
+		},
+		{
+			name:    "all free",
+			items:   []models.ExpenseItem{{Amount: 0, Consumers: []int{1}}},
+			wantErr: true,
+		},
+		{
+			name:    "free items with a tip",
+			items:   []models.ExpenseItem{{Amount: 0, Consumers: []int{1}}},
+			adj:     &models.ExpenseAdjustments{Tip: 100},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, got, err := computeItemizedSplits(tt.items, tt.adj)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSplit) {
+					t.Fatalf("computeItemizedSplits() error = %v, want %v", err, ErrInvalidSplit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("computeItemizedSplits() error = %v", err)
+			}
+			if total != tt.wantTotal || !slices.Equal(owed(got), tt.want) {
+				t.Errorf("computeItemizedSplits() = %s, %v, want %s, %v", total, owed(got), tt.wantTotal, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePayers(t *testing.T) {
+	tests := []struct {
+		name        string
+		paidBy      int
+		payers      []models.ExpensePayer
+		amount      money.Money
+		want        []models.ExpensePayer
+		wantPrimary int
+		wantErr     bool
+	}{
+		{
+			name:        "single payer",
+			paidBy:      1,
+			amount:      10000,
+			want:        []models.ExpensePayer{{UserID: 1, Amount: 10000}},
+			wantPrimary: 1,
+		},
+		{
+			name:        "primary among payers",
+			paidBy:      2,
+			payers:      []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 6000}},
+			amount:      10000,
+			want:        []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 6000}},
+			wantPrimary: 2,
+		},
+		{
+			name:        "first payer is primary",
+			paidBy:      3,
+			payers:      []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 6000}},
+			amount:      10000,
+			want:        []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 6000}},
+			wantPrimary: 1,
+		},
+		{name: "nobody paid", amount: 10000, wantErr: true},
+		{
+			name:    "not adding up",
+			payers:  []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 5000}},
+			amount:  10000,
+			wantErr: true,
+		},
+		{
+			name:    "zero contribution",
+			payers:  []models.ExpensePayer{{UserID: 1, Amount: 10000}, {UserID: 2, Amount: 0}},
+			amount:  10000,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate payer",
+			payers:  []models.ExpensePayer{{UserID: 1, Amount: 5000}, {UserID: 1, Amount: 5000}},
+			amount:  10000,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, primary, err := computePayers(tt.paidBy, tt.payers, tt.amount)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSplit) {
+					t.Fatalf("computePayers() error = %v, want %v", err, ErrInvalidSplit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("computePayers() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) || primary != tt.wantPrimary {
+				t.Errorf("computePayers() = %v, %d, want %v, %d", got, primary, tt.want, tt.wantPrimary)
+			}
+		})
+	}
+}
+
+func TestMatchPayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		payers []models.ExpensePayer
+		splits []models.Split
+		want   []debt
+	}{
+		{
+			name:   "single payer",
+			payers: []models.ExpensePayer{{UserID: 1, Amount: 9000}},
+			splits: []models.Split{{UserID: 1, Amount: 3000}, {UserID: 2, Amount: 3000}, {UserID: 3, Amount: 3000}},
+			want:   []debt{{creditor: 1, debtor: 1, amount: 3000}, {creditor: 1, debtor: 2, amount: 3000}, {creditor: 1, debtor: 3, amount: 3000}},
+		},
+		{
+			name:   "split straddles two payers",
+			payers: []models.ExpensePayer{{UserID: 1, Amount: 4000}, {UserID: 2, Amount: 5000}},
+			splits: []models.Split{{UserID: 1, Amount: 3000}, {UserID: 2, Amount: 3000}, {UserID: 3, Amount: 3000}},
+			want: []debt{
+				{creditor: 1, debtor: 1, amount: 3000},
+				{creditor: 1, debtor: 2, amount: 1000},
+				{creditor: 2, debtor: 2, amount: 2000},
+				{creditor: 2, debtor: 3, amount: 3000},
+			},
+		},
+		{
+			name:   "payer outside the split",
+			payers: []models.ExpensePayer{{UserID: 4, Amount: 1000}, {UserID: 1, Amount: 1000}},
+			splits: []models.Split{{UserID: 1, Amount: 1500}, {UserID: 2, Amount: 500}},
+			want: []debt{
+				{creditor: 4, debtor: 1, amount: 1000},
+				{creditor: 1, debtor: 1, amount: 500},
+				{creditor: 1, debtor: 2, amount: 500},
+			},
+		},
+		{
+			name:   "zero split",
+			payers: []models.ExpensePayer{{UserID: 1, Amount: 1000}},
+			splits: []models.Split{{UserID: 2, Amount: 0}, {UserID: 3, Amount: 1000}},
+			want:   []debt{{creditor: 1, debtor: 3, amount: 1000}},
+		},
+		{name: "no payers", splits: []models.Split{{UserID: 1, Amount: 1000}}, want: []debt{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchPayers(tt.payers, tt.splits); !slices.Equal(got, tt.want) {
+				t.Errorf("matchPayers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
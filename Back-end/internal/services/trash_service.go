@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"expense-splitter/internal/events"
+	"expense-splitter/internal/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted expenses and groups are kept
+// before they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashService lists, restores and purges soft-deleted expenses and groups.
+// ExpenseService.DeleteExpense and GroupService.DeleteGroup put them there.
+type TrashService struct {
+	db           *sql.DB
+	groupService *GroupService
+	retention    time.Duration
+	events       events.Publisher
+}
+
+func NewTrashService(db *sql.DB, groupService *GroupService, retention time.Duration, publisher events.Publisher) *TrashService {
+	return &TrashService{db: db, groupService: groupService, retention: retention, events: publisher}
+}
+
+// GetGroupTrash lists a group's deleted expenses, most recently deleted first
+func (s *TrashService) GetGroupTrash(groupID int) ([]models.DeletedExpense, error) {
+	query := `
+		SELECT e.id, e.deleted_at, e.deleted_by, d.name
+		FROM expenses e
+		LEFT JOIN users d ON e.deleted_by = d.id
+		WHERE e.group_id = $1 AND e.deleted_at IS NOT NULL
+		ORDER BY e.deleted_at DESC, e.id DESC
+	`
+
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := []models.DeletedExpense{}
+	for rows.Next() {
+		var item models.DeletedExpense
+		var deletedBy sql.NullInt64
+		var deletedByName sql.NullString
+		if err := rows.Scan(&item.ID, &item.DeletedAt, &deletedBy, &deletedByName); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if deletedBy.Valid {
+			item.DeletedBy = &deletedBy.Int64
+		}
+		if deletedByName.Valid {
+			item.DeletedByName = deletedByName.String
+		}
+		item.PurgeAt = item.DeletedAt.Add(s.retention)
+
+		deleted = append(deleted, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range deleted {
+		expense, err := loadExpense(s.db, deleted[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		deleted[i].Expense = *expense
+	}
+
+	return deleted, nil
+}
+
+// RestoreExpense takes an expense out of the group's trash. Everyone who
+// paid or shares the expense must still be a member of the group.
+func (s *TrashService) RestoreExpense(groupID, expenseID, actorID int) (*models.Expense, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE expenses
+		SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND group_id = $2 AND deleted_at IS NOT NULL
+		RETURNING id
+	`
+
+	var restored int
+	err = tx.QueryRow(query, expenseID, groupID).Scan(&restored)
+	if err == sql.ErrNoRows {
+		return nil, ErrExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expense, err := loadExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.groupService.RequireParticipants(groupID, splitParticipants(expense.Payers, expense.Splits)); err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    actorID,
+		entityType: models.AuditEntityExpense,
+		entityID:   expenseID,
+		action:     models.AuditActionRestore,
+		after:      expense,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(events.New(events.ExpenseRestored, groupID, expenseID, actorID, expense))
+	return expense, nil
+}
+
+// GetDeletedGroups lists the deleted groups userID may restore
+func (s *TrashService) GetDeletedGroups(userID int) ([]models.DeletedGroup, error) {
+	query := `
+		SELECT g.id, g.name, g.description, g.created_by, g.base_currency, g.require_join_approval, gm.role, g.created_at,
+		       g.deleted_at, g.deleted_by, d.name
+		FROM groups g
+		JOIN group_members gm ON g.id = gm.group_id
+		LEFT JOIN users d ON g.deleted_by = d.id
+		WHERE gm.user_id = $1 AND g.deleted_at IS NOT NULL
+		ORDER BY g.deleted_at DESC
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.DeletedGroup{}
+	for rows.Next() {
+		var group models.DeletedGroup
+		var deletedBy sql.NullInt64
+		var deletedByName sql.NullString
+		if err := rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.Description,
+			&group.CreatedBy,
+			&group.BaseCurrency,
+			&group.RequireJoinApproval,
+			&group.Role,
+			&group.CreatedAt,
+			&group.DeletedAt,
+			&deletedBy,
+			&deletedByName,
+		); err != nil {
+			return nil, err
+		}
+		if !RoleHasPermission(group.Role, PermDeleteGroup) {
+			continue
+		}
+
+		// Handle nullable fields
+		if deletedBy.Valid {
+			group.DeletedBy = &deletedBy.Int64
+		}
+		if deletedByName.Valid {
+			group.DeletedByName = deletedByName.String
+		}
+		group.PurgeAt = group.DeletedAt.Add(s.retention)
+
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// RestoreGroup takes a group out of the trash. Only members who could have
+// deleted it may restore it.
+func (s *TrashService) RestoreGroup(groupID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	query := `
+		SELECT gm.role
+		FROM groups g
+		JOIN group_members gm ON g.id = gm.group_id
+		WHERE g.id = $1 AND gm.user_id = $2 AND g.deleted_at IS NOT NULL
+		FOR UPDATE OF g
+	`
+	err = tx.QueryRow(query, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !RoleHasPermission(role, PermDeleteGroup) {
+		return ErrPermissionDenied
+	}
+
+	restoreQuery := `
+		UPDATE groups
+		SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, name, description, created_by, base_currency, require_join_approval, created_at
+	`
+
+	group := &models.Group{}
+	err = tx.QueryRow(restoreQuery, groupID).Scan(
+		&group.ID,
+		&group.Name,
+		&group.Description,
+		&group.CreatedBy,
+		&group.BaseCurrency,
+		&group.RequireJoinApproval,
+		&group.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore group: %v", err)
+	}
+
+	if err := writeAudit(tx, auditRecord{
+		groupID:    groupID,
+		actorID:    userID,
+		entityType: models.AuditEntityGroup,
+		entityID:   groupID,
+		action:     models.AuditActionRestore,
+		after:      group,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.events.Publish(events.New(events.GroupRestored, groupID, groupID, userID, group))
+	return nil
+}
+
+// Purge permanently deletes expenses and groups that have been in the trash
+// longer than the retention period, and returns how many of each it removed
+func (s *TrashService) Purge() (expenses, groups int64, err error) {
+	// deleted_at comes from the database clock, so the cutoff does too
+	retention := s.retention.Seconds()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// The audit log keeps the expense's history and notes when it went
+	expenseQuery := `
+		WITH purged AS (
+			DELETE FROM expenses
+			WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			RETURNING id, group_id
+		)
+		INSERT INTO audit_log (group_id, entity_type, entity_id, action)
+		SELECT group_id, $2, id, $3 FROM purged
+	`
+	result, err := tx.Exec(expenseQuery, retention, models.AuditEntityExpense, models.AuditActionPurge)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge expenses: %v", err)
+	}
+	if expenses, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	// Deleting a group cascades to its members, expenses and payments
+	result, err = tx.Exec("DELETE FROM groups WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)", retention)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge groups: %v", err)
+	}
+	if groups, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return expenses, groups, nil
+}
+
+// Run calls Purge every interval until ctx is cancelled
+func (s *TrashService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if expenses, groups, err := s.Purge(); err != nil {
+			log.Printf("Trash purge: %v", err)
+		} else if expenses > 0 || groups > 0 {
+			log.Printf("Trash purge: removed %d expenses and %d groups", expenses, groups)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
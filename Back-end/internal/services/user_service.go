@@ -3,13 +3,19 @@ package services
 import (
 	"database/sql"
 	"errors"
+	"expense-splitter/internal/mail"
 	"expense-splitter/internal/models"
+	"expense-splitter/pkg/promptpay"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 )
 
-var ErrEmailAlreadyExists = errors.New("email already exists")
+var (
+	ErrEmailAlreadyExists = errors.New("email already exists")
+	ErrUnsupportedLocale  = errors.New("unsupported locale")
+)
 
 type UserService struct {
 	db *sql.DB
@@ -70,7 +76,7 @@ func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 
 func (s *UserService) GetUserByID(id int) (*models.User, error) {
 	query := `
-		SELECT id, email, name, created_at
+		SELECT id, COALESCE(email, ''), name, is_guest, COALESCE(promptpay_id, ''), created_at
 		FROM users
 		WHERE id = $1
 	`
@@ -80,6 +86,8 @@ func (s *UserService) GetUserByID(id int) (*models.User, error) {
 		&user.ID,
 		&user.Email,
 		&user.Name,
+		&user.IsGuest,
+		&user.PromptPayID,
 		&user.CreatedAt,
 	)
 
@@ -96,12 +104,12 @@ func (s *UserService) GetUsersByIDs(ids []int) ([]models.User, error) {
 	}
 
 	query := `
-		SELECT id, email, name, created_at
+		SELECT id, COALESCE(email, ''), name, is_guest, created_at
 		FROM users
 		WHERE id = ANY($1)
 	`
 
-	rows, err := s.db.Query(query, ids)
+	rows, err := s.db.Query(query, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +118,7 @@ func (s *UserService) GetUsersByIDs(ids []int) ([]models.User, error) {
 	users := []models.User{}
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsGuest, &user.CreatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -135,6 +143,7 @@ func (s *UserService) SearchUsers(query string, currentUserID int, excludeGroupI
 		AND u.id NOT IN (
 			SELECT user_id FROM group_members WHERE group_id = $3
 		)
+		AND ` + excludeBlocked("$1") + `
 		LIMIT 10
 	`
 
@@ -167,6 +176,8 @@ func (s *UserService) SearchAllUsers(query string, currentUserID int) ([]models.
 		FROM users u
 		WHERE (u.email ILIKE $1 OR u.name ILIKE $1)
 		AND u.id != $2
+		AND NOT u.is_guest
+		AND ` + excludeBlocked("$2") + `
 		ORDER BY u.name
 		LIMIT 20
 	`
@@ -188,3 +199,49 @@ func (s *UserService) SearchAllUsers(query string, currentUserID int) ([]models.
 
 	return users, nil
 }
+
+// SetLocale sets the language of the mail userID receives
+func (s *UserService) SetLocale(userID int, locale string) error {
+	if !mail.SupportedLocale(locale) {
+		return fmt.Errorf("%w: %q", ErrUnsupportedLocale, locale)
+	}
+
+	_, err := s.db.Exec("UPDATE users SET locale = $1 WHERE id = $2 AND NOT is_guest", locale, userID)
+	return err
+}
+
+// GetPromptPayID returns the PromptPay ID userID is paid back to, with an
+// empty ID if they have not set one
+func (s *UserService) GetPromptPayID(userID int) (*models.PromptPayProfile, error) {
+	var id sql.NullString
+	if err := s.db.QueryRow("SELECT promptpay_id FROM users WHERE id = $1", userID).Scan(&id); err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+
+	profile := &models.PromptPayProfile{}
+	if id.Valid {
+		profile.PromptPayID = id.String
+		_, profile.Kind, _ = promptpay.Normalize(id.String)
+	}
+	return profile, nil
+}
+
+// SetPromptPayID stores the PromptPay ID userID is paid back to, or removes
+// it when id is empty
+func (s *UserService) SetPromptPayID(userID int, id string) (*models.PromptPayProfile, error) {
+	profile := &models.PromptPayProfile{}
+	stored := sql.NullString{}
+	if strings.TrimSpace(id) != "" {
+		digits, kind, err := promptpay.Normalize(id)
+		if err != nil {
+			return nil, err
+		}
+		profile.PromptPayID, profile.Kind = digits, kind
+		stored = sql.NullString{String: digits, Valid: true}
+	}
+
+	if _, err := s.db.Exec("UPDATE users SET promptpay_id = $1 WHERE id = $2 AND NOT is_guest", stored, userID); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
@@ -0,0 +1,65 @@
+package slip
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// Formats maps the image formats Decode reads to the extension and content
+// type files in that format are stored with
+var Formats = map[string]struct{ Ext, ContentType string }{
+	"jpeg": {".jpg", "image/jpeg"},
+	"png":  {".png", "image/png"},
+}
+
+// MaxPixels is the largest image Decode reads. A small file can claim huge
+// dimensions, and decoding it would allocate memory for every pixel.
+const MaxPixels = 40_000_000
+
+// Decode finds the QR code on a JPEG or PNG slip image and parses it. It
+// also returns the format read from the image data, as image.Decode does.
+// The image's header is checked before it is decoded, so r is read twice.
+func Decode(r io.ReadSeeker) (*Slip, string, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if _, ok := Formats[format]; !ok {
+		return nil, "", fmt.Errorf("%w: unsupported format %q", ErrInvalidImage, format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, "", fmt.Errorf("%w: image is %dx%d pixels", ErrInvalidImage, config.Width, config.Height)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	// The mini-QR is a small part of a slip, so look harder than for an
+	// image of just the code
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+	if err != nil {
+		return nil, "", ErrNoQRCode
+	}
+
+	sl, err := Parse(result.GetText())
+	return sl, format, err
+}
@@ -0,0 +1,68 @@
+package slip
+
+import (
+	"errors"
+	"expense-splitter/pkg/promptpay"
+	"strings"
+	"testing"
+)
+
+// withCRC ends body with the checksum field a slip QR code carries
+func withCRC(body string) string {
+	body += tagCRC + "04"
+	return body + promptpay.Checksum(body)
+}
+
+func TestParse(t *testing.T) {
+	transaction := "0006000001" + "0103004" + "021720240101ABCDEFGHI"
+	valid := "0038" + transaction + "5102TH"
+	lower := withCRC(valid)
+	lower = lower[:len(lower)-4] + strings.ToLower(lower[len(lower)-4:])
+
+	tests := []struct {
+		name    string
+		payload string
+		want    Slip
+		wantErr error
+	}{
+		{
+			name:    "valid slip",
+			payload: withCRC(valid),
+			want:    Slip{APIID: "000001", SendingBank: "004", TransRef: "20240101ABCDEFGHI", Country: "TH"},
+		},
+		{
+			name:    "lowercase checksum",
+			payload: lower,
+			want:    Slip{APIID: "000001", SendingBank: "004", TransRef: "20240101ABCDEFGHI", Country: "TH"},
+		},
+		{name: "empty", payload: "", wantErr: ErrInvalidSlip},
+		{name: "missing checksum", payload: valid, wantErr: ErrInvalidSlip},
+		{name: "checksum mismatch", payload: valid + "91040000", wantErr: ErrInvalidSlip},
+		{name: "truncated field", payload: withCRC("000"), wantErr: ErrInvalidSlip},
+		{name: "truncated value", payload: withCRC("0038" + transaction[:20]), wantErr: ErrInvalidSlip},
+		{name: "negative length", payload: withCRC("0005" + "02-1X"), wantErr: ErrInvalidSlip},
+		{name: "signed length", payload: withCRC("0004" + "02+1"), wantErr: ErrInvalidSlip},
+		{name: "oversized length", payload: withCRC("0099" + transaction), wantErr: ErrInvalidSlip},
+		{name: "non-digit length", payload: withCRC("00AB" + transaction), wantErr: ErrInvalidSlip},
+		{name: "no transaction reference", payload: withCRC("0017" + "0006000001" + "0103004" + "5102TH"), wantErr: ErrInvalidSlip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.payload)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.payload, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.payload, err)
+			}
+			tt.want.Payload = tt.payload
+			if *got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.payload, *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// CloudinaryStorage keeps files as Cloudinary images. Their URLs are
+// public and do not expire.
+type CloudinaryStorage struct {
+	cld *cloudinary.Cloudinary
+}
+
+func NewCloudinaryStorage(cloudName, apiKey, apiSecret string) (*CloudinaryStorage, error) {
+	cld, err := cloudinary.NewFromParams(cloudName, apiKey, apiSecret)
+	if err != nil {
+		return nil, err
+	}
+	cld.Config.URL.Secure = true
+	return &CloudinaryStorage{cld: cld}, nil
+}
+
+func (s *CloudinaryStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	result, err := s.cld.Upload.Upload(ctx, r, uploader.UploadParams{
+		PublicID: publicID(key),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Error.Message != "" {
+		return errors.New(result.Error.Message)
+	}
+	return nil
+}
+
+func (s *CloudinaryStorage) URL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	image, err := s.cld.Image(publicID(key))
+	if err != nil {
+		return "", err
+	}
+	return image.String()
+}
+
+func (s *CloudinaryStorage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	result, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID: publicID(key),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Error.Message != "" {
+		return errors.New(result.Error.Message)
+	}
+	return nil
+}
+
+// publicID drops the extension from key, which Cloudinary keeps as the
+// image's format instead
+func publicID(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
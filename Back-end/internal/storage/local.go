@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid download signature")
+	ErrLinkExpired      = errors.New("download link has expired")
+	ErrNoSigningKey     = errors.New("a key for signing download links is required")
+)
+
+// LocalStorage keeps files in a directory. They are downloaded through the
+// API with URLs signed with secret that stop working after ttl.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+	ttl     time.Duration
+}
+
+// NewLocalStorage stores files under dir. baseURL is where the API serves
+// them, for example "http://localhost:8080/api/files".
+func NewLocalStorage(dir, baseURL string, secret []byte, ttl time.Duration) (*LocalStorage, error) {
+	if len(secret) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{dir: dir, baseURL: baseURL, secret: secret, ttl: ttl}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed upload leaves nothing
+	// behind under key
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (s *LocalStorage) URL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.sign(key, expires)},
+	}
+	return fmt.Sprintf("%s/%s?%s", s.baseURL, (&url.URL{Path: key}).EscapedPath(), query.Encode()), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Open checks the signature of a download URL made by URL and opens the
+// file it points to
+func (s *LocalStorage) Open(key, expires, signature string) (*os.File, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		return nil, ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return nil, ErrLinkExpired
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// sign returns the HMAC of key and its expiry time
+func (s *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
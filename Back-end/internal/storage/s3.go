@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage keeps files in a bucket of any S3-compatible service, such as
+// AWS S3 or a local MinIO. Downloads use presigned URLs that stop working
+// after ttl.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	ttl    time.Duration
+}
+
+// NewS3Storage connects to endpoint, a host and optional port such as
+// "s3.amazonaws.com" or "localhost:9000"
+func NewS3Storage(endpoint, region, accessKey, secretKey, bucket string, useSSL bool, ttl time.Duration) (*S3Storage, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{client: client, bucket: bucket, ttl: ttl}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Storage) URL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, s.ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
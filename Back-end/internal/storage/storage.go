@@ -0,0 +1,52 @@
+// Package storage keeps uploaded files, such as payment slips, on local
+// disk, in an S3-compatible bucket or on Cloudinary.
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// Storage keeps files under slash-separated keys such as
+// "slips/12/3f9a0c.jpg"
+type Storage interface {
+	// Put stores size bytes from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// URL returns a URL the file can be downloaded from. Backends that can
+	// make the URL expire do.
+	URL(ctx context.Context, key string) (string, error)
+	// Delete removes the file under key. Removing a missing file is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns a random key under prefix ending in ext, so uploads never
+// overwrite each other. ext should come from what the file was found to
+// contain, never from the name the client gave it, since downloads are
+// served with the content type the extension implies.
+func NewKey(prefix, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return path.Join(prefix, hex.EncodeToString(b)+ext), nil
+}
+
+// checkKey rejects keys that could escape the storage root
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
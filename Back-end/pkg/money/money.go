@@ -0,0 +1,249 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor currency units (satang for THB, cents for USD).
+// It marshals to JSON as a decimal number with two places so API clients keep
+// seeing 33.34 rather than 3334.
+type Money int64
+
+const minorPerMajor = 100
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// FromFloat converts a decimal amount to Money, rounding half away from zero
+func FromFloat(f float64) Money {
+	return Money(math.Round(f * minorPerMajor))
+}
+
+// Parse reads a decimal string such as "100", "-3.5" or "33.34" without going
+// through float64. More than two decimal places is an error.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("%w: empty string", ErrInvalidAmount)
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	// DECIMAL columns come back padded, e.g. "33.3400"
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: %q has more than two decimal places", ErrInvalidAmount, s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	major, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || major < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	minor, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if major > (math.MaxInt64-minor)/minorPerMajor {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+
+	m := Money(major*minorPerMajor + minor)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Float64 returns the amount in major units. Use it for display or ratios
+// only, never to do arithmetic that is stored back.
+func (m Money) Float64() float64 {
+	return float64(m) / minorPerMajor
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/minorPerMajor, v%minorPerMajor)
+}
+
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and numeric strings
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores Money as a decimal string so DECIMAL columns keep exact values
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = Money(v * minorPerMajor)
+		return nil
+	case float64:
+		*m = FromFloat(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Money", src)
+}
+
+// MulFrac returns m * num / den rounded half away from zero to the nearest
+// minor unit. den must not be zero.
+func (m Money) MulFrac(num, den int64) Money {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(num))
+	divisor := big.NewInt(den)
+	if divisor.Sign() < 0 {
+		product.Neg(product)
+		divisor.Neg(divisor)
+	}
+	return divRound(product, divisor)
+}
+
+// divRound divides num by a positive den, rounding half away from zero
+func divRound(num, den *big.Int) Money {
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	if twice.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return Money(quotient.Int64())
+}
+
+// Split divides m into n parts that always add up to m. See Allocate for how
+// leftover minor units are handed out.
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	parts, _ := m.Allocate(weights)
+	return parts
+}
+
+// Allocate divides m in proportion to weights so that the parts always add up
+// to m exactly. Each part is first rounded down; the minor units left over
+// then go one at a time to the parts with the largest fractional remainder,
+// with ties going to the earlier position in weights. The result depends only
+// on m and the order of weights.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	total := big.NewInt(0)
+	for _, w := range weights {
+		if w < 0 {
+			return nil, errors.New("allocation weights must not be negative")
+		}
+		total.Add(total, big.NewInt(w))
+	}
+	if total.Sign() == 0 {
+		return nil, errors.New("allocation weights must not all be zero")
+	}
+
+	amount := m.Abs()
+	parts := make([]Money, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	allocated := Money(0)
+
+	for i, w := range weights {
+		product := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(w))
+		quotient, remainder := new(big.Int).QuoRem(product, total, new(big.Int))
+		parts[i] = Money(quotient.Int64())
+		remainders[i] = remainder
+		allocated += parts[i]
+	}
+
+	leftover := int(amount - allocated)
+	for ; leftover > 0; leftover-- {
+		best := -1
+		for i, r := range remainders {
+			if r.Sign() < 0 {
+				continue
+			}
+			if best == -1 || r.Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		parts[best]++
+		// Each part receives at most one extra unit
+		remainders[best] = big.NewInt(-1)
+	}
+
+	if m < 0 {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts, nil
+}
@@ -0,0 +1,150 @@
+package money
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "100", want: 10000},
+		{in: "33.34", want: 3334},
+		{in: "-3.5", want: -350},
+		{in: "+0.07", want: 7},
+		{in: ".5", want: 50},
+		{in: "5.", want: 500},
+		{in: " 12.30 ", want: 1230},
+		{in: "33.3400", want: 3334},
+		{in: "92233720368547758.07", want: 9223372036854775807},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.234", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "1.-5", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "92233720368547758.08", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.in, err, ErrInvalidAmount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 0, want: "0.00"},
+		{in: 7, want: "0.07"},
+		{in: 3334, want: "33.34"},
+		{in: -350, want: "-3.50"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []int64
+		want    []Money
+		wantErr bool
+	}{
+		{name: "even", amount: 900, weights: []int64{1, 1, 1}, want: []Money{300, 300, 300}},
+		{name: "leftover to earliest", amount: 1000, weights: []int64{1, 1, 1}, want: []Money{334, 333, 333}},
+		{name: "leftover to largest remainder", amount: 100, weights: []int64{1, 2}, want: []Money{33, 67}},
+		{name: "two leftovers", amount: 200, weights: []int64{1, 1, 1}, want: []Money{67, 67, 66}},
+		{name: "zero weight", amount: 100, weights: []int64{0, 1, 1}, want: []Money{0, 50, 50}},
+		{name: "negative amount", amount: -1000, weights: []int64{1, 1, 1}, want: []Money{-334, -333, -333}},
+		{name: "zero amount", amount: 0, weights: []int64{1, 2}, want: []Money{0, 0}},
+		{name: "large weights", amount: 1, weights: []int64{1 << 62, 1 << 62}, want: []Money{1, 0}},
+		{name: "negative weight", amount: 100, weights: []int64{-1, 2}, wantErr: true},
+		{name: "all zero weights", amount: 100, weights: []int64{0, 0}, wantErr: true},
+		{name: "no weights", amount: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.Allocate(tt.weights)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Allocate(%v) = %v, want an error", tt.weights, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate(%v) error = %v", tt.weights, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Allocate(%v) = %v, want %v", tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		amount Money
+		n      int
+		want   []Money
+	}{
+		{amount: 10000, n: 3, want: []Money{3334, 3333, 3333}},
+		{amount: 2, n: 3, want: []Money{1, 1, 0}},
+		{amount: 100, n: 1, want: []Money{100}},
+		{amount: 100, n: 0, want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.Split(tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("Money(%d).Split(%d) = %v, want %v", tt.amount, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMulFrac(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		num, den int64
+		want     Money
+	}{
+		{amount: 1000, num: 7, den: 100, want: 70},
+		{amount: 1005, num: 1, den: 10, want: 101},
+		{amount: 1004, num: 1, den: 10, want: 100},
+		{amount: -1005, num: 1, den: 10, want: -101},
+		{amount: 1005, num: 1, den: -10, want: -101},
+		{amount: 100, num: 0, den: 3, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.MulFrac(tt.num, tt.den); got != tt.want {
+			t.Errorf("Money(%d).MulFrac(%d, %d) = %d, want %d", tt.amount, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
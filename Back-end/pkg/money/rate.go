@@ -0,0 +1,139 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// RateDecimals matches the scale of the DECIMAL(18, 8) rate columns
+const RateDecimals = 8
+
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// NormalizeCurrency upper-cases an ISO 4217 code and checks that it has the
+// right shape. It does not check the code against a list of currencies.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCodePattern.MatchString(code) {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	return code, nil
+}
+
+// Rate is an exchange rate kept as an exact fraction. One unit of the source
+// currency is worth Rate units of the target currency.
+type Rate struct {
+	r *big.Rat
+}
+
+// OneRate is the rate between a currency and itself
+func OneRate() Rate {
+	return Rate{r: big.NewRat(1, 1)}
+}
+
+// ParseRate reads a positive decimal string such as "1.0956"
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+	return Rate{r: r}, nil
+}
+
+func (r Rate) rat() *big.Rat {
+	if r.r == nil {
+		return big.NewRat(1, 1)
+	}
+	return r.r
+}
+
+func (r Rate) IsZero() bool {
+	return r.r == nil
+}
+
+// Inverse returns the rate for converting in the opposite direction
+func (r Rate) Inverse() Rate {
+	return Rate{r: new(big.Rat).Inv(r.rat())}
+}
+
+// Mul chains two rates, e.g. USD->EUR times EUR->THB gives USD->THB
+func (r Rate) Mul(other Rate) Rate {
+	return Rate{r: new(big.Rat).Mul(r.rat(), other.rat())}
+}
+
+// Rounded returns the rate rounded to RateDecimals places, which is what gets
+// stored against an expense. A rate too small to survive the rounding is an
+// error rather than a zero rate.
+func (r Rate) Rounded() (Rate, error) {
+	rounded, err := ParseRate(r.String())
+	if err != nil {
+		return Rate{}, fmt.Errorf("%w: %s rounds to zero at %d decimal places", ErrInvalidRate, r.rat().RatString(), RateDecimals)
+	}
+	return rounded, nil
+}
+
+// Convert applies the rate to m, rounding half away from zero to the nearest
+// minor unit
+func (m Money) Convert(r Rate) Money {
+	rate := r.rat()
+	num := new(big.Int).Mul(big.NewInt(int64(m)), rate.Num())
+	return divRound(num, rate.Denom())
+}
+
+func (r Rate) String() string {
+	s := r.rat().FloatString(RateDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := ParseRate(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.rat().FloatString(RateDecimals), nil
+}
+
+func (r *Rate) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	case float64:
+		*r = Rate{r: new(big.Rat).SetFloat64(v)}
+		return nil
+	case int64:
+		*r = Rate{r: big.NewRat(v, 1)}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Rate", src)
+}
+
+func (r *Rate) scanString(s string) error {
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
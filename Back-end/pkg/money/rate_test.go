@@ -0,0 +1,120 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1.0956", want: "1.0956"},
+		{in: " 35.5 ", want: "35.5"},
+		{in: "1", want: "1"},
+		{in: "0", wantErr: true},
+		{in: "-1.5", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRate) {
+					t.Fatalf("ParseRate(%q) error = %v, want %v", tt.in, err, ErrInvalidRate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRate(%q) error = %v", tt.in, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseRate(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   string
+		want   Money
+	}{
+		{amount: 10000, rate: "35.5", want: 355000},
+		{amount: 100, rate: "1.005", want: 101},
+		{amount: 100, rate: "1.004", want: 100},
+		{amount: -100, rate: "1.005", want: -101},
+		{amount: 3333, rate: "0.02816901", want: 94},
+		{amount: 0, rate: "35.5", want: 0},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.amount.Convert(rate); got != tt.want {
+			t.Errorf("Money(%d).Convert(%s) = %d, want %d", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+
+	// The zero Rate converts at one to one
+	if got := Money(1234).Convert(Rate{}); got != 1234 {
+		t.Errorf("Money(1234).Convert(Rate{}) = %d, want 1234", got)
+	}
+}
+
+func TestRateArithmetic(t *testing.T) {
+	usdEUR, _ := ParseRate("0.9")
+	eurTHB, _ := ParseRate("40")
+
+	if got := usdEUR.Mul(eurTHB).String(); got != "36" {
+		t.Errorf("Mul() = %s, want 36", got)
+	}
+	if got := eurTHB.Inverse().String(); got != "0.025" {
+		t.Errorf("Inverse() = %s, want 0.025", got)
+	}
+	if got := usdEUR.Inverse().Inverse().String(); got != "0.9" {
+		t.Errorf("Inverse().Inverse() = %s, want 0.9", got)
+	}
+}
+
+func TestRounded(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1.0956", want: "1.0956"},
+		{in: "0.123456789", want: "0.12345679"},
+		{in: "0.000000005", want: "0.00000001"},
+		{in: "0.000000004", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rate, err := ParseRate(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rate.Rounded()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRate) {
+					t.Fatalf("Rounded() error = %v, want %v", err, ErrInvalidRate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rounded() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Rounded() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package promptpay builds Thai QR Payment payloads for PromptPay transfers
+// following the EMVCo merchant-presented QR specification, and renders them
+// as QR codes.
+package promptpay
+
+import (
+	"errors"
+	"expense-splitter/pkg/money"
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Currency is the only currency PromptPay transfers can be made in
+const Currency = "THB"
+
+var (
+	ErrInvalidID     = errors.New("invalid PromptPay ID")
+	ErrInvalidAmount = errors.New("PromptPay amount must be positive")
+)
+
+// Kinds of PromptPay ID, named after what they are registered against
+const (
+	KindPhone      = "phone"
+	KindNationalID = "national_id"
+	KindEWallet    = "e_wallet"
+)
+
+// EMVCo tags used in the payload. Sub-tags of the merchant account field
+// pick the kind of proxy ID.
+const (
+	tagPayloadFormat   = "00"
+	tagInitiation      = "01"
+	tagMerchantAccount = "29"
+	tagCurrency        = "53"
+	tagAmount          = "54"
+	tagCountry         = "58"
+	tagCRC             = "63"
+
+	subTagAID        = "00"
+	subTagPhone      = "01"
+	subTagNationalID = "02"
+	subTagEWallet    = "03"
+
+	promptPayAID = "A000000677010111"
+	// 12 marks a QR that is meant for a single payment of a given amount
+	initiationDynamic = "12"
+	currencyTHB       = "764"
+)
+
+// Normalize strips the separators people type into a PromptPay ID and
+// returns its digits and kind. Phone numbers may be given in the local
+// 0XXXXXXXXX form or with the +66 country code; they are returned in the
+// local form.
+func Normalize(id string) (string, string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(id) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || (r == '+' && i == 0):
+		default:
+			return "", "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+		}
+	}
+	digits := b.String()
+
+	if len(digits) == 11 && strings.HasPrefix(digits, "66") {
+		digits = "0" + digits[2:]
+	}
+
+	switch {
+	case len(digits) == 10 && digits[0] == '0':
+		return digits, KindPhone, nil
+	case len(digits) == 13:
+		return digits, KindNationalID, nil
+	case len(digits) == 15:
+		return digits, KindEWallet, nil
+	}
+	return "", "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+}
+
+// Payload returns the text of a QR code that asks the payer's banking app to
+// transfer amount baht to id
+func Payload(id string, amount money.Money) (string, error) {
+	digits, kind, err := Normalize(id)
+	if err != nil {
+		return "", err
+	}
+	if amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+
+	var account string
+	switch kind {
+	case KindPhone:
+		// Phone numbers are sent in international form, zero-padded to 13
+		account = field(subTagPhone, "0066"+digits[1:])
+	case KindNationalID:
+		account = field(subTagNationalID, digits)
+	case KindEWallet:
+		account = field(subTagEWallet, digits)
+	}
+
+	payload := field(tagPayloadFormat, "01") +
+		field(tagInitiation, initiationDynamic) +
+		field(tagMerchantAccount, field(subTagAID, promptPayAID)+account) +
+		field(tagCurrency, currencyTHB) +
+		field(tagAmount, amount.String()) +
+		field(tagCountry, "TH")
+
+	// The checksum covers its own tag and length
+	payload += tagCRC + "04"
+	return payload + Checksum(payload), nil
+}
+
+// QRCode renders payload as a PNG size pixels wide
+func QRCode(payload string, size int) ([]byte, error) {
+	return qrcode.Encode(payload, qrcode.Medium, size)
+}
+
+// field encodes one EMVCo data object: a tag, a two digit length and a value
+func field(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+// Checksum returns the four hex digit CRC that ends an EMVCo payload, or a
+// Thai bank slip QR. s runs up to and including the checksum's tag and length.
+func Checksum(s string) string {
+	return fmt.Sprintf("%04X", crc16(s))
+}
+
+// crc16 is CRC-16/CCITT-FALSE
+func crc16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
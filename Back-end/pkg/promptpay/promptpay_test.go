@@ -0,0 +1,119 @@
+package promptpay
+
+import (
+	"errors"
+	"expense-splitter/pkg/money"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint16
+	}{
+		{in: "123456789", want: 0x29B1},
+		{in: "", want: 0xFFFF},
+		{in: "A", want: 0xB915},
+	}
+
+	for _, tt := range tests {
+		if got := crc16(tt.in); got != tt.want {
+			t.Errorf("crc16(%q) = %#04X, want %#04X", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		wantKind string
+		wantErr  bool
+	}{
+		{in: "081-234-5678", want: "0812345678", wantKind: KindPhone},
+		{in: "+66 81 234 5678", want: "0812345678", wantKind: KindPhone},
+		{in: "1234567890123", want: "1234567890123", wantKind: KindNationalID},
+		{in: "123456789012345", want: "123456789012345", wantKind: KindEWallet},
+		{in: "1812345678", wantErr: true},
+		{in: "08123", wantErr: true},
+		{in: "081+2345678", wantErr: true},
+		{in: "081.234.5678", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, kind, err := Normalize(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidID) {
+					t.Fatalf("Normalize(%q) error = %v, want %v", tt.in, err, ErrInvalidID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want || kind != tt.wantKind {
+				t.Errorf("Normalize(%q) = %q, %q, want %q, %q", tt.in, got, kind, tt.want, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		amount  money.Money
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "phone",
+			id:     "0812345678",
+			amount: 10050,
+			want: "000201" + "010212" +
+				"2937" + "0016A000000677010111" + "01130066812345678" +
+				"5303764" + "5406100.50" + "5802TH" + "6304",
+		},
+		{
+			name:   "national ID",
+			id:     "1234567890123",
+			amount: 100,
+			want: "000201" + "010212" +
+				"2937" + "0016A000000677010111" + "02131234567890123" +
+				"5303764" + "54041.00" + "5802TH" + "6304",
+		},
+		{
+			name:   "e-wallet",
+			id:     "123456789012345",
+			amount: 100,
+			want: "000201" + "010212" +
+				"2939" + "0016A000000677010111" + "0315123456789012345" +
+				"5303764" + "54041.00" + "5802TH" + "6304",
+		},
+		{name: "bad ID", id: "12345", amount: 100, wantErr: ErrInvalidID},
+		{name: "zero amount", id: "0812345678", amount: 0, wantErr: ErrInvalidAmount},
+		{name: "negative amount", id: "0812345678", amount: -100, wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Payload(tt.id, tt.amount)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Payload() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Payload() error = %v", err)
+			}
+			// The checksum covers everything before it
+			want := tt.want + Checksum(tt.want)
+			if got != want {
+				t.Errorf("Payload() = %q, want %q", got, want)
+			}
+		})
+	}
+}